@@ -4,6 +4,7 @@ package auth
 
 import (
 	"encoding/base64"
+	"errors"
 	"math/rand"
 	"net"
 	"net/http"
@@ -22,6 +23,9 @@ var (
 	// ReverseProxyIP specifies the IP of a non-localhost reverse proxy. Used
 	// for filtering in XFF IP determination.
 	ReverseProxyIP string
+
+	// ErrBanned is returned, when a banned client attempts a restricted action
+	ErrBanned = errors.New("you are banned")
 )
 
 // User contains ID, password hash and board-related data of a registered user
@@ -39,6 +43,38 @@ type Session struct {
 	Expires time.Time `gorethink:"expires"`
 }
 
+// Ban restricts an IP or IP range from posting on a board. Bans with the board
+// set to "all" apply to all boards.
+type Ban struct {
+	ID      string    `json:"-" gorethink:"id,omitempty"`
+	IP      string    `json:"-" gorethink:"ip"` // Single IP or CIDR range
+	Board   string    `json:"board" gorethink:"board"`
+	Reason  string    `json:"reason" gorethink:"reason"`
+	By      string    `json:"-" gorethink:"by"` // Issuing staff member
+	Expires time.Time `json:"expires" gorethink:"expires"`
+}
+
+// Matches returns, if the ban applies to the passed IP
+func (b Ban) Matches(ip string) bool {
+	// Strip any port
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	if strings.ContainsRune(b.IP, '/') {
+		_, ipNet, err := net.ParseCIDR(b.IP)
+		if err != nil {
+			return false
+		}
+		return ipNet.Contains(parsed)
+	}
+	return parsed.Equal(net.ParseIP(b.IP))
+}
+
 // Ident is used to verify a client's access and write permissions. Contains its
 // IP and logged in user data, if any.
 type Ident struct {
@@ -68,7 +104,9 @@ func IsNonMetaBoard(b string) bool {
 	return config.IsBoard(b)
 }
 
-// GetIP extracts the IP of a request, honouring reverse proxies, if set
+// GetIP extracts the IP of a request, honouring reverse proxies, if set. The
+// port of the remote address is stripped, so all connections from the same
+// host share the same IP.
 func GetIP(req *http.Request) string {
 	if IsReverseProxied {
 		for _, h := range [...]string{"X-Forwarded-For", "X-Real-Ip"} {
@@ -90,7 +128,11 @@ func GetIP(req *http.Request) string {
 			}
 		}
 	}
-	return req.RemoteAddr
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr // No port in address
+	}
+	return ip
 }
 
 // RandomID generates a randomID of base64 characters of desired byte length
@@ -132,3 +132,41 @@ func TestRandomID(t *testing.T) {
 		t.Fatalf("unexpected hash string length: %d", l)
 	}
 }
+
+func TestBanMatches(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, ban, ip string
+		matches       bool
+	}{
+		{"same IP", "207.178.71.93", "207.178.71.93", true},
+		{"with port", "207.178.71.93", "207.178.71.93:5678", true},
+		{"different IP", "207.178.71.93", "207.178.71.94", false},
+		{"in range", "207.178.71.0/24", "207.178.71.93", true},
+		{"out of range", "207.178.71.0/24", "207.178.72.93", false},
+		{"IPv6 range", "2001:db8::/32", "[2001:db8::1]:80", true},
+		{"invalid IP", "207.178.71.93", "notip", false},
+		{"invalid range", "207.178.71.0/99", "207.178.71.93", false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if m := (Ban{IP: c.ban}).Matches(c.ip); m != c.matches {
+				LogUnexpected(t, c.matches, m)
+			}
+		})
+	}
+}
+
+func TestGetIPStripsPort(t *testing.T) {
+	IsReverseProxied = false
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "[::1]:8000"
+	if ip := GetIP(req); ip != "::1" {
+		LogUnexpected(t, "::1", ip)
+	}
+}
@@ -0,0 +1,77 @@
+// Board staff positions and their permissions
+
+package auth
+
+import "github.com/bakape/meguca/config"
+
+// Permission is a moderation action, that can be performed on a board by its
+// staff
+type Permission uint8
+
+// All permissions board staff can be granted
+const (
+	DeletePost Permission = iota
+	BanPoster
+	LockThread
+	StickyThread
+	ConfigureBoard
+)
+
+// Positions maps board staff positions to the permissions granted by them.
+// These are the only valid keys of config.BoardConfigs.Staff.
+var Positions = map[string][]Permission{
+	"owners": {
+		DeletePost, BanPoster, LockThread, StickyThread, ConfigureBoard,
+	},
+	"moderators": {DeletePost, BanPoster, LockThread, StickyThread},
+	"janitors":   {DeletePost},
+}
+
+// IsPosition returns, if the string is a valid board staff position
+func IsPosition(position string) bool {
+	_, ok := Positions[position]
+	return ok
+}
+
+// CanPerform returns, if the user holds a staff position on the board, that
+// grants the specified permission
+func CanPerform(userID, board string, perm Permission) bool {
+	if userID == "" {
+		return false
+	}
+	for position, staff := range config.GetBoardConfigs(board).Staff {
+		if !hasPermission(position, perm) {
+			continue
+		}
+		for _, id := range staff {
+			if id == userID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsStaff returns, if the user holds any staff position on the board
+func IsStaff(userID, board string) bool {
+	if userID == "" {
+		return false
+	}
+	for _, staff := range config.GetBoardConfigs(board).Staff {
+		for _, id := range staff {
+			if id == userID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasPermission(position string, perm Permission) bool {
+	for _, p := range Positions[position] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/bakape/meguca/config"
+	. "github.com/bakape/meguca/test"
+)
+
+func TestCanPerform(t *testing.T) {
+	config.ClearBoards()
+	_, err := config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		Staff: map[string][]string{
+			"owners":     {"owner"},
+			"moderators": {"mod"},
+			"janitors":   {"janitor"},
+			"invalid":    {"nobody"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := [...]struct {
+		name, user, board string
+		perm              Permission
+		can               bool
+	}{
+		{"owner configures", "owner", "a", ConfigureBoard, true},
+		{"moderator bans", "mod", "a", BanPoster, true},
+		{"moderator configures", "mod", "a", ConfigureBoard, false},
+		{"janitor deletes", "janitor", "a", DeletePost, true},
+		{"janitor locks", "janitor", "a", LockThread, false},
+		{"invalid position", "nobody", "a", DeletePost, false},
+		{"not staff", "user", "a", DeletePost, false},
+		{"no user", "", "a", DeletePost, false},
+		{"other board", "owner", "c", DeletePost, false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if can := CanPerform(c.user, c.board, c.perm); can != c.can {
+				LogUnexpected(t, c.can, can)
+			}
+		})
+	}
+}
+
+func TestIsPosition(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range [...]string{"owners", "moderators", "janitors"} {
+		if !IsPosition(p) {
+			t.Errorf("invalid position: %s", p)
+		}
+	}
+	if IsPosition("admins") {
+		t.Error("nonexistent position valid")
+	}
+}
+
+func TestIsStaff(t *testing.T) {
+	config.ClearBoards()
+	_, err := config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		Staff: map[string][]string{
+			"janitors": {"janitor"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsStaff("janitor", "a") {
+		t.Error("staff member not detected")
+	}
+	if IsStaff("user", "a") {
+		t.Error("non-staff user detected as staff")
+	}
+}
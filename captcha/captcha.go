@@ -0,0 +1,153 @@
+// Package captcha generates image captcha challenges, that can be solved and
+// verified without relying on any third party service.
+package captcha
+
+import (
+	"bytes"
+	"crypto/rand"
+	"image"
+	"image/color"
+	"image/png"
+	"math/big"
+	mrand "math/rand"
+	"time"
+)
+
+const (
+	// Length of the captcha solution in digits
+	solutionLength = 6
+
+	// Dimensions of the rendered image
+	width  = 180
+	height = 60
+
+	// Size of a single glyph pixel in image pixels
+	scale = 4
+
+	// Dimensions of a glyph in glyph pixels
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// Expiry is the time after which an unsolved captcha becomes invalid
+const Expiry = time.Minute * 10
+
+// 5x7 bitmap font of the decimal digits
+var glyphs = [10][glyphHeight]string{
+	{"01110", "10001", "10011", "10101", "11001", "10001", "01110"},
+	{"00100", "01100", "00100", "00100", "00100", "00100", "01110"},
+	{"01110", "10001", "00001", "00010", "00100", "01000", "11111"},
+	{"11111", "00010", "00100", "00010", "00001", "10001", "01110"},
+	{"00010", "00110", "01010", "10010", "11111", "00010", "00010"},
+	{"11111", "10000", "11110", "00001", "00001", "10001", "01110"},
+	{"00110", "01000", "10000", "11110", "10001", "10001", "01110"},
+	{"11111", "00001", "00010", "00100", "01000", "01000", "01000"},
+	{"01110", "10001", "10001", "01110", "10001", "10001", "01110"},
+	{"01110", "10001", "10001", "01111", "00001", "00010", "01100"},
+}
+
+// New generates a new random captcha solution and renders it as a PNG image
+func New() (solution string, img []byte, err error) {
+	solution, err = randomSolution()
+	if err != nil {
+		return
+	}
+	img, err = Render(solution)
+	return
+}
+
+// Generate a cryptographically secure random string of digits
+func randomSolution() (string, error) {
+	buf := make([]byte, solutionLength)
+	max := big.NewInt(10)
+	for i := range buf {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		buf[i] = '0' + byte(n.Int64())
+	}
+	return string(buf), nil
+}
+
+// Render draws the solution onto a noisy background with randomly displaced
+// and sheared glyphs and encodes it as PNG. Only decimal digits are rendered.
+func Render(solution string) ([]byte, error) {
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+	fillBackground(rgba)
+
+	step := width / (len(solution) + 1)
+	for i, r := range solution {
+		if r < '0' || r > '9' {
+			continue
+		}
+		x := step/2 + i*step + mrand.Intn(7) - 3
+		y := (height-glyphHeight*scale)/2 + mrand.Intn(11) - 5
+		drawGlyph(rgba, glyphs[r-'0'], x, y)
+	}
+
+	for i := 0; i < 4; i++ {
+		drawLine(rgba)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, rgba); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Fill the image with light noise
+func fillBackground(img *image.RGBA) {
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{
+				R: 200 + uint8(mrand.Intn(56)),
+				G: 200 + uint8(mrand.Intn(56)),
+				B: 200 + uint8(mrand.Intn(56)),
+				A: 255,
+			})
+		}
+	}
+}
+
+// Draw a glyph in a random dark color with a random horizontal shear
+func drawGlyph(img *image.RGBA, glyph [glyphHeight]string, x, y int) {
+	c := randomDarkColor()
+	shear := mrand.Float64() - 0.5
+	for row, line := range glyph {
+		offset := int(float64(row*scale) * shear)
+		for col, bit := range line {
+			if bit != '1' {
+				continue
+			}
+			px := x + col*scale + offset
+			py := y + row*scale
+			for dx := 0; dx < scale; dx++ {
+				for dy := 0; dy < scale; dy++ {
+					img.Set(px+dx, py+dy, c)
+				}
+			}
+		}
+	}
+}
+
+// Draw a line across the entire image width at a random angle
+func drawLine(img *image.RGBA) {
+	c := randomDarkColor()
+	y := float64(mrand.Intn(height))
+	slope := (mrand.Float64() - 0.5) * float64(height) / float64(width)
+	for x := 0; x < width; x++ {
+		img.Set(x, int(y), c)
+		y += slope
+	}
+}
+
+func randomDarkColor() color.RGBA {
+	return color.RGBA{
+		R: uint8(mrand.Intn(120)),
+		G: uint8(mrand.Intn(120)),
+		B: uint8(mrand.Intn(120)),
+		A: 255,
+	}
+}
@@ -0,0 +1,51 @@
+package captcha
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	. "github.com/bakape/meguca/test"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	solution, buf, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(solution); l != solutionLength {
+		LogUnexpected(t, solutionLength, l)
+	}
+	for _, r := range solution {
+		if r < '0' || r > '9' {
+			t.Fatalf("non-digit in solution: %s", solution)
+		}
+	}
+
+	img, err := png.Decode(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != width || b.Dy() != height {
+		t.Errorf("unexpected image dimensions: %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestRandomSolutions(t *testing.T) {
+	t.Parallel()
+
+	a, err := randomSolution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := randomSolution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("identical solutions: %s", a)
+	}
+}
@@ -0,0 +1,169 @@
+// Decoding of the compact binary websocket message encoding. Message payloads
+// are encoded with MessagePack.
+
+const decoder = new TextDecoder()
+
+// Decode a MessagePack payload. Empty payloads decode to null.
+export default function decodeBinary(buf: Uint8Array): any {
+	if (!buf.length) {
+		return null
+	}
+	return new Reader(buf).read()
+}
+
+// Sequential reader of MessagePack values from a buffer
+class Reader {
+	private pos = 0
+	private view: DataView
+
+	constructor(private buf: Uint8Array) {
+		this.view = new DataView(buf.buffer, buf.byteOffset, buf.byteLength)
+	}
+
+	// Read the next value from the buffer
+	read(): any {
+		const b = this.uint(1)
+
+		// Types with the value or length embedded in the type byte
+		if (b <= 0x7f) { // Positive fixint
+			return b
+		}
+		if (b >= 0xe0) { // Negative fixint
+			return b - 0x100
+		}
+		if (b >= 0xa0 && b <= 0xbf) {
+			return this.str(b & 0x1f)
+		}
+		if (b >= 0x90 && b <= 0x9f) {
+			return this.array(b & 0x0f)
+		}
+		if (b >= 0x80 && b <= 0x8f) {
+			return this.map(b & 0x0f)
+		}
+
+		switch (b) {
+			case 0xc0:
+				return null
+			case 0xc2:
+				return false
+			case 0xc3:
+				return true
+			case 0xc4:
+				return this.bytes(this.uint(1))
+			case 0xc5:
+				return this.bytes(this.uint(2))
+			case 0xc6:
+				return this.bytes(this.uint(4))
+			case 0xca:
+				return this.float(4)
+			case 0xcb:
+				return this.float(8)
+			case 0xcc:
+				return this.uint(1)
+			case 0xcd:
+				return this.uint(2)
+			case 0xce:
+				return this.uint(4)
+			case 0xcf:
+				return this.uint(8)
+			case 0xd0:
+				return this.int(1)
+			case 0xd1:
+				return this.int(2)
+			case 0xd2:
+				return this.int(4)
+			case 0xd3:
+				return this.int(8)
+			case 0xd9:
+				return this.str(this.uint(1))
+			case 0xda:
+				return this.str(this.uint(2))
+			case 0xdb:
+				return this.str(this.uint(4))
+			case 0xdc:
+				return this.array(this.uint(2))
+			case 0xdd:
+				return this.array(this.uint(4))
+			case 0xde:
+				return this.map(this.uint(2))
+			case 0xdf:
+				return this.map(this.uint(4))
+			default:
+				throw new Error(`invalid MessagePack type: ${b}`)
+		}
+	}
+
+	// Read a big endian unsigned integer of n bytes. 64 bit integers lose
+	// precision above 2^53.
+	uint(n: number): number {
+		const {view, pos} = this
+		this.pos += n
+		switch (n) {
+			case 1:
+				return view.getUint8(pos)
+			case 2:
+				return view.getUint16(pos)
+			case 4:
+				return view.getUint32(pos)
+			default:
+				return view.getUint32(pos) * 0x100000000
+					+ view.getUint32(pos + 4)
+		}
+	}
+
+	// Read a big endian signed integer of n bytes
+	int(n: number): number {
+		const {view, pos} = this
+		this.pos += n
+		switch (n) {
+			case 1:
+				return view.getInt8(pos)
+			case 2:
+				return view.getInt16(pos)
+			case 4:
+				return view.getInt32(pos)
+			default:
+				return view.getInt32(pos) * 0x100000000
+					+ view.getUint32(pos + 4)
+		}
+	}
+
+	// Read a big endian float of n bytes
+	float(n: number): number {
+		const {pos} = this
+		this.pos += n
+		if (n === 4) {
+			return this.view.getFloat32(pos)
+		}
+		return this.view.getFloat64(pos)
+	}
+
+	// Read a byte array of length l without copying
+	bytes(l: number): Uint8Array {
+		const b = this.buf.subarray(this.pos, this.pos + l)
+		this.pos += l
+		return b
+	}
+
+	// Read an UTF-8 string of l bytes
+	str(l: number): string {
+		return decoder.decode(this.bytes(l))
+	}
+
+	array(l: number): any[] {
+		const arr = new Array(l)
+		for (let i = 0; i < l; i++) {
+			arr[i] = this.read()
+		}
+		return arr
+	}
+
+	map(l: number): { [key: string]: any } {
+		const m: { [key: string]: any } = {}
+		for (let i = 0; i < l; i++) {
+			const key = this.read()
+			m[key] = this.read()
+		}
+		return m
+	}
+}
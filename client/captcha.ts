@@ -2,6 +2,7 @@ import View from './view'
 import Model from './model'
 import {write} from './render'
 import {config} from './state'
+import {fetchJSON} from './json'
 
 // Solve Media AJAX API controller
 // https://portal.solvemedia.com/portal/help/pub/ajax
@@ -31,13 +32,21 @@ export interface Captcha {
 	captchaID: string
 }
 
+// Captcha challenge generated by the server itself
+interface LocalChallenge {
+	id: string
+	image: string // Base64-encoded PNG
+}
+
 // For generating unique IDs for every captcha
 let captchaCounter = 0
 
-// Wrapper around Solve Media's captcha service AJAX API
+// Wrapper around Solve Media's captcha service AJAX API or the server's own
+// captcha generator, depending on configuration
 export default class CaptchaView extends View<Model> {
 	widget: ACPuzzleController
 	id: string
+	challengeID: string // ID of the current local captcha challenge
 
 	constructor(el: HTMLElement) {
 		super({el})
@@ -73,6 +82,12 @@ export default class CaptchaView extends View<Model> {
 
 	// Render the actual captcha
 	renderWidget() {
+		if (config.localCaptcha) {
+			if (!this.challengeID) {
+				this.fetchChallenge()
+			}
+			return
+		}
 		this.widget = ACPuzzle.create(config.captchaPublicKey, this.id, {
 			id: this.id,
 			multi: true,
@@ -80,9 +95,26 @@ export default class CaptchaView extends View<Model> {
 		})
 	}
 
+	// Fetch and render a new locally generated captcha challenge
+	async fetchChallenge() {
+		const {id, image} = await fetchJSON<LocalChallenge>("/captcha"),
+			img = document.createElement("img")
+		img.src = "data:image/png;base64," + image
+		this.challengeID = id
+		write(() => {
+			const el = this.el.querySelector(".captcha-image")
+			el.innerHTML = ""
+			el.appendChild(img)
+		})
+	}
+
 	// Load a new captcha
 	reload() {
-		this.widget.reload()
+		if (config.localCaptcha) {
+			this.fetchChallenge()
+		} else {
+			this.widget.reload()
+		}
 	}
 
 	remove() {
@@ -95,6 +127,14 @@ export default class CaptchaView extends View<Model> {
 
 	// Returns the data from the captcha widget
 	data(): Captcha {
+		if (config.localCaptcha) {
+			const input = this.el
+				.querySelector("input[name=adcopy_response]") as HTMLInputElement
+			return {
+				captcha: input.value,
+				captchaID: this.challengeID,
+			}
+		}
 		return {
 			captcha: this.widget.get_response(),
 			captchaID: this.widget.get_challenge(),
@@ -1,14 +1,17 @@
 // Core websocket message handlers
 
 import { handlers, message, connSM, connEvent } from './connection'
-import { posts } from './state'
-import { Post, PostLinks, Command, PostData, ImageData } from './posts/models'
+import { posts, page } from './state'
+import {
+	Post, OP, PostLinks, Command, PostData, ImageData, PollData,
+} from './posts/models'
 import { ReplyFormModel, OPFormModel } from "./posts/posting/model"
 import PostView from "./posts/view"
 import { threadContainer } from "./page/thread"
 import { write } from "./render"
 import { postAdded } from "./tab"
 import { deferInit } from "./defer"
+import navigate, { alertError } from "./history"
 
 // Message for splicing the contents of the current line
 export type SpliceResponse = {
@@ -23,6 +26,7 @@ export type SpliceResponse = {
 type LinkMessage = {
 	id: number
 	links: PostLinks
+	boardLinks?: string[]
 }
 
 // Message to inject a new command result into a model
@@ -30,11 +34,28 @@ interface CommandMessage extends Command {
 	id: number
 }
 
+// Message to increment the tally of a poll option
+type VoteMessage = {
+	id: number
+	option: number
+}
+
+// Message to set the options of a poll
+interface PollMessage extends PollData {
+	id: number
+}
+
 // Message for inserting images into an open post
 interface ImageMessage extends ImageData {
 	id: number
 }
 
+// Message setting or unsetting a boolean flag of a thread
+type ThreadFlagMessage = {
+	id: number
+	val: boolean
+}
+
 // Run a function on a model, if it exists
 function handle(id: number, fn: (m: Post) => void) {
 	const model = posts.get(id)
@@ -43,6 +64,15 @@ function handle(id: number, fn: (m: Post) => void) {
 	}
 }
 
+// Run a function on the model of a thread's opening post, if it exists
+function handleOP(id: number, fn: (m: OP) => void) {
+	handle(id, m => {
+		if (m instanceof OP) {
+			fn(m)
+		}
+	})
+}
+
 // Insert a post into the models and DOM. The passed post may already exist and
 // be rendered, in which case it is a possibly updated version, that syncs the
 // client's state to the update stream. In that case the client must rerender
@@ -117,9 +147,9 @@ deferInit(() => {
 		handle(msg.id, m =>
 			m.splice(msg))
 
-	handlers[message.link] = ({id, links}: LinkMessage) =>
+	handlers[message.link] = ({id, links, boardLinks}: LinkMessage) =>
 		handle(id, m =>
-			m.insertLink(links))
+			m.insertLink(links, boardLinks))
 
 	handlers[message.backlink] = ({id, links}: LinkMessage) =>
 		handle(id, m =>
@@ -131,7 +161,40 @@ deferInit(() => {
 			m.insertCommand(msg)
 		})
 
+	handlers[message.vote] = ({id, option}: VoteMessage) =>
+		handle(id, m =>
+			m.vote(option))
+
+	handlers[message.poll] = (msg: PollMessage) =>
+		handle(msg.id, m => {
+			delete msg.id
+			m.setPoll(msg)
+		})
+
 	handlers[message.closePost] = (id: number) =>
 		handle(id, m =>
 			m.closePost())
+
+	// Deleting the opening post deletes the entire thread, so return to the
+	// board page
+	handlers[message.deletePost] = (id: number) => {
+		if (id === page.thread) {
+			navigate(`/${page.board}/`, null, true).catch(alertError)
+			return
+		}
+		handle(id, m =>
+			m.remove())
+	}
+
+	handlers[message.lock] = ({id, val}: ThreadFlagMessage) =>
+		handleOP(id, m =>
+			m.setLocked(val))
+
+	handlers[message.sticky] = ({id, val}: ThreadFlagMessage) =>
+		handleOP(id, m =>
+			m.setSticky(val))
+
+	handlers[message.archive] = ({id, val}: ThreadFlagMessage) =>
+		handleOP(id, m =>
+			m.setArchived(val))
 })
@@ -7,6 +7,7 @@ import { write } from './render'
 import { authenticate } from './mod/login'
 import { PostData } from "./posts/models"
 import { insertPost } from "./client"
+import decodeBinary from "./binary"
 import { fetchThread } from "./json"
 import identity from "./posts/posting/identity"
 import { postSM, postEvent, postState, postModel } from "./posts/posting/main"
@@ -27,6 +28,12 @@ export const enum message {
 	command,
 	insertImage,
 	spoiler,
+	deletePost,
+	lock,
+	sticky,
+	archive,
+	vote,
+	poll,
 
 	// >= 30 are miscellaneous and do not write to post models
 	synchronise = 30,
@@ -54,6 +61,13 @@ export const enum message {
 	// Invokes no operation on the server. Used to test the client's connection
 	// in situations, when you can't be certain the client is still connected.
 	NOOP,
+
+	// Board page update feed
+	boardThread = 47,
+	boardThreadDeleted,
+
+	// Refetch the thread, because missed updates can not be replayed
+	resync,
 }
 
 export type MessageHandler = (msg: {}) => void
@@ -81,9 +95,9 @@ export const connSM = new FSM<connState, connEvent>(connState.loading)
 let socket: WebSocket,
 	attempts: number,
 	attemptTimer: number,
-	// Timestamp of the last post altering message received or the the initial
-	// fetch of thread contents
-	syncTimestamp: number
+	// Unix timestamp in seconds of the last post altering message received or
+	// the initial fetch of thread contents
+	lastUpdated = 0
 
 const syncEl = document.getElementById('sync')
 const path =
@@ -97,11 +111,17 @@ function connect() {
 		return
 	}
 	socket = new WebSocket(path)
+	socket.binaryType = "arraybuffer"
 	socket.onopen = connSM.feeder(connEvent.open)
 	socket.onclose = connSM.feeder(connEvent.close)
 	socket.onerror = connSM.feeder(connEvent.close)
-	socket.onmessage = ({data}) =>
-		onMessage(data, false)
+	socket.onmessage = ({data}) => {
+		if (data instanceof ArrayBuffer) {
+			onBinaryMessage(new Uint8Array(data), false)
+		} else {
+			onMessage(data, false)
+		}
+	}
 	if (debug) {
 		(window as any).socket = socket
 	}
@@ -171,6 +191,35 @@ function onMessage(data: string, extracted: boolean) {
 		return
 	}
 
+	dispatch(type, () =>
+		JSON.parse(data.slice(2)))
+}
+
+// Routes binary-encoded messages from the server to the respective handler
+function onBinaryMessage(data: Uint8Array, extracted: boolean) {
+	// First byte of a message defines its type
+	const type = data[0] as message,
+		payload = data.subarray(1)
+
+	if (debug) {
+		console.log(extracted ? ">>" : ">", type, decodeBinary(payload))
+	}
+
+	// Concatenated messages are an array of complete binary messages
+	if (type === message.concat) {
+		for (let msg of decodeBinary(payload) as Uint8Array[]) {
+			onBinaryMessage(msg, true)
+		}
+		return
+	}
+
+	dispatch(type, () =>
+		decodeBinary(payload))
+}
+
+// Pass a message to its handler, if any. The payload is only decoded, if there
+// is a handler.
+function dispatch(type: message, decode: () => any) {
 	// Message types bellow thirty alter the thread state
 	if (type < 30) {
 		updateSyncTimestamp()
@@ -178,13 +227,13 @@ function onMessage(data: string, extracted: boolean) {
 
 	const handler = handlers[type]
 	if (handler) {
-		handler(JSON.parse(data.slice(2)))
+		handler(decode())
 	}
 }
 
-// Update the thread synchronization timestamp
-export function updateSyncTimestamp() {
-	syncTimestamp = Date.now()
+// Update the thread synchronization timestamp. Defaults to the current time.
+export function updateSyncTimestamp(time = Math.floor(Date.now() / 1000)) {
+	lastUpdated = time
 }
 
 function prepareToSync(): connState {
@@ -196,23 +245,15 @@ function prepareToSync(): connState {
 
 // Send a requests to the server to synchronise to the current page and
 // subscribe to the appropriate event feeds and optionally try to send a logged
-// in user session authentication request.
+// in user session authentication request. Any updates missed because of
+// disconnect, computer suspension or resuming old tabs are replayed by the
+// server since the last seen update.
 export async function synchronise(auth: boolean) {
-	// If thread data is too old because of disconnect, computer suspension or
-	// resuming old tabs, refetch and sync differences. The actual deadline
-	// is 30 seconds, but a ten second buffer is probably sound.
-	if (page.thread && Date.now() - syncTimestamp > 20000) {
-		const {board, thread} = page,
-			// Always fetch the full thread
-			data = await fetchThread(board, thread, 0)
-		insertPost(data)
-		data.posts.forEach(insertPost)
-		delete data.posts
-	}
-
 	send(message.synchronise, {
 		board: page.board,
 		thread: page.thread,
+		lastUpdated: page.thread ? lastUpdated : 0,
+		binary: true,
 	})
 	if (auth) {
 		authenticate()
@@ -221,15 +262,21 @@ export async function synchronise(auth: boolean) {
 	// Reclaim a post lost after disconnecting, going on standby, resuming
 	// browser tab, etc.
 	if (page.thread && postSM.state === postState.halted) {
-		// No older than 28 minutes
-		if (postModel.time > (Date.now() / 1000 - 28 * 60)) {
-			send(message.reclaim, {
-				id: postModel.id,
-				password: identity.postPassword,
-			})
-		} else {
-			postSM.feed(postEvent.abandon)
-		}
+		requestReclaim()
+	}
+}
+
+// Request to reclaim the halted open post, if it is not too old to be
+// reclaimed
+function requestReclaim() {
+	// No older than 28 minutes
+	if (postModel.time > (Date.now() / 1000 - 28 * 60)) {
+		send(message.reclaim, {
+			id: postModel.id,
+			password: identity.postPassword,
+		})
+	} else {
+		postSM.feed(postEvent.abandon)
 	}
 }
 
@@ -295,6 +342,24 @@ handlers[message.synchronise] = (backlog: { [id: number]: PostData }) => {
 	connSM.feed(connEvent.sync)
 }
 
+// The missed updates are too old or too many to be replayed. Refetch the full
+// thread and sync differences.
+handlers[message.resync] = () =>
+	resync().catch(connSM.feeder(connEvent.close))
+
+async function resync() {
+	if (!page.thread) {
+		return
+	}
+	const {board, thread} = page,
+		// Always fetch the full thread
+		data = await fetchThread(board, thread, 0)
+	updateSyncTimestamp(data.lastUpdated)
+	insertPost(data)
+	data.posts.forEach(insertPost)
+	delete data.posts
+}
+
 // Handle response to a open post reclaim request
 handlers[message.reclaim] = (code: number) => {
 	switch (code) {
@@ -304,6 +369,17 @@ handlers[message.reclaim] = (code: number) => {
 		case 1:
 			postSM.feed(postEvent.abandon)
 			break
+		case 2:
+			// Post still leased to a previous connection. Retry after the
+			// lease expires.
+			setTimeout(() => {
+				if (postSM.state === postState.halted
+					&& connSM.state === connState.synced
+				) {
+					requestReclaim()
+				}
+			}, 10000)
+			break
 	}
 }
 
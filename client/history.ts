@@ -83,7 +83,8 @@ export default async function navigate(
 	displayLoading(false)
 }
 
-function alertError(err: Error) {
+// Alert the user of a page navigation error
+export function alertError(err: Error) {
 	displayLoading(false)
 	alert(err)
 	throw err
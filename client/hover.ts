@@ -214,7 +214,7 @@ async function renderPostPreview(event: MouseEvent) {
 	if (!target.matches || !target.matches("a.history")) {
 		return
 	}
-	const m = target.textContent.match(/^>{2,}(\d+)/)
+	const m = target.textContent.match(/^>{2,}(?:\/\w+\/)?(\d+)/)
 	if (!m) {
 		return
 	}
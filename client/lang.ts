@@ -55,6 +55,7 @@ type LnPosts = {
 	quoted: string
 	board: string
 	spoiler: string
+	sage: string
 	and: string
 	omitted: string
 	unfinishedPost: string
@@ -14,6 +14,7 @@ import bindShortcuts from "./keyboard"
 import { loadModule } from "./util"
 import { checkBottom, scrollToAnchor } from "./scroll"
 import bindMenu from "./posts/menu"
+import bindPosterIDs from "./posts/posterIDs"
 
 // Load all stateful modules in dependency order
 async function start() {
@@ -34,6 +35,7 @@ async function start() {
 	bindOptionsListeners()
 	bindShortcuts()
 	bindMenu()
+	bindPosterIDs()
 	await pageLoader
 	scrollToAnchor()
 	checkBottom()
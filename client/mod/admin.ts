@@ -7,6 +7,7 @@ import { langs, themes } from '../options/specs'
 
 type ServerConfigs = {
 	pruneThreads: boolean
+	archiveThreads: boolean
 	pruneBoards: boolean
 	radio: boolean
 	hats: boolean
@@ -19,7 +20,12 @@ type ServerConfigs = {
 	maxSize: number
     sessionExpiry: number
     threadExpiry: number
+	archiveExpiry: number
 	boardExpiry: number
+	threadsPerHour: number
+	postsPerMinute: number
+	messagesPerSecond: number
+	captchasPerMinute: number
 	origin: string
 	salt: string
 	excludeRegex: string
@@ -46,6 +52,15 @@ const specs: InputSpec[] = [
 		type: inputType.number,
 		min: 1,
 	},
+	{
+		name: "archiveThreads",
+		type: inputType.boolean,
+	},
+	{
+		name: "archiveExpiry",
+		type: inputType.number,
+		min: 1,
+	},
 	{
 		name: "pruneBoards",
 		type: inputType.boolean,
@@ -63,6 +78,10 @@ const specs: InputSpec[] = [
 		name: "captcha",
 		type: inputType.boolean,
 	},
+	{
+		name: "localCaptcha",
+		type: inputType.boolean,
+	},
 	{
 		name: "captchaPublicKey",
 		type: inputType.string,
@@ -76,6 +95,26 @@ const specs: InputSpec[] = [
 		type: inputType.number,
 		min: 1,
 	},
+	{
+		name: "threadsPerHour",
+		type: inputType.number,
+		min: 0,
+	},
+	{
+		name: "postsPerMinute",
+		type: inputType.number,
+		min: 0,
+	},
+	{
+		name: "messagesPerSecond",
+		type: inputType.number,
+		min: 0,
+	},
+	{
+		name: "captchasPerMinute",
+		type: inputType.number,
+		min: 0,
+	},
 	{
 		name: "feedbackEmail",
 		type: inputType.string,
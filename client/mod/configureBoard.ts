@@ -33,10 +33,41 @@ const specs: InputSpec[] = [
 		name: "forcedAnon",
 		type: inputType.boolean,
 	},
+	{
+		name: "posterIDs",
+		type: inputType.boolean,
+	},
 	{
 		name: "hashCommands",
 		type: inputType.boolean,
 	},
+	{
+		name: "maxDice",
+		type: inputType.number,
+		min: 0,
+		max: 100,
+	},
+	{
+		name: "maxDieSides",
+		type: inputType.number,
+		min: 0,
+		max: 10000,
+	},
+	{
+		name: "bumpLimit",
+		type: inputType.number,
+		min: 0,
+	},
+	{
+		name: "imageLimit",
+		type: inputType.number,
+		min: 0,
+	},
+	{
+		name: "maxThreads",
+		type: inputType.number,
+		min: 0,
+	},
 	{
 		name: "spoilers",
 		type: inputType.boolean,
@@ -9,6 +9,7 @@ import { setTitle } from "../tab"
 import { formatText, renderNotice } from "./common"
 import { renderTime } from "../posts/render/posts"
 import { fetchBoard } from "../json"
+import { handlers, message } from "../connection"
 
 type SortFunction = (a: ThreadData, b: ThreadData) => number
 
@@ -177,10 +178,7 @@ function toggleRules(e: MouseEvent) {
 // Persist thread sort order mode to localStorage and rerender threads
 function onSortChange(e: Event) {
 	localStorage.setItem("catalogSort", (e.target as HTMLInputElement).value)
-	const filter =
-		(threads.querySelector("input[name=search]") as HTMLInputElement)
-			.value
-	writeThreads(renderThreads(filter, data))
+	rerenderThreads()
 }
 
 function writeThreads(formated: DocumentFragment) {
@@ -201,6 +199,42 @@ async function refreshBoard() {
 	cachetAndRender(threads, ctr)
 }
 
+// Rerender threads with the current search filter applied
+function rerenderThreads() {
+	const filter =
+		(threads.querySelector("input[name=search]") as HTMLInputElement)
+			.value
+	writeThreads(renderThreads(filter, data))
+}
+
+// Insert or replace a thread received from the board page update feed
+handlers[message.boardThread] = (thread: ThreadData) => {
+	if (page.thread || !data) {
+		return
+	}
+	const i = data.findIndex(t =>
+		t.id === thread.id)
+	if (i === -1) {
+		data.push(thread)
+	} else {
+		data[i] = thread
+	}
+	write(rerenderThreads)
+}
+
+// Remove a deleted thread received from the board page update feed
+handlers[message.boardThreadDeleted] = (id: number) => {
+	if (page.thread || !data) {
+		return
+	}
+	const i = data.findIndex(t =>
+		t.id === id)
+	if (i !== -1) {
+		data.splice(i, 1)
+		write(rerenderThreads)
+	}
+}
+
 // Update refresh timer or refresh board, if document hidden, each minute
 setInterval(() => {
 	if (page.thread) {
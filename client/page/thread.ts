@@ -15,7 +15,7 @@ export let threadContainer: HTMLElement
 
 // Render the HTML of a thread page
 export default function renderThread(thread: ThreadData) {
-	updateSyncTimestamp()
+	updateSyncTimestamp(thread.lastUpdated)
 	const frag = importTemplate("thread")
 
 	// Apply title to header and tab
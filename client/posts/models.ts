@@ -1,7 +1,7 @@
 import Model from '../model'
 import { extend } from '../util'
 import Collection from './collection'
-import PostView from './view'
+import PostView, { OPView } from './view'
 import { SpliceResponse } from '../client'
 import { mine, seenReplies, page } from "../state"
 import notifyAboutReply from "../notification"
@@ -27,10 +27,13 @@ export interface PostData {
 	name?: string
 	trip?: string
 	auth?: string
+	posterID?: string
 	email?: string
+	sage?: boolean
 	state: TextState
 	backlinks?: PostLinks
 	links?: PostLinks
+	boardLinks?: string[]
 	commands?: Command[]
 }
 
@@ -44,7 +47,10 @@ export type TextState = {
 }
 
 // Types of hash command entries
-export const enum commandType { dice, flip, eightBall, syncWatch, pyu, pcount }
+export const enum commandType {
+	dice, flip, eightBall, syncWatch, pyu, pcount, customAnswer, customCounter,
+	poll,
+}
 
 // Single hash command result delivered from the server
 export interface Command {
@@ -52,6 +58,25 @@ export interface Command {
 	val: any
 }
 
+// Result of a dice roll command
+export interface DiceRoll {
+	rolls: number[]
+	modifier?: number
+	total: number
+}
+
+// Name and result of a board-defined command
+export interface CustomCommandResult {
+	name: string
+	val: string | number
+}
+
+// Options and vote tallies of a poll
+export interface PollData {
+	options: string[]
+	votes: number[]
+}
+
 // Data of an OP post
 export interface ThreadData extends PostData {
 	locked?: boolean
@@ -61,6 +86,7 @@ export interface ThreadData extends PostData {
 	imageCtr: number
 	logCtr: number
 	replyTime: number
+	lastUpdated: number
 	subject: string
 	board: string
 	posts?: PostData[]
@@ -106,11 +132,13 @@ export class Post extends Model implements PostData {
 	name: string
 	trip: string
 	auth: string
+	posterID: string
 	email: string
 	state: TextState
 	backlinks: PostLinks
 	commands: Command[]
 	links: PostLinks
+	boardLinks: string[]
 
 	constructor(attrs: PostData) {
 		super()
@@ -220,10 +248,20 @@ export class Post extends Model implements PostData {
 			this.view.renderContents(this.view.el))
 	}
 
-	// Insert data about a link to another post into the model
-	insertLink(links: PostLinks) {
-		this.checkRepliedToMe(links)
-		this.extendField("links", links)
+	// Insert data about links to other posts and boards into the model
+	insertLink(links: PostLinks, boardLinks: string[] = []) {
+		if (links) {
+			this.checkRepliedToMe(links)
+			this.extendField("links", links)
+		}
+		for (let board of boardLinks) {
+			if (!this.boardLinks) {
+				this.boardLinks = []
+			}
+			if (!this.boardLinks.includes(board)) {
+				this.boardLinks.push(board)
+			}
+		}
 	}
 
 	// Check if this post replied to one of the user's posts and trigger
@@ -256,6 +294,40 @@ export class Post extends Model implements PostData {
 		}
 	}
 
+	// Find the poll command of the post, if any
+	findPoll(): PollData {
+		if (!this.commands) {
+			return null
+		}
+		for (let c of this.commands) {
+			if (c.type === commandType.poll) {
+				return c.val
+			}
+		}
+		return null
+	}
+
+	// Set the options of the post's poll, as each line with an option is
+	// committed
+	setPoll(poll: PollData) {
+		const existing = this.findPoll()
+		if (!existing) {
+			return
+		}
+		extend(existing, poll)
+		this.view.renderPoll(existing)
+	}
+
+	// Increment the tally of a poll option
+	vote(option: number) {
+		const poll = this.findPoll()
+		if (!poll || option >= poll.votes.length) {
+			return
+		}
+		poll.votes[option]++
+		this.view.renderPoll(poll)
+	}
+
 	// Insert an image into an existing post
 	insertImage(img: ImageData) {
 		this.image = img
@@ -287,6 +359,7 @@ export class Post extends Model implements PostData {
 
 // Model of the opening post of a thread
 export class OP extends Post implements ThreadData {
+	view: OPView
 	locked: boolean
 	archived: boolean
 	sticky: boolean
@@ -300,4 +373,21 @@ export class OP extends Post implements ThreadData {
 	constructor(data: ThreadData) {
 		super(data)
 	}
+
+	// Lock or unlock the thread, preventing any new replies
+	setLocked(locked: boolean) {
+		this.locked = locked
+		this.view.renderLocked()
+	}
+
+	// Archive or unarchive the thread. Archived threads are read-only.
+	setArchived(archived: boolean) {
+		this.archived = archived
+		this.view.renderLocked()
+	}
+
+	// Set or unset the thread as sticky
+	setSticky(sticky: boolean) {
+		this.sticky = sticky
+	}
 }
@@ -0,0 +1,39 @@
+// #poll command rendering and voting
+
+import { PollData } from "./models"
+import { escape, on, getClosestID } from "../util"
+import { send, message } from "../connection"
+import { threads } from "../render"
+import { deferInit } from "../defer"
+
+// Render a poll with the tallies of its options
+export function renderPoll({options, votes}: PollData): string {
+    let html = `<strong class="poll">#poll`
+    if (options.length) {
+        html += " ("
+        for (let i = 0; i < options.length; i++) {
+            if (i) {
+                html += ", "
+            }
+            html += `<a class="poll-option" data-option="${i}">`
+                + `${escape(options[i])}: ${votes[i]}</a>`
+        }
+        html += ")"
+    }
+    return html + "</strong>"
+}
+
+// Vote for the clicked poll option
+function vote(e: Event) {
+    const el = e.target as Element
+    send(message.vote, {
+        id: getClosestID(el),
+        option: parseInt(el.getAttribute("data-option")),
+    })
+}
+
+deferInit(() =>
+    on(threads, "click", vote, {
+        passive: true,
+        selector: ".poll-option",
+    }))
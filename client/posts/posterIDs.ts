@@ -0,0 +1,64 @@
+// Per-thread poster ID click-through for board staff
+
+import { on } from "../util"
+import { threads, write } from "../render"
+import { loginID } from "../mod/login"
+import { page } from "../state"
+import { fetchJSON } from "../json"
+
+// Board staff positions, that can click-through poster IDs
+const positions = ["owners", "moderators", "janitors"]
+
+// Boards the logged in user holds any staff position on and the user they
+// were fetched for
+let staffBoards: Promise<string[]>,
+	staffBoardsUser: string
+
+// Returns, if the logged in user holds a staff position on the current board
+async function isStaff(): Promise<boolean> {
+	if (!loginID) {
+		return false
+	}
+	if (staffBoardsUser !== loginID) {
+		staffBoardsUser = loginID
+		staffBoards = Promise.all(positions.map(p =>
+			fetchJSON<string[]>(`/json/positions/${p}/${loginID}`)))
+			.then(res =>
+				[].concat(...res))
+	}
+	try {
+		return (await staffBoards).includes(page.board)
+	} catch (err) {
+		staffBoardsUser = null
+		throw err
+	}
+}
+
+// Highlight all posts in the thread with the same poster ID as the clicked
+// one. Clicking again removes the highlight.
+async function highlightPosterID(e: Event) {
+	if (!await isStaff()) {
+		return
+	}
+	const id = (e.target as Element).getAttribute("data-id"),
+		els = threads.querySelectorAll(".poster-id"),
+		articles: Element[] = []
+	for (let i = 0; i < els.length; i++) {
+		if (els[i].getAttribute("data-id") === id) {
+			articles.push(els[i].closest("article"))
+		}
+	}
+	const highlight = !articles[0].classList.contains("poster-id-highlight")
+	write(() => {
+		for (let a of articles) {
+			a.classList.toggle("poster-id-highlight", highlight)
+		}
+	})
+}
+
+export default function bind() {
+	on(threads, "click", highlightPosterID, {
+		passive: true,
+		selector: ".poster-id",
+	})
+}
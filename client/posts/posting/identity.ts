@@ -11,6 +11,7 @@ interface Identity extends ChangeEmitter {
 	name: string
 	email: string
 	postPassword: string
+	sage: boolean
 	[index: string]: any
 }
 
@@ -45,8 +46,9 @@ if (!stored) {
 	localStorage.setItem("postPassword", stored)
 }
 identity.postPassword = stored
+identity.sage = localStorage.getItem("sage") === "true"
 
-// Name and email input panel
+// Name, email and sage input panel
 class IdentityPanel extends BannerModal {
 	constructor() {
 		super({ id: "identity" })
@@ -55,17 +57,19 @@ class IdentityPanel extends BannerModal {
 	}
 
 	render() {
-		const html = table(["name", "email", "postPassword"], name => {
-			const [label, tooltip] = lang[name]
-			return renderInput({
-				name,
-				label,
-				tooltip,
-				type: inputType.string,
-				value: identity[name],
-				maxLength: maxLengths[name],
+		const fields = ["name", "email", "postPassword", "sage"],
+			html = table(fields, name => {
+				const [label, tooltip] = lang[name],
+					isBool = name === "sage"
+				return renderInput({
+					name,
+					label,
+					tooltip,
+					type: isBool ? inputType.boolean : inputType.string,
+					value: identity[name],
+					maxLength: maxLengths[name],
+				})
 			})
-		})
 
 		this.lazyRender(html)
 	}
@@ -73,8 +77,8 @@ class IdentityPanel extends BannerModal {
 	onInput(event: Event) {
 		const el = event.target as HTMLInputElement,
 			name = el.getAttribute("name"),
-			val = el.value
-		localStorage.setItem(name, val)
+			val = el.type === "checkbox" ? el.checked : el.value
+		localStorage.setItem(name, val.toString())
 		identity[name] = val
 	}
 }
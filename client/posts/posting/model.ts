@@ -10,7 +10,7 @@ import { applyMixins, extend } from "../../util"
 import PostView from "../view"
 import { SpliceResponse } from "../../client"
 import { FileData } from "./upload"
-import { newAllocRequest, PostCredentials } from "./identity"
+import identity, { newAllocRequest, PostCredentials } from "./identity"
 import { write } from "../../render"
 
 // A message created while disconnected for later sending
@@ -19,6 +19,7 @@ type BufferedMessage = [message, any]
 interface PostCreationRequest extends PostCredentials {
 	image?: FileData
 	body?: string
+	sage?: boolean
 }
 
 // Form Model of an OP post
@@ -121,6 +122,9 @@ export class ReplyFormModel extends Post implements FormModel {
 		if (image) {
 			req.image = image
 		}
+		if (identity.sage) {
+			req.sage = true
+		}
 
 		send(message.insertPost, req)
 		handlers[message.postID] = (id: number) => {
@@ -7,6 +7,7 @@ import { postJSON, postText } from "../../json"
 import Model from "../../model"
 import identity from "./identity"
 import { Post } from "../models"
+import { page } from "../../state"
 
 // Uploaded file data to be embedded in thread and reply creation or appendage
 // requests
@@ -101,6 +102,7 @@ export default class UploadForm {
 	async upload(file: File): Promise<string> {
 		const formData = new FormData()
 		formData.append("image", file)
+		formData.append("board", this.uploadBoard())
 		write(() =>
 			this.uploadInput.style.display = "none")
 
@@ -123,6 +125,14 @@ export default class UploadForm {
 		return xhr.responseText
 	}
 
+	// Return the board the file is being uploaded to. On the "/all/" metaboard
+	// thread creation forms have a board selection input.
+	uploadBoard(): string {
+		const sel = this.el.querySelector("select[name=board]") as
+			HTMLSelectElement
+		return sel ? sel.value : page.board
+	}
+
 	// Render client-side upload progress
 	renderProgress({total, loaded}: ProgressEvent) {
 		let s: string
@@ -1,8 +1,13 @@
 import { config, boards, boardConfig } from '../../state'
 import { renderPostLink } from './etc'
-import { PostData, PostLinks, TextState } from '../models'
+import {
+    PostData, PostLinks, TextState, Command, DiceRoll, commandType,
+    CustomCommandResult,
+} from '../models'
 import { escape } from '../../util'
 import { parseEmbeds } from "../embed"
+import { renderSyncWatch } from "../syncwatch"
+import { renderPoll } from "../polls"
 
 // Render the text body of a post
 export function renderBody(data: PostData): string {
@@ -58,7 +63,8 @@ export function parseTerminatedLine(line: string, data: PostData): string {
     let html = initLine(line, state)
 
     if (line[0] == "#") {
-        const m = line.match(/^#(flip|\d*d\d+|8ball|pyu|pcount)$/)
+        const m = line.match(
+            /^#(flip|8ball|pyu|pcount|poll|\d{0,3}d\d{1,5}(?:k[hl]\d{1,3})?(?:[+-]\d{1,5})?|syncwatch(?:\d{1,2}:)?\d{1,2}:\d{1,2}(?: \+\d{1,4})?|[a-z][a-z0-9_]{0,19})$/)
         if (m) {
             return html
                 + parseCommand(m[1], data)
@@ -154,6 +160,13 @@ function parseFragment(frag: string, data: PostData): string {
                 continue
             }
 
+            // Cross-board post links
+            m = word.match(/^>>>(>*)\/(\w+)\/(\d+)$/)
+            if (m) {
+                html += parseCrossLink(m, data.links)
+                continue
+            }
+
             // Internal and custom reference URLs
             m = word.match(/^>>>(>*)\/(\w+)\/$/)
             if (m) {
@@ -197,6 +210,19 @@ function parsePostLink(m: string[], links: PostLinks): string {
     return m[1] + renderPostLink(id, verified.board, verified.op)
 }
 
+// Verify and render a link to a post on a specific board
+function parseCrossLink(m: string[], links: PostLinks): string {
+    if (!links) {
+        return m[0]
+    }
+    const id = parseInt(m[3]),
+        verified = links[id]
+    if (!verified || verified.board !== m[2]) {
+        return m[0]
+    }
+    return m[1] + renderPostLink(id, verified.board, verified.op)
+}
+
 // Parse internal or customly set reference URL
 function parseReference(m: string[]): string {
     let href: string
@@ -240,7 +266,23 @@ function parseCommand(bit: string, {commands, state}: PostData): string {
         return "#" + bit
     }
 
-    // TODO: Sycnwatch
+    if (bit.startsWith("syncwatch")) {
+        const com = commands[state.iDice]
+        if (com.type !== commandType.syncWatch) {
+            return "#" + bit
+        }
+        state.iDice++
+        return renderSyncWatch(bit, com.val as number[])
+    }
+
+    if (bit === "poll") {
+        const com = commands[state.iDice]
+        if (com.type !== commandType.poll) {
+            return "#" + bit
+        }
+        state.iDice++
+        return renderPoll(com.val)
+    }
 
     let inner: string
     switch (bit) {
@@ -251,26 +293,62 @@ function parseCommand(bit: string, {commands, state}: PostData): string {
             inner = commands[state.iDice++].val.toString()
             break
         default:
-            // Validate dice
-            const m = bit.match(/^(\d*)d(\d+)$/)
-            if (parseInt(m[1]) > 10 || parseInt(m[2]) > 100) {
-                return "#" + bit
-            }
-
-            const rolls = commands[state.iDice++].val as number[]
-            inner = ""
-            let sum = 0
-            for (let i = 0; i < rolls.length; i++) {
-                if (i) {
-                    inner += " + "
-                }
-                sum += rolls[i]
-                inner += rolls[i]
+            const com = commands[state.iDice]
+            if (/^\d*d\d+/.test(bit)) {
+                inner = formatDice(bit, com)
+            } else if ((com.type === commandType.customAnswer
+                || com.type === commandType.customCounter)
+                && (com.val as CustomCommandResult).name === bit
+            ) {
+                // Board-defined commands. Only consume the result, if it
+                // belongs to this command.
+                inner = escape(com.val.val.toString())
+            } else {
+                inner = null
             }
-            if (rolls.length > 1) {
-                inner += " = " + sum
+            if (inner === null) {
+                return "#" + bit
             }
+            state.iDice++
     }
 
     return `<strong>#${bit} (${inner})</strong>`
 }
+
+// Format the result of a dice roll. Posts created before dice modifiers were
+// supported only store the array of rolls. Returns null, if the command and
+// its result do not match.
+function formatDice(bit: string, {val}: Command): string {
+    const m = bit.match(/^(\d*)d(\d+)(k[hl]\d+)?/),
+        count = m[1] ? parseInt(m[1]) : 1
+    if (count > 100 || parseInt(m[2]) > 10000) {
+        return null
+    }
+
+    let rolls: number[],
+        modifier = 0,
+        total: number
+    if (Array.isArray(val)) {
+        rolls = val
+    } else {
+        ({rolls, total} = val as DiceRoll)
+        modifier = (val as DiceRoll).modifier || 0
+    }
+    if (!rolls || rolls.length !== count) {
+        return null
+    }
+
+    let inner = rolls.join(" + ")
+    if (modifier > 0) {
+        inner += " + " + modifier
+    } else if (modifier < 0) {
+        inner += " - " + -modifier
+    }
+    if (total === undefined) {
+        total = rolls.reduce((a, b) => a + b, 0)
+    }
+    if (rolls.length > 1 || modifier || m[3]) {
+        inner += " = " + total
+    }
+    return inner
+}
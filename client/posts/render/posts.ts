@@ -33,6 +33,17 @@ export default function (
 export function renderHeader(frag: NodeSelector, data: PostData) {
 	renderTime(frag.querySelector("time"), data.time, false)
 	renderName(frag.querySelector(".name"), data)
+	if (data.posterID) {
+		const el = frag.querySelector(".poster-id") as HTMLElement
+		el.textContent = "ID: " + data.posterID
+		el.setAttribute("data-id", data.posterID)
+		el.hidden = false
+	}
+	if (data.sage) {
+		const el = frag.querySelector(".sage") as HTMLElement
+		el.textContent = lang.sage
+		el.hidden = false
+	}
 
 	const nav = frag.querySelector("nav"),
 		link = nav.firstElementChild as HTMLAnchorElement,
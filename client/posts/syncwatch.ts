@@ -0,0 +1,63 @@
+// Synchronised #syncwatch timers for group watching
+
+import { syncwatch as lang } from "../lang"
+import { threads, write } from "../render"
+
+// Format the state of a timer at Unix time now. Returns a countdown before the
+// start, the elapsed and total duration while running or "finished".
+export function formatSyncWatch(start: number, end: number, now: number
+): string {
+    if (now < start) {
+        return "-" + formatDuration(start - now)
+    }
+    if (now < end) {
+        return formatDuration(now - start)
+            + " / "
+            + formatDuration(end - start)
+    }
+    return lang.finished
+}
+
+// Format a duration in seconds as [hours:]minutes:seconds
+function formatDuration(secs: number): string {
+    const h = Math.floor(secs / 3600),
+        m = Math.floor(secs % 3600 / 60),
+        s = secs % 60
+    let res = pad(m) + ":" + pad(s)
+    if (h) {
+        res = h + ":" + res
+    }
+    return res
+}
+
+function pad(n: number): string {
+    return (n < 10 ? "0" : "") + n
+}
+
+// Render the #syncwatch command with the timer's state
+export function renderSyncWatch(bit: string, [start, end]: number[]
+): string {
+    const now = Math.floor(Date.now() / 1000)
+    return `<strong class="syncwatch" data-start="${start}" `
+        + `data-end="${end}">`
+        + `#${bit} (${formatSyncWatch(start, end, now)})</strong>`
+}
+
+// Update all rendered timers, that have not yet finished
+function updateTimers() {
+    const now = Math.floor(Date.now() / 1000),
+        els = threads.querySelectorAll(".syncwatch")
+    for (let i = 0; i < els.length; i++) {
+        const el = els[i] as HTMLElement,
+            start = parseInt(el.getAttribute("data-start")),
+            end = parseInt(el.getAttribute("data-end"))
+        if (now > end + 1) {
+            continue
+        }
+        const text = formatSyncWatch(start, end, now)
+        write(() =>
+            el.textContent = el.textContent.replace(/\([^)]*\)$/, `(${text})`))
+    }
+}
+
+setInterval(updateTimers, 1000)
@@ -1,4 +1,4 @@
-import { Post, OP } from './models'
+import { Post, OP, PollData } from './models'
 import { mine, posts, page } from '../state'
 import { makeFrag, pluralize, HTML } from '../util'
 import renderPost, { renderName, renderTime } from './render/posts'
@@ -7,6 +7,7 @@ import { write, importTemplate } from '../render'
 import { renderBacklinks } from './render/etc'
 import { posts as lang, navigation } from '../lang'
 import ImageHandler from "./images"
+import { renderPoll } from "./polls"
 
 // Base post view class
 export default class PostView extends ImageHandler {
@@ -162,6 +163,17 @@ export default class PostView extends ImageHandler {
 		})
 	}
 
+	// Rerender the post's poll with updated options and tallies
+	renderPoll(poll: PollData) {
+		const el = this.el.querySelector(".poll")
+		if (!el) {
+			return
+		}
+		const html = renderPoll(poll)
+		write(() =>
+			el.outerHTML = html)
+	}
+
 	// Render the name, tripcode and email in the header
 	renderName() {
 		write(() =>
@@ -196,6 +208,22 @@ export class OPView extends PostView {
 		const omit = document.createElement("span")
 		omit.setAttribute("class", "omit")
 		this.el.querySelector(".post-container").append(omit)
+		if (this.isLocked()) {
+			this.el.classList.add("locked")
+		}
+	}
+
+	// Returns, if the thread accepts no new replies
+	isLocked(): boolean {
+		const {locked, archived} = this.model
+		return !!(locked || archived)
+	}
+
+	// Render the locked status of the thread after a lock or archival change
+	renderLocked() {
+		const locked = this.isLocked()
+		write(() =>
+			this.el.classList.toggle("locked", locked))
 	}
 
 	// Render posts and images omitted indicator
@@ -14,6 +14,7 @@ interface Configs extends ChangeEmitter {
 	hats: boolean
 	illyaDance: boolean
 	captcha: boolean
+	localCaptcha: boolean
 	mature: boolean // Website intended for mature audiences
 	defaultLang: string
 	defaultCSS: string
@@ -27,7 +28,13 @@ export interface BoardConfigs extends ChangeEmitter {
 	readOnly: boolean
 	textOnly: boolean
 	forcedAnon: boolean
+	posterIDs: boolean
 	hashCommands: boolean
+	maxDice: number
+	maxDieSides: number
+	bumpLimit: number
+	imageLimit: number
+	maxThreads: number
 	spoilers: boolean     // Text spoilers
 	codeTags: boolean
 	spoiler: string       //Image spoiler
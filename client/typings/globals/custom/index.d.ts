@@ -89,6 +89,11 @@ interface NotificationOptions {
 	icon?: string
 }
 
+declare class TextDecoder {
+	constructor(label?: string)
+	decode(input?: ArrayBufferView): string
+}
+
 interface Array<T> {
 	includes(item: T): boolean
 }
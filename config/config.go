@@ -5,6 +5,7 @@ package config
 
 import (
 	"encoding/json"
+	"regexp"
 	"sync"
 	"time"
 
@@ -18,6 +19,9 @@ var (
 	// Contains currently loaded global server configuration
 	global *Configs
 
+	// Compiled global content filters
+	globalFilters []CompiledFilter
+
 	// Map of board IDs to their configuration structs
 	boardConfigs = map[string]BoardConfContainer{}
 
@@ -49,21 +53,27 @@ var (
 
 	// Defaults contains the default server configuration values
 	Defaults = Configs{
-		ThreadExpiry:  14,
-		BoardExpiry:   7,
-		JPEGQuality:   80,
-		PNGQuality:    20,
-		MaxSize:       5,
-		MaxHeight:     6000,
-		MaxWidth:      6000,
-		SessionExpiry: 30,
-		Salt:          "LALALALALALALALALALALALALALALALALALALALA",
-		FeedbackEmail: "admin@email.com",
+		ThreadExpiry:      14,
+		ArchiveExpiry:     90,
+		BoardExpiry:       7,
+		JPEGQuality:       80,
+		PNGQuality:        20,
+		MaxSize:           5,
+		MaxHeight:         6000,
+		MaxWidth:          6000,
+		SessionExpiry:     30,
+		Salt:              "LALALALALALALALALALALALALALALALALALALALA",
+		FeedbackEmail:     "admin@email.com",
+		ThreadsPerHour:    10,
+		PostsPerMinute:    30,
+		MessagesPerSecond: 50,
+		CaptchasPerMinute: 10,
 		Public: Public{
-			DefaultCSS:  "moe",
-			FAQ:         defaultFAQ,
-			DefaultLang: "en_GB",
-			Links:       map[string]string{"4chan": "http://www.4chan.org/"},
+			DefaultCSS:   "moe",
+			FAQ:          defaultFAQ,
+			LocalCaptcha: true,
+			DefaultLang:  "en_GB",
+			Links:        map[string]string{"4chan": "http://www.4chan.org/"},
 		},
 	}
 
@@ -93,18 +103,29 @@ type Configs struct {
 	Public
 	PruneThreads      bool   `json:"pruneThreads" gorethink:"pruneThreads"`
 	PruneBoards       bool   `json:"pruneBoards" gorethink:"pruneBoards"`
+	ArchiveThreads    bool   `json:"archiveThreads" gorethink:"archiveThreads"`
 	Pyu               bool   `json:"pyu" gorethink:"pyu"`
 	MaxWidth          uint16 `json:"maxWidth" gorethink:"maxWidth"`
 	MaxHeight         uint16 `json:"maxHeight" gorethink:"maxHeight"`
 	JPEGQuality       int
 	PNGQuality        int
 	ThreadExpiry      uint          `json:"threadExpiry" gorethink:"threadExpiry"`
+	ArchiveExpiry     uint          `json:"archiveExpiry" gorethink:"archiveExpiry"`
 	BoardExpiry       uint          `json:"boardExpiry" gorethink:"boardExpiry"`
 	MaxSize           int64         `json:"maxSize" gorethink:"maxSize"`
 	Salt              string        `json:"salt" gorethink:"salt"`
 	FeedbackEmail     string        `json:"feedbackEmail" gorethink:"feedbackEmail"`
 	CaptchaPrivateKey string        `json:"captchaPrivateKey" gorethink:"captchaPrivateKey"`
 	SessionExpiry     time.Duration `json:"sessionExpiry" gorethink:"sessionExpiry"`
+
+	// Per-IP rate limits. Zero disables the limit.
+	ThreadsPerHour    uint `json:"threadsPerHour" gorethink:"threadsPerHour"`
+	PostsPerMinute    uint `json:"postsPerMinute" gorethink:"postsPerMinute"`
+	MessagesPerSecond uint `json:"messagesPerSecond" gorethink:"messagesPerSecond"`
+	CaptchasPerMinute uint `json:"captchasPerMinute" gorethink:"captchasPerMinute"`
+
+	// Content filters applied on all boards
+	Filters []Filter `json:"filters" gorethink:"filters"`
 }
 
 // Public contains configurations exposeable through public availability APIs
@@ -113,6 +134,7 @@ type Public struct {
 	Hats             bool   `json:"hats" gorethink:"hats"`
 	IllyaDance       bool   `json:"illyaDance" gorethink:"illyaDance"`
 	Captcha          bool   `json:"captcha" gorethink:"captcha"`
+	LocalCaptcha     bool   `json:"localCaptcha" gorethink:"localCaptcha"`
 	Mature           bool   `json:"mature" gorethink:"mature"`
 	DefaultLang      string `json:"defaultLang" gorethink:"defaultLang"`
 	DefaultCSS       string `json:"defaultCSS" gorethink:"defaultCSS"`
@@ -127,6 +149,59 @@ type BoardConfigs struct {
 	ID        string              `json:"id" gorethink:"id"`
 	Eightball []string            `json:"eightball" gorethink:"eightball"`
 	Staff     map[string][]string `json:"staff" gorethink:"staff"`
+	Filters   []Filter            `json:"filters" gorethink:"filters"`
+	Commands  []CustomCommand     `json:"commands" gorethink:"commands"`
+}
+
+// CustomCommandType is the kind of a board-defined hash command
+type CustomCommandType uint8
+
+// Kinds of board-defined hash commands
+const (
+	// Pick a random answer from the command's answer list
+	CustomRandom CustomCommandType = iota
+
+	// Increment a per-board counter and display its value
+	CustomCounter
+)
+
+// CustomCommand is a board-defined hash command, such as #quote picking a
+// random quote from a list. Consulted after the built-in commands.
+type CustomCommand struct {
+	Type    CustomCommandType `json:"type" gorethink:"type"`
+	Name    string            `json:"name" gorethink:"name"`
+	Answers []string          `json:"answers" gorethink:"answers"`
+}
+
+// FilterAction is the action taken, when a content filter matches
+type FilterAction uint8
+
+// Actions content filters can perform
+const (
+	// Replace the matched text with the filter's replacement
+	FilterReplace FilterAction = iota
+
+	// Reject the post
+	FilterReject
+
+	// Reject the post and ban its author for BanDuration minutes
+	FilterBan
+)
+
+// Filter is a literal or regex pattern applied to post text lines, subjects
+// and names. Literal patterns are matched case-insensitively.
+type Filter struct {
+	Regex       bool         `json:"regex" gorethink:"regex"`
+	Action      FilterAction `json:"action" gorethink:"action"`
+	BanDuration uint         `json:"banDuration" gorethink:"banDuration"`
+	Pattern     string       `json:"pattern" gorethink:"pattern"`
+	Replacement string       `json:"replacement" gorethink:"replacement"`
+}
+
+// CompiledFilter is a content filter with its pattern compiled
+type CompiledFilter struct {
+	Filter
+	Re *regexp.Regexp
 }
 
 // BoardPublic contains publically accessible board-specific configurations
@@ -142,11 +217,13 @@ type BoardPublic struct {
 }
 
 // BoardConfContainer contains configurations for an individual board as well
-// as pregenerated public JSON and it's hash
+// as pregenerated public JSON and it's hash and the board's compiled content
+// filters
 type BoardConfContainer struct {
 	BoardConfigs
-	JSON []byte
-	Hash string
+	JSON            []byte
+	Hash            string
+	CompiledFilters []CompiledFilter
 }
 
 // DatabaseBoardConfigs contains extra fields not exposed on database reads
@@ -155,12 +232,50 @@ type DatabaseBoardConfigs struct {
 	Created time.Time `gorethink:"created"`
 }
 
+// Limits of dice roll hash commands
+const (
+	// DefaultMaxDice and DefaultMaxDieSides apply to boards, that have not set
+	// their own dice limits
+	DefaultMaxDice     = 10
+	DefaultMaxDieSides = 100
+
+	// MaxDice and MaxDieSides are the upper bounds of board dice limits
+	MaxDice     = 100
+	MaxDieSides = 10000
+
+	// MaxDiceModifier is the maximum absolute value of a dice roll modifier
+	MaxDiceModifier = 10000
+)
+
 // PostParseConfigs contains board-specific flags for post text parsing
 type PostParseConfigs struct {
 	ReadOnly     bool `json:"readOnly" gorethink:"readOnly"`
 	TextOnly     bool `json:"textOnly" gorethink:"textOnly"`
 	ForcedAnon   bool `json:"forcedAnon" gorethink:"forcedAnon"`
+	PosterIDs    bool `json:"posterIDs" gorethink:"posterIDs"`
 	HashCommands bool `json:"hashCommands" gorethink:"hashCommands"`
+
+	// Dice roll limits. 0 denotes the default limit.
+	MaxDice     uint8  `json:"maxDice" gorethink:"maxDice"`
+	MaxDieSides uint16 `json:"maxDieSides" gorethink:"maxDieSides"`
+
+	// Thread size limits. 0 denotes no limit.
+	BumpLimit  uint `json:"bumpLimit" gorethink:"bumpLimit"`
+	ImageLimit uint `json:"imageLimit" gorethink:"imageLimit"`
+	MaxThreads uint `json:"maxThreads" gorethink:"maxThreads"`
+}
+
+// DiceLimits returns the maximum number of dice and sides per die of a dice
+// roll command on the board
+func (p PostParseConfigs) DiceLimits() (dice, sides int) {
+	dice, sides = DefaultMaxDice, DefaultMaxDieSides
+	if p.MaxDice != 0 {
+		dice = int(p.MaxDice)
+	}
+	if p.MaxDieSides != 0 {
+		sides = int(p.MaxDieSides)
+	}
+	return
 }
 
 // Generate /all/ board configs
@@ -180,23 +295,63 @@ func Get() *Configs {
 	return global
 }
 
-// Set sets the internal configuration struct
+// Set sets the internal configuration struct and compiles the global content
+// filters
 func Set(c Configs) error {
 	client, err := json.Marshal(c.Public)
 	if err != nil {
 		return err
 	}
 	h := util.HashBuffer(client)
+	filters, err := compileFilters(c.Filters)
+	if err != nil {
+		return err
+	}
 
 	globalMu.Lock()
 	clientJSON = client
 	global = &c
 	hash = h
+	globalFilters = filters
 	globalMu.Unlock()
 
 	return nil
 }
 
+// GetFilters returns the compiled global content filters. Callers should not
+// modify the returned slice.
+func GetFilters() []CompiledFilter {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return globalFilters
+}
+
+// CompileFilter compiles a content filter's pattern. Literal patterns are
+// matched case-insensitively.
+func CompileFilter(f Filter) (*regexp.Regexp, error) {
+	pattern := f.Pattern
+	if !f.Regex {
+		pattern = "(?i)" + regexp.QuoteMeta(pattern)
+	}
+	return regexp.Compile(pattern)
+}
+
+// Compile a list of content filters. Returns nil for an empty list.
+func compileFilters(filters []Filter) ([]CompiledFilter, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	compiled := make([]CompiledFilter, len(filters))
+	for i, f := range filters {
+		re, err := CompileFilter(f)
+		if err != nil {
+			return nil, err
+		}
+		compiled[i] = CompiledFilter{f, re}
+	}
+	return compiled, nil
+}
+
 // GetClient returns public availability configuration JSON and a truncated
 // configuration MD5 hash
 func GetClient() ([]byte, string) {
@@ -245,8 +400,9 @@ func IsBoard(b string) bool {
 }
 
 // SetBoardConfigs sets configurations for a specific board as well as
-// pregenerates their public JSON and hash. Returns if any changes were made to
-// the configs in result.
+// pregenerates their public JSON and hash and compiles the board's content
+// filters. Returns if any changes were made to the public configs in result.
+// Changes to private configs are always applied.
 func SetBoardConfigs(conf BoardConfigs) (bool, error) {
 	cont := BoardConfContainer{
 		BoardConfigs: conf,
@@ -257,18 +413,17 @@ func SetBoardConfigs(conf BoardConfigs) (bool, error) {
 		return false, err
 	}
 	cont.Hash = util.HashBuffer(cont.JSON)
+	cont.CompiledFilters, err = compileFilters(conf.Filters)
+	if err != nil {
+		return false, err
+	}
 
 	boardMu.Lock()
 	defer boardMu.Unlock()
 
-	// Nothing changed
-	if boardConfigs[conf.ID].Hash == cont.Hash {
-		return false, nil
-	}
-
-	// Swap config
+	changed := boardConfigs[conf.ID].Hash != cont.Hash
 	boardConfigs[conf.ID] = cont
-	return true, nil
+	return changed, nil
 }
 
 // RemoveBoard removes a board from the exiting board list and deletes its
@@ -288,6 +443,7 @@ func Clear() {
 	defer globalMu.RUnlock()
 
 	global = &Configs{}
+	globalFilters = nil
 	boardConfigs = map[string]BoardConfContainer{}
 	clientJSON = nil
 	hash = ""
@@ -135,6 +135,76 @@ func TestSetDifferentBoardConfigs(t *testing.T) {
 	testBoardConfChange(t, conf)
 }
 
+func TestSetPrivateBoardConfigs(t *testing.T) {
+	ClearBoards()
+
+	conf := BoardConfigs{
+		ID: "a",
+	}
+	testBoardConfChange(t, conf)
+
+	conf.Staff = map[string][]string{
+		"owners": {"foo"},
+	}
+	changed, err := SetBoardConfigs(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("public configs changed")
+	}
+	AssertDeepEquals(t, GetBoardConfigs("a").BoardConfigs, conf)
+}
+
+func TestFilterCompilation(t *testing.T) {
+	Clear()
+
+	conf := Configs{
+		Filters: []Filter{{Pattern: "a.b"}},
+	}
+	if err := Set(conf); err != nil {
+		t.Fatal(err)
+	}
+	global := GetFilters()
+	if len(global) != 1 {
+		t.Fatalf("unexpected global filters: %#v", global)
+	}
+	if global[0].Re.MatchString("axb") || !global[0].Re.MatchString("A.B") {
+		t.Error("literal pattern not matched case-insensitively")
+	}
+
+	board := BoardConfigs{
+		ID:      "a",
+		Filters: []Filter{{Regex: true, Pattern: "foo"}},
+	}
+	if _, err := SetBoardConfigs(board); err != nil {
+		t.Fatal(err)
+	}
+	board.Filters[0].Pattern = "bar"
+	if _, err := SetBoardConfigs(board); err != nil {
+		t.Fatal(err)
+	}
+	filters := GetBoardConfigs("a").CompiledFilters
+	if len(filters) != 1 || !filters[0].Re.MatchString("bar") {
+		t.Fatalf("filters not recompiled: %#v", filters)
+	}
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		board := BoardConfigs{
+			ID:      "b",
+			Filters: []Filter{{Regex: true, Pattern: "("}},
+		}
+		if _, err := SetBoardConfigs(board); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	RemoveBoard("a")
+	if filters := GetBoardConfigs("a").CompiledFilters; filters != nil {
+		t.Fatalf("filters not removed: %#v", filters)
+	}
+}
+
 func testBoardConfChange(t *testing.T, conf BoardConfigs) {
 	changed, err := SetBoardConfigs(conf)
 	if err != nil {
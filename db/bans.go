@@ -0,0 +1,34 @@
+// IP and IP range ban storage and lookup
+
+package db
+
+import (
+	"github.com/bakape/meguca/auth"
+	r "github.com/dancannon/gorethink"
+)
+
+// InsertBan writes a new ban to the database
+func InsertBan(ban auth.Ban) error {
+	return Write(r.Table("bans").Insert(ban))
+}
+
+// IsBanned checks, if the IP is banned on the specific board or globally.
+// Returns the longest lasting ban applicable, if any.
+func IsBanned(board, ip string) (ban auth.Ban, banned bool, err error) {
+	var bans []auth.Ban
+	q := r.
+		Table("bans").
+		GetAllByIndex("board", board, "all").
+		Filter(r.Row.Field("expires").Gt(r.Now()))
+	if err = All(q, &bans); err != nil {
+		return
+	}
+
+	for _, b := range bans {
+		if b.Matches(ip) && b.Expires.After(ban.Expires) {
+			ban = b
+			banned = true
+		}
+	}
+	return
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bakape/meguca/auth"
+	. "github.com/bakape/meguca/test"
+)
+
+func TestIsBanned(t *testing.T) {
+	assertTableClear(t, "bans")
+
+	now := time.Now()
+	bans := [...]auth.Ban{
+		{
+			IP:      "207.178.71.93",
+			Board:   "a",
+			Reason:  "foo",
+			Expires: now.Add(time.Hour),
+		},
+		{
+			IP:      "10.121.169.0/24",
+			Board:   "all",
+			Reason:  "bar",
+			Expires: now.Add(time.Hour),
+		},
+		{
+			IP:      "10.121.169.19",
+			Board:   "a",
+			Reason:  "longer",
+			Expires: now.Add(time.Hour * 2),
+		},
+		{
+			IP:      "162.30.251.246",
+			Board:   "a",
+			Expires: now.Add(-time.Minute),
+		},
+	}
+	for _, b := range bans {
+		if err := InsertBan(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := [...]struct {
+		name, board, ip string
+		banned          bool
+		reason          string
+	}{
+		{"banned on board", "a", "207.178.71.93", true, "foo"},
+		{"other board", "c", "207.178.71.93", false, ""},
+		{"global range", "c", "10.121.169.20", true, "bar"},
+		{"longest ban", "a", "10.121.169.19", true, "longer"},
+		{"expired", "a", "162.30.251.246", false, ""},
+		{"not banned", "a", "::1", false, ""},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			ban, banned, err := IsBanned(c.board, c.ip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if banned != c.banned {
+				LogUnexpected(t, c.banned, banned)
+			}
+			if ban.Reason != c.reason {
+				LogUnexpected(t, c.reason, ban.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Storage and verification of locally generated captchas
+
+package db
+
+import (
+	"strings"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+)
+
+// Maximum length of a RethinkDB primary key
+const maxKeyLength = 127
+
+type captchaDocument struct {
+	ID       string    `gorethink:"id"`
+	Solution string    `gorethink:"solution"`
+	Expires  time.Time `gorethink:"expires"`
+}
+
+// InsertCaptcha writes a captcha's solution to the database, to be verified
+// with SolveCaptcha before it expires
+func InsertCaptcha(id, solution string, expires time.Time) error {
+	return Insert("captchas", captchaDocument{
+		ID:       id,
+		Solution: solution,
+		Expires:  expires,
+	})
+}
+
+// SolveCaptcha returns, if the solution matches an unexpired captcha. Captchas
+// are single use and are deleted on any attempt to solve them, to prevent
+// brute forcing.
+func SolveCaptcha(id, solution string) (solved bool, err error) {
+	if id == "" || len(id) > maxKeyLength {
+		return false, nil
+	}
+
+	q := r.
+		Table("captchas").
+		Get(id).
+		Delete(r.DeleteOpts{ReturnChanges: true}).
+		Field("changes").
+		Field("old_val").
+		Contains(func(c r.Term) r.Term {
+			return c.
+				Field("solution").
+				Eq(strings.TrimSpace(solution)).
+				And(c.Field("expires").Gt(r.Now()))
+		})
+	err = One(q, &solved)
+	return
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/bakape/meguca/test"
+)
+
+func TestSolveCaptcha(t *testing.T) {
+	assertTableClear(t, "captchas")
+
+	expires := time.Now().Add(time.Minute)
+	for _, id := range [...]string{"1", "2", "3"} {
+		if err := InsertCaptcha(id, "123456", expires); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := InsertCaptcha("4", "123456", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := [...]struct {
+		name, id, solution string
+		solved             bool
+	}{
+		{"valid", "1", "123456", true},
+		{"padded", "2", " 123456\n", true},
+		{"already solved", "1", "123456", false},
+		{"wrong solution", "3", "654321", false},
+		{"retry after wrong solution", "3", "123456", false},
+		{"expired", "4", "123456", false},
+		{"nonexistent", "5", "123456", false},
+		{"no ID", "", "123456", false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			solved, err := SolveCaptcha(c.id, c.solution)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if solved != c.solved {
+				LogUnexpected(t, c.solved, solved)
+			}
+		})
+	}
+}
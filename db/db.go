@@ -12,6 +12,9 @@ var (
 	// ErrUserNameTaken denotes a user name the client is trying  to register
 	// with is already taken
 	ErrUserNameTaken = errors.New("user name already taken")
+
+	// ErrNoSuchPage denotes a requested page is past the last page
+	ErrNoSuchPage = errors.New("no such page")
 )
 
 var postReservationQuery = GetMain("info").
@@ -74,12 +77,36 @@ func FindPost(id int64) r.Term {
 	return r.Table("posts").Get(id)
 }
 
-// ValidateOP confirms the specified thread exists on specific board
+// ValidateOP confirms the specified thread exists on specific board and has
+// not been deleted
 func ValidateOP(id int64, board string) (valid bool, err error) {
-	err = One(FindThread(id).Field("board").Eq(board).Default(false), &valid)
+	q := FindThread(id).
+		Do(func(t r.Term) r.Term {
+			return t.
+				Field("board").
+				Eq(board).
+				And(t.Field("deleted").Default(false).Not())
+		}).
+		Default(false)
+	err = One(q, &valid)
 	return
 }
 
+// AppendLog returns the fields of a post update, that append a message to the
+// post's replication log and record the time of the append. The times are
+// used to replay the log to clients, that have missed updates. now can be
+// either a Unix timestamp or a query term.
+func AppendLog(post r.Term, msg, now interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"log": post.Field("log").Default([]interface{}{}).Append(msg),
+		"logTimes": post.
+			Field("logTimes").
+			Default([]interface{}{}).
+			Append(now),
+		"lastUpdated": now,
+	}
+}
+
 // FindThread is a  shorthand for retrieving a document from the "threads" table
 func FindThread(id int64) r.Term {
 	return r.Table("threads").Get(id)
@@ -16,7 +16,7 @@ import (
 	r "github.com/dancannon/gorethink"
 )
 
-const dbVersion = 18
+const dbVersion = 23
 
 var (
 	// Address of the RethinkDB cluster instance to connect to
@@ -55,6 +55,21 @@ var (
 
 		// Board configurations
 		"boards",
+
+		// IP and IP range bans
+		"bans",
+
+		// Log of all actions performed by staff
+		"modLog",
+
+		// Posts reported by readers for staff review
+		"reports",
+
+		// Solutions of locally generated captchas
+		"captchas",
+
+		// Clients connected to each server instance
+		"presence",
 	}
 
 	// Map of simple secondary indices for tables
@@ -67,6 +82,14 @@ var (
 		{"posts", "board"},
 		{"posts", "editing"},
 		{"posts", "lastUpdated"},
+		{"bans", "board"},
+		{"bans", "expires"},
+		{"modLog", "board"},
+		{"modLog", "time"},
+		{"reports", "board"},
+		{"reports", "ip"},
+		{"captchas", "expires"},
+		{"presence", "expires"},
 	}
 
 	// Query that increments the database version
@@ -175,6 +198,31 @@ func verifyDBVersion() error {
 		if err := upgrade17to18(); err != nil {
 			return err
 		}
+		fallthrough
+	case 18:
+		if err := upgrade18to19(); err != nil {
+			return err
+		}
+		fallthrough
+	case 19:
+		if err := upgrade19to20(); err != nil {
+			return err
+		}
+		fallthrough
+	case 20:
+		if err := upgrade20to21(); err != nil {
+			return err
+		}
+		fallthrough
+	case 21:
+		if err := upgrade21to22(); err != nil {
+			return err
+		}
+		fallthrough
+	case 22:
+		if err := upgrade22to23(); err != nil {
+			return err
+		}
 	default:
 		return fmt.Errorf("incompatible database version: %d", version)
 	}
@@ -316,6 +364,74 @@ func upgrade17to18() error {
 	})
 }
 
+// Create the "bans" table and its indices
+func upgrade18to19() error {
+	err := WriteAll([]r.Term{
+		createTable("bans"),
+		r.Table("bans").IndexCreate("board"),
+		r.Table("bans").IndexCreate("expires"),
+		incrementVersion,
+	})
+	if err != nil {
+		return err
+	}
+	return waitForIndex("bans")()
+}
+
+// Create the "modLog" table and its indices
+func upgrade19to20() error {
+	err := WriteAll([]r.Term{
+		createTable("modLog"),
+		r.Table("modLog").IndexCreate("board"),
+		r.Table("modLog").IndexCreate("time"),
+		incrementVersion,
+	})
+	if err != nil {
+		return err
+	}
+	return waitForIndex("modLog")()
+}
+
+// Create the "reports" table and its indices
+func upgrade20to21() error {
+	err := WriteAll([]r.Term{
+		createTable("reports"),
+		r.Table("reports").IndexCreate("board"),
+		r.Table("reports").IndexCreate("ip"),
+		incrementVersion,
+	})
+	if err != nil {
+		return err
+	}
+	return waitForIndex("reports")()
+}
+
+// Create the "captchas" table and its index
+func upgrade21to22() error {
+	err := WriteAll([]r.Term{
+		createTable("captchas"),
+		r.Table("captchas").IndexCreate("expires"),
+		incrementVersion,
+	})
+	if err != nil {
+		return err
+	}
+	return waitForIndex("captchas")()
+}
+
+// Create the "presence" table and its index
+func upgrade22to23() error {
+	err := WriteAll([]r.Term{
+		createTable("presence"),
+		r.Table("presence").IndexCreate("expires"),
+		incrementVersion,
+	})
+	if err != nil {
+		return err
+	}
+	return waitForIndex("presence")()
+}
+
 // InitDB initialize a rethinkDB database
 func InitDB() error {
 	log.Printf("initializing database '%s'", DBName)
@@ -428,6 +544,11 @@ func createAdminAccount() error {
 
 // ClearTables deletes the contents of specified DB tables. Only used for tests.
 func ClearTables(tables ...string) error {
+	for _, t := range tables {
+		if t == "posts" {
+			clearParenthoodCache()
+		}
+	}
 	q := r.Expr(tables).ForEach(func(table r.Term) r.Term {
 		return r.Table(table).Delete()
 	})
@@ -13,6 +13,9 @@ import (
 func init() {
 	DBName = "meguca_test_db"
 	IsTest = true
+	EncodeArchiveMessage = func(id int64) ([]byte, error) {
+		return []byte(fmt.Sprintf(`15{"id":%d,"val":true}`, id)), nil
+	}
 	if err := LoadDB(); err != nil {
 		panic(err)
 	}
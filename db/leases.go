@@ -0,0 +1,87 @@
+// Exclusive write leases of connections on open posts. Leases are stored in
+// the post documents, so they are honoured by all server instances sharing
+// the database.
+
+package db
+
+import (
+	"time"
+
+	"github.com/bakape/meguca/types"
+	r "github.com/dancannon/gorethink"
+)
+
+// LeaseTimeout is the duration after which a connection's lease on an open
+// post expires, unless renewed
+const LeaseTimeout = time.Second * 30
+
+// NewLease creates a new lease on an open post for the connection
+func NewLease(owner string) *types.Lease {
+	return &types.Lease{
+		Owner:   owner,
+		Expires: time.Now().Add(LeaseTimeout),
+	}
+}
+
+// Returns, if the post is not deleted and the lease on the post is held by
+// owner, has expired or was never set
+func leaseAvailable(post r.Term, owner string) r.Term {
+	lease := post.Field("lease")
+	return post.Field("deleted").Default(false).Not().And(lease.
+		Field("owner").
+		Eq(owner).
+		Or(lease.Field("expires").Lt(r.Now())).
+		Default(true))
+}
+
+// UpdateLeased applies an update to an open post and renews the connection's
+// lease on it, if the lease is available to the connection. update receives
+// the post document and returns the fields to update. Returns false, if
+// another connection holds an unexpired lease or the post does not exist or
+// is deleted.
+func UpdateLeased(
+	id int64,
+	owner string,
+	update func(post r.Term) map[string]interface{},
+) (
+	bool, error,
+) {
+	q := FindPost(id).Update(func(p r.Term) r.Term {
+		fields := update(p)
+		fields["lease"] = map[string]interface{}{
+			"owner":   owner,
+			"expires": r.Now().Add(LeaseTimeout.Seconds()),
+		}
+		return r.Branch(
+			leaseAvailable(p, owner),
+			fields,
+			map[string]interface{}{},
+		)
+	})
+	res, err := q.RunWrite(RSession)
+	return res.Replaced != 0, err
+}
+
+// AcquireLease acquires or renews a connection's lease on an open post.
+// Returns false, if another connection holds an unexpired lease or the post
+// does not exist or is deleted.
+func AcquireLease(id int64, owner string) (bool, error) {
+	return UpdateLeased(id, owner, func(_ r.Term) map[string]interface{} {
+		return map[string]interface{}{}
+	})
+}
+
+// ReleaseLease releases a connection's lease on an open post, so the post can
+// be immediately reclaimed by other connections
+func ReleaseLease(id int64, owner string) error {
+	q := FindPost(id).Update(func(p r.Term) r.Term {
+		return r.Branch(
+			p.Field("lease").Field("owner").Eq(owner).Default(false),
+			map[string]interface{}{
+				"lease": r.Literal(),
+			},
+			map[string]interface{}{},
+		)
+	})
+	return Write(q)
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bakape/meguca/types"
+)
+
+func TestLeases(t *testing.T) {
+	assertTableClear(t, "posts")
+	assertInsert(t, "posts", []types.DatabasePost{
+		{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					ID: 1,
+				},
+			},
+			Lease: NewLease("a"),
+		},
+		{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					ID: 2,
+				},
+			},
+		},
+		{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					ID:      3,
+					Deleted: true,
+				},
+			},
+		},
+	})
+
+	assertLease := func(id int64, owner string, std bool) {
+		ok, err := AcquireLease(id, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != std {
+			t.Errorf("unexpected lease result for %s on %d: %t", owner, id, ok)
+		}
+	}
+
+	assertLease(1, "a", true)  // Renewal
+	assertLease(1, "b", false) // Held by other connection
+	assertLease(2, "b", true)  // No lease set
+	assertLease(3, "a", false) // Deleted
+	assertLease(99, "a", false)
+
+	// Only the owner can release a lease
+	if err := ReleaseLease(1, "b"); err != nil {
+		t.Fatal(err)
+	}
+	assertLease(1, "b", false)
+	if err := ReleaseLease(1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	assertLease(1, "b", true)
+
+	// Expired leases can be acquired by other connections
+	q := FindPost(1).Update(map[string]interface{}{
+		"lease": map[string]interface{}{
+			"expires": time.Now().Add(-time.Second),
+		},
+	})
+	if err := Write(q); err != nil {
+		t.Fatal(err)
+	}
+	assertLease(1, "a", true)
+}
@@ -0,0 +1,82 @@
+// Moderation log writing and retrieval
+
+package db
+
+import (
+	"time"
+
+	"github.com/bakape/meguca/types"
+	r "github.com/dancannon/gorethink"
+)
+
+// ModLogPageSize is the number of entries returned per moderation log page
+const ModLogPageSize = 50
+
+// ModLogFilter restricts the entries retrieved from the moderation log. Zero
+// value fields are not filtered by.
+type ModLogFilter struct {
+	Types []types.ModerationAction
+	By    string
+}
+
+// LogModeration records a staff action in the moderation log with the current
+// time
+func LogModeration(entry types.ModLogEntry) error {
+	entry.Time = time.Now().Unix()
+	return Insert("modLog", entry)
+}
+
+// GetModLog retrieves a page of moderation log entries for a board, newest
+// first. The "all" board retrieves entries from all boards. Returns
+// ErrNoSuchPage, if the page is past the last page of matching entries. The
+// first page is always valid.
+func GetModLog(board string, page int, filter ModLogFilter) (
+	entries []types.ModLogEntry, err error,
+) {
+	var q r.Term
+	if board == "all" {
+		q = r.Table("modLog").OrderBy(r.OrderByOpts{Index: r.Desc("time")})
+	} else {
+		q = r.
+			Table("modLog").
+			GetAllByIndex("board", board).
+			OrderBy(r.Desc("time"))
+	}
+
+	if len(filter.Types) != 0 {
+		q = q.Filter(func(e r.Term) r.Term {
+			return r.Expr(filter.Types).Contains(e.Field("type"))
+		})
+	}
+	if filter.By != "" {
+		q = q.Filter(map[string]string{
+			"by": filter.By,
+		})
+	}
+
+	// Count matching entries in the same query to validate the page against
+	var res struct {
+		Total   int                 `gorethink:"total"`
+		Entries []types.ModLogEntry `gorethink:"entries"`
+	}
+	err = One(r.Expr(map[string]r.Term{
+		"total": q.Count(),
+		"entries": q.
+			Skip(page * ModLogPageSize).
+			Limit(ModLogPageSize).
+			Without("id").
+			CoerceTo("array"),
+	}), &res)
+	switch {
+	case err != nil:
+		return
+	case page != 0 && page*ModLogPageSize >= res.Total:
+		return nil, ErrNoSuchPage
+	}
+
+	entries = res.Entries
+	if entries == nil {
+		entries = []types.ModLogEntry{}
+	}
+	return
+}
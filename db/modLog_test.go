@@ -0,0 +1,86 @@
+package db
+
+import (
+	"testing"
+
+	. "github.com/bakape/meguca/test"
+	"github.com/bakape/meguca/types"
+)
+
+func TestModLog(t *testing.T) {
+	assertTableClear(t, "modLog")
+
+	entries := [...]types.ModLogEntry{
+		{Type: types.CreateBoard, Board: "a", By: "user1"},
+		{Type: types.DeletePost, Board: "a", By: "user2", Target: 2},
+		{Type: types.BanPoster, Board: "c", By: "user1", Target: 3},
+	}
+	for _, e := range entries {
+		if err := LogModeration(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := [...]struct {
+		name, board string
+		page        int
+		filter      ModLogFilter
+		count       int
+	}{
+		{"board", "a", 0, ModLogFilter{}, 2},
+		{"all boards", "all", 0, ModLogFilter{}, 3},
+		{"empty first page", "d", 0, ModLogFilter{}, 0},
+		{"by actor", "a", 0, ModLogFilter{By: "user2"}, 1},
+		{
+			"by type",
+			"all",
+			0,
+			ModLogFilter{
+				Types: []types.ModerationAction{
+					types.CreateBoard, types.BanPoster,
+				},
+			},
+			2,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := GetModLog(c.board, c.page, c.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res == nil {
+				t.Fatal("nil entries")
+			}
+			if len(res) != c.count {
+				LogUnexpected(t, c.count, len(res))
+			}
+			for _, e := range res {
+				if e.Time == 0 {
+					t.Error("no timestamp")
+				}
+			}
+		})
+	}
+}
+
+func TestModLogPastLastPage(t *testing.T) {
+	assertTableClear(t, "modLog")
+	err := LogModeration(types.ModLogEntry{
+		Type:  types.CreateBoard,
+		Board: "a",
+		By:    "user1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = GetModLog("a", 1, ModLogFilter{})
+	if err != ErrNoSuchPage {
+		UnexpectedError(t, err)
+	}
+}
@@ -0,0 +1,107 @@
+// Short-lived cache of post parenthood for resolving post links
+
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bakape/meguca/types"
+	r "github.com/dancannon/gorethink"
+)
+
+// Time post parenthood is cached for. Parenthood of a post never changes, but
+// entries are expired to bound memory usage and to not resolve links to
+// threads deleted in the meantime for long.
+const parenthoodCacheTTL = time.Minute
+
+// Global cache of post parenthood shared between all clients
+var parenthoods = parenthoodCache{
+	m: make(map[int64]cachedParenthood),
+}
+
+type parenthoodCache struct {
+	sync.RWMutex
+	lastSweep time.Time
+	m         map[int64]cachedParenthood
+}
+
+type cachedParenthood struct {
+	types.Link
+	expires time.Time
+}
+
+// GetParenthood retrieves the parent thread and board of the posts. Posts not
+// in the cache are retrieved with a single query. Nonexistent posts are omitted
+// from the result.
+func GetParenthood(ids ...int64) (types.LinkMap, error) {
+	links := make(types.LinkMap, len(ids))
+	missing := make([]interface{}, 0, len(ids))
+
+	now := time.Now()
+	parenthoods.RLock()
+	for _, id := range ids {
+		if c, ok := parenthoods.m[id]; ok && c.expires.After(now) {
+			links[id] = c.Link
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	parenthoods.RUnlock()
+
+	if len(missing) == 0 {
+		return links, nil
+	}
+
+	var res []struct {
+		ID, OP int64
+		Board  string
+	}
+	q := r.Table("posts").GetAll(missing...).Pluck("id", "op", "board")
+	if err := All(q, &res); err != nil {
+		return nil, err
+	}
+	for _, p := range res {
+		link := types.Link{
+			OP:    p.OP,
+			Board: p.Board,
+		}
+		links[p.ID] = link
+		CacheParenthood(p.ID, link)
+	}
+
+	return links, nil
+}
+
+// CacheParenthood stores the parent thread and board of a post, so links to
+// the post can be resolved without querying the database
+func CacheParenthood(id int64, link types.Link) {
+	now := time.Now()
+	parenthoods.Lock()
+	defer parenthoods.Unlock()
+
+	if now.Sub(parenthoods.lastSweep) >= parenthoodCacheTTL {
+		parenthoods.sweep(now)
+	}
+	parenthoods.m[id] = cachedParenthood{
+		Link:    link,
+		expires: now.Add(parenthoodCacheTTL),
+	}
+}
+
+// Remove all entries from the cache
+func clearParenthoodCache() {
+	parenthoods.Lock()
+	defer parenthoods.Unlock()
+	parenthoods.m = make(map[int64]cachedParenthood)
+}
+
+// Remove expired entries from the cache. Requires a write lock.
+func (c *parenthoodCache) sweep(now time.Time) {
+	for id, p := range c.m {
+		if !p.expires.After(now) {
+			delete(c.m, id)
+		}
+	}
+	c.lastSweep = now
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/bakape/meguca/test"
+	"github.com/bakape/meguca/types"
+	r "github.com/dancannon/gorethink"
+)
+
+func TestGetParenthood(t *testing.T) {
+	assertTableClear(t, "posts")
+	assertInsert(t, "posts", []types.DatabasePost{
+		{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					ID: 1,
+				},
+				OP:    1,
+				Board: "a",
+			},
+		},
+		{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					ID: 2,
+				},
+				OP:    1,
+				Board: "a",
+			},
+		},
+	})
+	CacheParenthood(3, types.Link{
+		OP:    1,
+		Board: "c",
+	})
+
+	std := types.LinkMap{
+		1: {
+			OP:    1,
+			Board: "a",
+		},
+		2: {
+			OP:    1,
+			Board: "a",
+		},
+		3: {
+			OP:    1,
+			Board: "c",
+		},
+	}
+
+	links, err := GetParenthood(1, 2, 3, 99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, links, std)
+
+	// Retrieved posts are now cached
+	if err := Write(r.Table("posts").Delete()); err != nil {
+		t.Fatal(err)
+	}
+	links, err = GetParenthood(1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, links, std)
+}
+
+func TestParenthoodCacheSweep(t *testing.T) {
+	now := time.Now()
+	c := parenthoodCache{
+		m: map[int64]cachedParenthood{
+			1: {
+				expires: now.Add(-time.Second),
+			},
+			2: {
+				expires: now.Add(time.Second),
+			},
+		},
+	}
+	c.sweep(now)
+
+	if _, ok := c.m[1]; ok {
+		t.Error("expired entry not removed")
+	}
+	if _, ok := c.m[2]; !ok {
+		t.Error("valid entry removed")
+	}
+	if c.lastSweep != now {
+		t.Error("sweep time not set")
+	}
+}
@@ -0,0 +1,66 @@
+// Registry of clients connected to all server instances sharing the database.
+// Each instance periodically publishes its clients along with a heartbeat.
+
+package db
+
+import (
+	"time"
+
+	r "github.com/dancannon/gorethink"
+)
+
+// PresenceTimeout is the duration after which a server instance's presence
+// document expires, unless renewed
+const PresenceTimeout = time.Second * 30
+
+// PresenceClient is a client synchronised to a server instance
+type PresenceClient struct {
+	IP    string `gorethink:"ip"`
+	Board string `gorethink:"board"`
+	OP    int64  `gorethink:"op"` // 0, if synced to a board page
+	// Client has an open post
+	Typing bool `gorethink:"typing"`
+}
+
+// InstancePresence contains all clients synchronised to a server instance
+type InstancePresence struct {
+	ID      string           `gorethink:"id"`
+	Clients []PresenceClient `gorethink:"clients"`
+}
+
+// WritePresence publishes or renews the presence document of a server instance
+func WritePresence(instance string, clients []PresenceClient) error {
+	if clients == nil {
+		clients = []PresenceClient{}
+	}
+	q := r.
+		Table("presence").
+		Insert(
+			map[string]interface{}{
+				"id":      instance,
+				"clients": clients,
+				"expires": r.Now().Add(PresenceTimeout.Seconds()),
+			},
+			r.InsertOpts{Conflict: "replace"},
+		)
+	return Write(q)
+}
+
+// RemovePresence removes the presence document of a server instance
+func RemovePresence(instance string) error {
+	return Write(r.Table("presence").Get(instance).Delete())
+}
+
+// GetPresence retrieves the unexpired presence documents of all server
+// instances, except for the passed one
+func GetPresence(except string) (pres []InstancePresence, err error) {
+	q := r.
+		Table("presence").
+		Between(r.Now(), r.MaxVal, r.BetweenOpts{
+			Index: "expires",
+		}).
+		Filter(r.Row.Field("id").Ne(except)).
+		Without("expires")
+	err = All(q, &pres)
+	return
+}
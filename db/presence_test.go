@@ -0,0 +1,54 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/bakape/meguca/test"
+	r "github.com/dancannon/gorethink"
+)
+
+func TestPresence(t *testing.T) {
+	assertTableClear(t, "presence")
+
+	clients := []PresenceClient{
+		{
+			IP:    "::1",
+			Board: "a",
+			OP:    1,
+		},
+		{
+			IP:    "::2",
+			Board: "a",
+		},
+	}
+	for _, id := range [...]string{"a", "b", "c"} {
+		if err := WritePresence(id, clients); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WritePresence("d", nil); err != nil {
+		t.Fatal(err)
+	}
+	expire := r.Table("presence").Get("c").Update(map[string]time.Time{
+		"expires": time.Now().Add(-time.Second),
+	})
+	if err := Write(expire); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemovePresence("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := GetPresence("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []InstancePresence{
+		{
+			ID:      "d",
+			Clients: []PresenceClient{},
+		},
+	}
+	AssertDeepEquals(t, res, std)
+}
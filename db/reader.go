@@ -5,11 +5,15 @@ import (
 	r "github.com/dancannon/gorethink"
 )
 
+// ArchivePageSize is the number of threads returned per archive page
+const ArchivePageSize = 50
+
 // Preconstructed REQL queries that don't have to be rebuilt
 var (
 	// Retrieves all threads for the /all/ metaboard
 	getAllBoard = r.
 			Table("threads").
+			Filter(isOnBoardPage).
 			EqJoin("id", r.Table("posts")).
 			Zip().
 			Without(omitForBoards).
@@ -23,18 +27,38 @@ var (
 			Max().
 			Default(0)
 
+	// Filters out deleted threads and posts
+	isNotDeleted = func(doc r.Term) r.Term {
+		return doc.Field("deleted").Default(false).Not()
+	}
+
+	// Filters out deleted threads and threads archived either by staff or on
+	// expiry, which are only listed on archive pages
+	isOnBoardPage = func(thread r.Term) r.Term {
+		return isNotDeleted(thread).
+			And(thread.Field("archived").Default(false).Not()).
+			And(thread.HasFields("archivedAt").Not())
+	}
+
+	// Filters archived threads, that are not deleted
+	isArchived = func(thread r.Term) r.Term {
+		return isNotDeleted(thread).And(thread.Field("archived").Default(false))
+	}
+
 	mergeLastUpdated = map[string]r.Term{
 		"lastUpdated": getLastUpdated,
 	}
 
 	// Fields to omit in board queries. Decreases payload of DB replies.
 	omitForBoards = []string{
-		"body", "password", "commands", "links", "backlinks", "ip", "editing",
-		"op",
+		"body", "password", "commands", "links", "backlinks", "boardLinks",
+		"ip", "editing", "op", "log", "logTimes", "lease", "voters",
 	}
 
 	// Fields to omit for post queries
-	omitForPosts       = []string{"password", "ip", "lastUpdated"}
+	omitForPosts = []string{
+		"password", "ip", "lastUpdated", "log", "logTimes", "lease", "voters",
+	}
 	omitForThreadPosts = append(omitForPosts, []string{"op", "board"}...)
 )
 
@@ -49,6 +73,7 @@ func GetThread(id int64, lastN int) (*types.Thread, error) {
 	getPosts := r.
 		Table("posts").
 		GetAllByIndex("op", id).
+		Filter(isNotDeleted).
 		OrderBy("id").
 		CoerceTo("array")
 
@@ -77,10 +102,76 @@ func GetThread(id int64, lastN int) (*types.Thread, error) {
 	return &thread, nil
 }
 
-// GetPost reads a single post from the database
+// GetPost reads a single post from the database. Deleted posts are treated as
+// nonexistent.
 func GetPost(id int64) (post types.StandalonePost, err error) {
 	q := FindPost(id).Without(omitForPosts).Default(nil)
 	err = One(q, &post)
+	if err == nil && post.Deleted {
+		err = r.ErrEmptyResult
+	}
+	return
+}
+
+// PostReplay contains either the replication log entries of a post appended
+// since a certain time or the entire post, if the post was created after that
+// time or its log can not be replayed
+type PostReplay struct {
+	Post *types.Post `gorethink:"post"`
+	Log  [][]byte    `gorethink:"log"`
+}
+
+// GetReplay retrieves the replication log entries of all posts in a thread
+// appended after the since timestamp and before the until timestamp. Returns
+// the number of the log entries and full posts retrieved.
+//
+// Timestamps have a granularity of one second, so the client may or may not
+// have seen entries appended in the same second as since. Posts with such
+// entries are retrieved in full for the client to deduplicate.
+func GetReplay(op, since, until int64) (replay []PostReplay, n int, err error) {
+	q := r.
+		Table("posts").
+		GetAllByIndex("op", op).
+		Filter(func(p r.Term) r.Term {
+			lu := p.Field("lastUpdated")
+			return lu.Ge(since).And(lu.Lt(until))
+		}).
+		OrderBy("id").
+		Map(func(p r.Term) r.Term {
+			log := p.Field("log").Default([]interface{}{})
+			times := p.Field("logTimes").Default([]interface{}{})
+			missed := times.
+				Filter(func(t r.Term) r.Term {
+					return t.Gt(since)
+				}).
+				Count()
+
+			// Logs written before log entry times were recorded can only be
+			// replayed in their entirety
+			return r.Branch(
+				p.Field("time").Ge(since).Or(
+					times.Contains(since),
+					missed.Eq(times.Count()).And(times.Count().Lt(log.Count())),
+				),
+				map[string]interface{}{
+					"post": p.Without(omitForThreadPosts),
+				},
+				map[string]interface{}{
+					"log": log.Slice(log.Count().Sub(missed)),
+				},
+			)
+		})
+	if err = All(q, &replay); err != nil {
+		return
+	}
+
+	for _, p := range replay {
+		if p.Post != nil {
+			n++
+		} else {
+			n += len(p.Log)
+		}
+	}
 	return
 }
 
@@ -94,6 +185,7 @@ func GetBoard(board string) (*types.Board, error) {
 	q := r.
 		Table("threads").
 		GetAllByIndex("board", board).
+		Filter(isOnBoardPage).
 		EqJoin("id", r.Table("posts")).
 		Zip().
 		Without(omitForBoards).
@@ -104,6 +196,64 @@ func GetBoard(board string) (*types.Board, error) {
 	return out, err
 }
 
+// GetArchive retrieves a page of archived threads of a board, sorted by time
+// of archival and last reply time, newest first. Threads archived by staff are
+// listed last. Pass "all" to retrieve archived threads of all boards.
+func GetArchive(board string, page int) (*types.Board, error) {
+	q := r.Table("threads")
+	if board != "all" {
+		q = q.GetAllByIndex("board", board)
+	}
+	// Joins do not preserve order, so the page is sorted again after joining
+	order := []interface{}{
+		r.Desc(func(t r.Term) r.Term {
+			return t.Field("archivedAt").Default(0)
+		}),
+		r.Desc("replyTime"),
+	}
+	q = q.
+		Filter(isArchived).
+		OrderBy(order...).
+		Skip(page*ArchivePageSize).
+		Limit(ArchivePageSize).
+		EqJoin("id", r.Table("posts")).
+		Zip().
+		OrderBy(order...).
+		Without(omitForBoards).
+		Merge(mergeLastUpdated)
+	out := new(types.Board)
+	err := All(q, &out.Threads)
+	return out, err
+}
+
+// GetBoardThread retrieves a thread merged with the public fields of its OP
+// and the time of the thread's last update, as served on board pages
+func GetBoardThread(id int64) (thread types.BoardThread, err error) {
+	q := FindThread(id).Do(func(t r.Term) r.Term {
+		return r.Branch(t.Eq(nil), nil, mergeBoardThread(t))
+	})
+	err = One(q, &thread)
+	return
+}
+
+// Merges a document from the "threads" table with the public fields of its OP
+// and the time of the thread's last update. The result has the same shape as
+// the elements of board queries.
+func mergeBoardThread(thread r.Term) r.Term {
+	id := thread.Field("id")
+	op := r.Table("posts").Get(id).Without(omitForBoards)
+	return thread.
+		Merge(op.Default(map[string]interface{}{})).
+		Merge(map[string]r.Term{
+			"lastUpdated": r.
+				Table("posts").
+				GetAllByIndex("op", id).
+				Field("lastUpdated").
+				Max().
+				Default(0),
+		})
+}
+
 // GetAllBoard retrieves all threads for the "/all/" meta-board
 func GetAllBoard() (board *types.Board, err error) {
 	ctr, err := PostCounter()
@@ -59,6 +59,26 @@ func TestReader(t *testing.T) {
 			LastUpdated: 4,
 			Log:         [][]byte{{1}, {2}},
 		},
+		{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					ID: 5,
+				},
+				OP:    5,
+				Board: "c",
+			},
+			LastUpdated: 5,
+		},
+		{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					ID: 6,
+				},
+				OP:    6,
+				Board: "c",
+			},
+			LastUpdated: 6,
+		},
 	})
 
 	assertInsert(t, "threads", []types.DatabaseThread{
@@ -74,6 +94,23 @@ func TestReader(t *testing.T) {
 		},
 	})
 
+	// Archived on expiry
+	assertInsert(t, "threads", map[string]interface{}{
+		"id":         5,
+		"board":      "c",
+		"postCtr":    1,
+		"archived":   true,
+		"archivedAt": 10,
+	})
+
+	// Archived by staff
+	assertInsert(t, "threads", map[string]interface{}{
+		"id":       6,
+		"board":    "c",
+		"postCtr":  1,
+		"archived": true,
+	})
+
 	assertInsert(t, "main", []map[string]interface{}{
 		{
 			"id":      "info",
@@ -90,6 +127,7 @@ func TestReader(t *testing.T) {
 	t.Run("GetAllBoard", testGetAllBoard)
 	t.Run("GetBoard", testGetBoard)
 	t.Run("GetThread", testGetThread)
+	t.Run("GetArchive", testGetArchive)
 }
 
 func testGetPost(t *testing.T) {
@@ -194,6 +232,52 @@ func testGetBoard(t *testing.T) {
 	}
 }
 
+func testGetArchive(t *testing.T) {
+	t.Parallel()
+
+	archived := types.BoardThreads{
+		{
+			ID:          5,
+			PostCtr:     1,
+			Board:       "c",
+			Archived:    true,
+			ArchivedAt:  10,
+			LastUpdated: 5,
+		},
+		{
+			ID:          6,
+			PostCtr:     1,
+			Board:       "c",
+			Archived:    true,
+			LastUpdated: 6,
+		},
+	}
+
+	cases := [...]struct {
+		name, id string
+		page     int
+		std      types.BoardThreads
+	}{
+		{"board", "c", 0, archived},
+		{"all", "all", 0, archived},
+		{"no archived threads", "a", 0, nil},
+		{"past last page", "c", 1, nil},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			board, err := GetArchive(c.id, c.page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertDeepEquals(t, board.Threads, c.std)
+		})
+	}
+}
+
 func testGetThread(t *testing.T) {
 	t.Parallel()
 
@@ -268,3 +352,131 @@ func testGetThread(t *testing.T) {
 		})
 	}
 }
+
+func TestGetReplay(t *testing.T) {
+	assertTableClear(t, "posts")
+
+	posts := []map[string]interface{}{
+		{ // Entries before and after the timestamp
+			"id":          1,
+			"op":          1,
+			"time":        1,
+			"log":         [][]byte{{1}, {2}, {3}},
+			"logTimes":    []int64{5, 9, 15},
+			"lastUpdated": 15,
+		},
+		{ // Not updated since
+			"id":          2,
+			"op":          1,
+			"time":        1,
+			"log":         [][]byte{{1}},
+			"logTimes":    []int64{5},
+			"lastUpdated": 5,
+		},
+		{ // Created after the timestamp
+			"id":          3,
+			"op":          1,
+			"time":        11,
+			"body":        "foo",
+			"log":         [][]byte{{1}},
+			"logTimes":    []int64{11},
+			"lastUpdated": 11,
+		},
+		{ // Log entry times not recorded for some entries
+			"id":          4,
+			"op":          1,
+			"time":        1,
+			"body":        "bar",
+			"log":         [][]byte{{1}, {2}},
+			"logTimes":    []int64{12},
+			"lastUpdated": 12,
+		},
+		{ // Updated after the end timestamp
+			"id":          5,
+			"op":          1,
+			"time":        1,
+			"log":         [][]byte{{1}},
+			"logTimes":    []int64{30},
+			"lastUpdated": 30,
+		},
+		{ // Other thread
+			"id":          6,
+			"op":          6,
+			"time":        1,
+			"log":         [][]byte{{1}},
+			"logTimes":    []int64{12},
+			"lastUpdated": 12,
+		},
+		{ // Updated in the same second as the timestamp
+			"id":          7,
+			"op":          1,
+			"time":        1,
+			"body":        "baz",
+			"log":         [][]byte{{1}, {2}},
+			"logTimes":    []int64{5, 10},
+			"lastUpdated": 10,
+		},
+	}
+	assertInsert(t, "posts", posts)
+
+	replay, n, err := GetReplay(1, 10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []PostReplay{
+		{
+			Log: [][]byte{{3}},
+		},
+		{
+			Post: &types.Post{
+				ID:   3,
+				Time: 11,
+				Body: "foo",
+			},
+		},
+		{
+			Post: &types.Post{
+				ID:   4,
+				Time: 1,
+				Body: "bar",
+			},
+		},
+		{
+			Post: &types.Post{
+				ID:   7,
+				Time: 1,
+				Body: "baz",
+			},
+		},
+	}
+	AssertDeepEquals(t, replay, std)
+	if n != 4 {
+		LogUnexpected(t, 4, n)
+	}
+}
+
+func TestAppendLog(t *testing.T) {
+	assertTableClear(t, "posts")
+	assertInsert(t, "posts", map[string]interface{}{
+		"id": 1,
+	})
+
+	q := FindPost(1).Update(AppendLog(r.Row, []byte{1}, 5))
+	if err := Write(q); err != nil {
+		t.Fatal(err)
+	}
+
+	var res struct {
+		Log         [][]byte `gorethink:"log"`
+		LogTimes    []int64  `gorethink:"logTimes"`
+		LastUpdated int64    `gorethink:"lastUpdated"`
+	}
+	if err := One(FindPost(1), &res); err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, res.Log, [][]byte{{1}})
+	AssertDeepEquals(t, res.LogTimes, []int64{5})
+	if res.LastUpdated != 5 {
+		LogUnexpected(t, 5, res.LastUpdated)
+	}
+}
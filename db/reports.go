@@ -0,0 +1,52 @@
+// Post report storage and retrieval
+
+package db
+
+import (
+	"time"
+
+	"github.com/bakape/meguca/types"
+	r "github.com/dancannon/gorethink"
+)
+
+// InsertReport writes a new post report with the current time to the database
+func InsertReport(report types.Report) error {
+	report.Time = time.Now().Unix()
+	return Insert("reports", report)
+}
+
+// GetReports retrieves all unresolved reports on a board, oldest first
+func GetReports(board string) (reports []types.Report, err error) {
+	q := r.
+		Table("reports").
+		GetAllByIndex("board", board).
+		OrderBy("time")
+	err = All(q, &reports)
+	if reports == nil {
+		reports = []types.Report{}
+	}
+	return
+}
+
+// GetReport retrieves a single report by ID
+func GetReport(id string) (report types.Report, err error) {
+	err = One(r.Table("reports").Get(id).Default(nil), &report)
+	return
+}
+
+// DeleteReport deletes a single report by ID
+func DeleteReport(id string) error {
+	return Write(r.Table("reports").Get(id).Delete())
+}
+
+// DeleteReportsOnPost deletes all reports targeting the specified post
+func DeleteReportsOnPost(board string, post int64) error {
+	q := r.
+		Table("reports").
+		GetAllByIndex("board", board).
+		Filter(map[string]int64{
+			"target": post,
+		}).
+		Delete()
+	return Write(q)
+}
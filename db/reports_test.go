@@ -0,0 +1,28 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/bakape/meguca/types"
+)
+
+func TestDeleteReportsOnPost(t *testing.T) {
+	assertTableClear(t, "reports")
+	assertInsert(t, "reports", []types.Report{
+		{ID: "1", Target: 1, Board: "a"},
+		{ID: "2", Target: 1, Board: "a"},
+		{ID: "3", Target: 2, Board: "a"},
+	})
+
+	if err := DeleteReportsOnPost("a", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := GetReports("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].ID != "3" {
+		t.Errorf("unexpected remaining reports: %#v", reports)
+	}
+}
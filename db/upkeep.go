@@ -26,14 +26,16 @@ var postClosingQuery = r.
 	Table("posts").
 	GetAllByIndex("editing", true). // Older than 30 minutes
 	Filter(r.Row.Field("time").Lt(r.Now().ToEpochTime().Sub(1800))).
-	Update(map[string]interface{}{
-		"log": r.Row.Field("log").Append(r.
+	Update(func(p r.Term) r.Term {
+		msg := r.
 			Expr("06").
-			Add(r.Row.Field("id").CoerceTo("string")).
-			CoerceTo("binary"),
-		),
-		"editing":     false,
-		"lastUpdated": r.Now().ToEpochTime().Floor(),
+			Add(p.Field("id").CoerceTo("string")).
+			CoerceTo("binary")
+		return r.
+			Expr(AppendLog(p, msg, r.Now().ToEpochTime().Floor())).
+			Merge(map[string]bool{
+				"editing": false,
+			})
 	})
 
 var expireImageTokensQuery = r.
@@ -49,6 +51,27 @@ var expireImageTokensQuery = r.
 		)
 	})
 
+var expireBansQuery = r.
+	Table("bans").
+	Between(r.MinVal, r.Now(), r.BetweenOpts{
+		Index: "expires",
+	}).
+	Delete()
+
+var expireCaptchasQuery = r.
+	Table("captchas").
+	Between(r.MinVal, r.Now(), r.BetweenOpts{
+		Index: "expires",
+	}).
+	Delete()
+
+var expirePresenceQuery = r.
+	Table("presence").
+	Between(r.MinVal, r.Now(), r.BetweenOpts{
+		Index: "expires",
+	}).
+	Delete()
+
 // Run database clean up tasks at server start and regular intervals. Must be
 // launched in separate goroutine.
 func runCleanupTasks() {
@@ -72,12 +95,16 @@ func runCleanupTasks() {
 func runMinuteTasks() {
 	logError("open post cleanup", closeDanglingPosts())
 	logError("expire image tokens", expireImageTokens())
+	logError("expire bans", expireBans())
+	logError("expire captchas", expireCaptchas())
+	logError("expire presence", expirePresence())
 }
 
 func runHourTasks() {
 	logError("session cleanup", expireUserSessions())
 	logError("board cleanup", deleteUnusedBoards())
 	logError("thread cleanup", deleteOldThreads())
+	logError("archive cleanup", purgeArchivedThreads())
 }
 
 func logError(prefix string, err error) {
@@ -96,6 +123,22 @@ func closeDanglingPosts() error {
 	return Write(postClosingQuery)
 }
 
+// Remove any bans, that have already expired
+func expireBans() error {
+	return Write(expireBansQuery)
+}
+
+// Remove any unsolved captchas, that have already expired
+func expireCaptchas() error {
+	return Write(expireCaptchasQuery)
+}
+
+// Remove presence documents of server instances, that have stopped sending
+// heartbeats
+func expirePresence() error {
+	return Write(expirePresenceQuery)
+}
+
 // Remove any expired image tokens and decrement or deallocate their target
 // image's assets
 func expireImageTokens() error {
@@ -114,38 +157,43 @@ func expireImageTokens() error {
 }
 
 // Delete boards that are older than 1 week and have not had any new posts for
-// N days.
+// N days. If thread archiving is enabled, boards are only deleted after all of
+// their archived threads have been purged.
 func deleteUnusedBoards() error {
 	conf := config.Get()
 	if !conf.PruneBoards {
 		return nil
 	}
 
-	q := r.
-		Table("boards").
-		Filter(r.
-			Row.
-			Field("created").
-			Lt(r.Now().Sub(day * conf.BoardExpiry)).
-			And(r.
-				Table("posts").
-				GetAllByIndex("board", r.Row.Field("id")).
-				Pluck("time").
-				OrderBy("time").
-				Nth(-1).
-				Field("time").
-				Lt(r.Now().ToEpochTime().Sub(day * conf.BoardExpiry)).
-				Default(true),
-			),
-		).
-		Field("id")
+	expired := r.
+		Row.
+		Field("created").
+		Lt(r.Now().Sub(day * conf.BoardExpiry)).
+		And(r.
+			Table("posts").
+			GetAllByIndex("board", r.Row.Field("id")).
+			Pluck("time").
+			OrderBy("time").
+			Nth(-1).
+			Field("time").
+			Lt(r.Now().ToEpochTime().Sub(day * conf.BoardExpiry)).
+			Default(true),
+		)
+	if conf.ArchiveThreads {
+		expired = expired.And(r.
+			Table("threads").
+			GetAllByIndex("board", r.Row.Field("id")).
+			IsEmpty(),
+		)
+	}
+	q := r.Table("boards").Filter(expired).Field("id")
 
-	var expired []string
-	if err := All(q, &expired); err != nil {
+	var boards []string
+	if err := All(q, &boards); err != nil {
 		return err
 	}
 
-	for _, board := range expired {
+	for _, board := range boards {
 		var threads []int64
 		q := r.Table("threads").GetAllByIndex("board", board).Field("id")
 		if err := All(q, &threads); err != nil {
@@ -169,7 +217,9 @@ func deleteUnusedBoards() error {
 	return nil
 }
 
-// Delete threads that have not had any new posts in N days.
+// Delete threads that have not had any new posts in N days. If thread
+// archiving is enabled, the threads are archived instead. Archived threads are
+// exempt.
 func deleteOldThreads() error {
 	conf := config.Get()
 	if !conf.PruneThreads {
@@ -187,6 +237,14 @@ func deleteOldThreads() error {
 			Lt(r.Now().ToEpochTime().Sub(day * conf.ThreadExpiry)),
 		).
 		Field("group").
+		Filter(func(id r.Term) r.Term { // Archived threads never expire
+			return r.
+				Table("threads").
+				Get(id).
+				Field("archived").
+				Default(false).
+				Not()
+		}).
 		Default(nil)
 
 	var expired []int64
@@ -194,6 +252,113 @@ func deleteOldThreads() error {
 		return err
 	}
 
+	for _, t := range expired {
+		var err error
+		if conf.ArchiveThreads {
+			err = ArchiveThread(t)
+		} else {
+			err = DeleteThread(t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EncodeArchiveMessage encodes the message notifying clients of the archival of
+// a thread. Assigned by the websockets package, which owns the message
+// encoding.
+var EncodeArchiveMessage func(id int64) ([]byte, error)
+
+// ArchiveThread marks a thread as archived and read-only and records the time
+// of archival. Threads archived this way are removed from board pages and
+// deleted after the archive expiry time. Clients synced to the thread are
+// notified through the replication log of the opening post.
+func ArchiveThread(id int64) error {
+	msg, err := EncodeArchiveMessage(id)
+	if err != nil {
+		return err
+	}
+
+	now := r.Now().ToEpochTime().Floor()
+	q := FindThread(id).Update(map[string]interface{}{
+		"archived":   true,
+		"archivedAt": now,
+	})
+	if err := Write(q); err != nil {
+		return err
+	}
+
+	q = FindPost(id).Update(func(p r.Term) r.Term {
+		return r.Expr(AppendLog(p, msg, now))
+	})
+	return Write(q)
+}
+
+// TrimBoard deletes the least recently bumped threads of a board, that exceed
+// the board's thread limit. If thread archiving is enabled, the threads are
+// archived instead. Sticky threads are exempt.
+func TrimBoard(board string, max uint) error {
+	q := r.
+		Table("threads").
+		GetAllByIndex("board", board).
+		Filter(isOnBoardPage).
+		OrderBy(
+			r.Desc(func(t r.Term) r.Term {
+				return t.Field("sticky").Default(false)
+			}),
+			r.Desc("replyTime"),
+		).
+		Skip(max).
+		Filter(r.Row.Field("sticky").Default(false).Not()).
+		Field("id")
+
+	var excess []int64
+	if err := All(q, &excess); err != nil {
+		return err
+	}
+
+	archive := config.Get().ArchiveThreads
+	for _, t := range excess {
+		var err error
+		if archive {
+			err = ArchiveThread(t)
+		} else {
+			err = DeleteThread(t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete threads, that have been archived on expiry for longer than N days.
+// Threads archived by staff are exempt.
+func purgeArchivedThreads() error {
+	conf := config.Get()
+	if !conf.PruneThreads {
+		return nil
+	}
+
+	q := r.
+		Table("threads").
+		Filter(func(t r.Term) r.Term {
+			return t.Field("archived").Default(false).And(t.
+				Field("archivedAt").
+				Lt(r.Now().ToEpochTime().Sub(day * conf.ArchiveExpiry)).
+				Default(false),
+			)
+		}).
+		Field("id")
+	var expired []int64
+	if err := All(q, &expired); err != nil {
+		return err
+	}
+
 	for _, t := range expired {
 		if err := DeleteThread(t); err != nil {
 			return err
@@ -198,6 +198,87 @@ func TestImageTokenExpiry(t *testing.T) {
 	}
 }
 
+func TestExpireBans(t *testing.T) {
+	assertTableClear(t, "bans")
+	assertInsert(t, "bans", []auth.Ban{
+		{
+			ID:      "1",
+			Board:   "a",
+			Expires: time.Now().Add(-time.Minute),
+		},
+		{
+			ID:      "2",
+			Board:   "a",
+			Expires: time.Now().Add(time.Minute),
+		},
+	})
+
+	if err := expireBans(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	if err := All(r.Table("bans").Field("id"), &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "2" {
+		t.Errorf("unexpected remaining bans: %v", ids)
+	}
+}
+
+func TestExpireCaptchas(t *testing.T) {
+	assertTableClear(t, "captchas")
+	assertInsert(t, "captchas", []captchaDocument{
+		{
+			ID:      "1",
+			Expires: time.Now().Add(-time.Minute),
+		},
+		{
+			ID:      "2",
+			Expires: time.Now().Add(time.Minute),
+		},
+	})
+
+	if err := expireCaptchas(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	if err := All(r.Table("captchas").Field("id"), &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "2" {
+		t.Errorf("unexpected remaining captchas: %v", ids)
+	}
+}
+
+func TestExpirePresence(t *testing.T) {
+	assertTableClear(t, "presence")
+	for _, id := range [...]string{"1", "2"} {
+		if err := WritePresence(id, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expire := r.Table("presence").Get("1").Update(map[string]time.Time{
+		"expires": time.Now().Add(-time.Second),
+	})
+	if err := Write(expire); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := expirePresence(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	if err := All(r.Table("presence").Field("id"), &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "2" {
+		t.Errorf("unexpected remaining presence: %v", ids)
+	}
+}
+
 func TestDeleteThread(t *testing.T) {
 	assertTableClear(t, "threads", "posts", "images")
 
@@ -522,6 +603,10 @@ func TestDeleteOldThreads(t *testing.T) {
 		{ID: 1},
 		{ID: 2},
 	})
+	assertInsert(t, "threads", map[string]interface{}{
+		"id":       3,
+		"archived": true,
+	})
 	assertInsert(t, "posts", []types.DatabasePost{
 		{
 			StandalonePost: types.StandalonePost{
@@ -532,6 +617,15 @@ func TestDeleteOldThreads(t *testing.T) {
 				OP: 1,
 			},
 		},
+		{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					ID:   3,
+					Time: time.Now().Add(-eightDays).Unix(),
+				},
+				OP: 3,
+			},
+		},
 		{
 			StandalonePost: types.StandalonePost{
 				Post: types.Post{
@@ -557,9 +651,199 @@ func TestDeleteOldThreads(t *testing.T) {
 		if err := deleteOldThreads(); err != nil {
 			t.Fatal(err)
 		}
-		for i := int64(1); i <= 2; i++ {
+		for i := int64(1); i <= 3; i++ {
+			assertDeleted(t, FindPost(i), i == 1)
+			assertDeleted(t, FindThread(i), i == 1)
+		}
+	})
+}
+
+func TestArchiveOldThreads(t *testing.T) {
+	assertTableClear(t, "posts", "threads")
+	config.Set(config.Configs{
+		ThreadExpiry:   7,
+		PruneThreads:   true,
+		ArchiveThreads: true,
+	})
+	assertInsert(t, "threads", []types.DatabaseThread{
+		{ID: 1},
+		{ID: 2},
+	})
+	assertInsert(t, "posts", []types.DatabasePost{
+		{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					ID:   1,
+					Time: time.Now().Add(-eightDays).Unix(),
+				},
+				OP: 1,
+			},
+		},
+		{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					ID:   2,
+					Time: time.Now().Unix(),
+				},
+				OP: 2,
+			},
+		},
+	})
+
+	if err := deleteOldThreads(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := int64(1); i <= 2; i++ {
+		assertDeleted(t, FindThread(i), false)
+		assertDeleted(t, FindPost(i), false)
+
+		var archived bool
+		q := FindThread(i).HasFields("archived", "archivedAt")
+		if err := One(q, &archived); err != nil {
+			t.Fatal(err)
+		}
+		if archived != (i == 1) {
+			t.Errorf("unexpected archival state of thread %d: %t", i, archived)
+		}
+	}
+
+	var log [][]byte
+	if err := All(FindPost(1).Field("log"), &log); err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, log, [][]byte{[]byte(`15{"id":1,"val":true}`)})
+}
+
+func TestPurgeArchivedThreads(t *testing.T) {
+	assertTableClear(t, "posts", "threads")
+	config.Set(config.Configs{
+		ArchiveExpiry: 7,
+	})
+	expired := time.Now().Add(-eightDays).Unix()
+	assertInsert(t, "threads", []map[string]interface{}{
+		{
+			"id":         1,
+			"archived":   true,
+			"archivedAt": expired,
+		},
+		{
+			"id":         2,
+			"archived":   true,
+			"archivedAt": time.Now().Unix(),
+		},
+		{
+			// Archived by staff
+			"id":       3,
+			"archived": true,
+		},
+		{
+			// Unarchived by staff
+			"id":         4,
+			"archivedAt": expired,
+		},
+	})
+	for i := int64(1); i <= 4; i++ {
+		assertInsert(t, "posts", types.DatabasePost{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					ID: i,
+				},
+				OP: i,
+			},
+		})
+	}
+
+	t.Run("pruning disabled", func(t *testing.T) {
+		if err := purgeArchivedThreads(); err != nil {
+			t.Fatal(err)
+		}
+		assertDeleted(t, FindThread(1), false)
+	})
+
+	t.Run("purged", func(t *testing.T) {
+		(*config.Get()).PruneThreads = true
+		if err := purgeArchivedThreads(); err != nil {
+			t.Fatal(err)
+		}
+		for i := int64(1); i <= 4; i++ {
 			assertDeleted(t, FindPost(i), i == 1)
 			assertDeleted(t, FindThread(i), i == 1)
 		}
 	})
 }
+
+func TestTrimBoard(t *testing.T) {
+	assertTableClear(t, "posts", "threads")
+	config.Set(config.Configs{})
+	assertInsert(t, "threads", []map[string]interface{}{
+		{
+			"id":        1,
+			"board":     "a",
+			"replyTime": 1,
+			"sticky":    true,
+		},
+		{
+			"id":        2,
+			"board":     "a",
+			"replyTime": 2,
+		},
+		{
+			"id":        3,
+			"board":     "a",
+			"replyTime": 3,
+		},
+		{
+			"id":        4,
+			"board":     "a",
+			"replyTime": 4,
+		},
+		{
+			"id":        5,
+			"board":     "c",
+			"replyTime": 0,
+		},
+	})
+	for i := int64(1); i <= 5; i++ {
+		assertInsert(t, "posts", types.DatabasePost{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					ID: i,
+				},
+				OP: i,
+			},
+		})
+	}
+
+	if err := TrimBoard("a", 3); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 5; i++ {
+		assertDeleted(t, FindThread(i), i == 2)
+		assertDeleted(t, FindPost(i), i == 2)
+	}
+
+	t.Run("archive", func(t *testing.T) {
+		(*config.Get()).ArchiveThreads = true
+		if err := TrimBoard("a", 1); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := int64(1); i <= 4; i++ {
+			if i == 2 {
+				continue
+			}
+			var archived bool
+			q := FindThread(i).HasFields("archivedAt")
+			if err := One(q, &archived); err != nil {
+				t.Fatal(err)
+			}
+			if archived != (i != 1) {
+				t.Errorf(
+					"unexpected archival state of thread %d: %t",
+					i, archived,
+				)
+			}
+		}
+	})
+}
@@ -128,6 +128,20 @@ func newImageUpload(req *http.Request) (int, string, error) {
 		return 400, "", err
 	}
 
+	// Uploads are not bound to a board, until allocated to a post. Only check
+	// bans on the board, if the client specified one.
+	board := req.FormValue("board")
+	if board == "" {
+		board = "all"
+	}
+	_, banned, err := db.IsBanned(board, auth.GetIP(req))
+	if err != nil {
+		return 500, "", err
+	}
+	if banned {
+		return 403, "", auth.ErrBanned
+	}
+
 	// TODO: A scheduler based on available RAM, so we don't run out of memory,
 	// with concurrent burst loads.
 
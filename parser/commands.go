@@ -1,11 +1,13 @@
-// Hash commands such as #flip, dice and #8ball
+// Hash commands such as #flip, dice, #8ball, #poll and board-defined commands
 
 package parser
 
 import (
 	"bytes"
+	"errors"
 	"math/rand"
 	"regexp"
+	"sort"
 	"strconv"
 	"time"
 
@@ -16,15 +18,29 @@ import (
 )
 
 var (
-	diceRegexp = regexp.MustCompile(`(\d*)d(\d+)`)
+	diceRegexp = regexp.MustCompile(
+		`^(\d{0,3})d(\d{1,5})(?:k([hl])(\d{1,3}))?(?:([+-])(\d{1,5}))?$`,
+	)
+	syncWatchRegexp = regexp.MustCompile(
+		`^syncwatch(?:(\d{1,2}):)?(\d{1,2}):(\d{1,2})(?: \+(\d{1,4}))?$`,
+	)
+	customCommandRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]{0,19}$`)
 
 	errTooManyRolls = diceError(0)
 	errDieTooBig    = diceError(1)
+	errInvalidDice  = diceError(2)
+
+	errInvalidCommandName = errors.New("invalid custom command name")
+	errInvalidCommandType = errors.New("invalid custom command type")
+	errDuplicateCommand   = errors.New("duplicate custom command")
+	errNoAnswers          = errors.New("custom command has no answers")
 
 	flipCommand      = []byte("flip")
 	eightballCommand = []byte("8ball")
 	pyuCommand       = []byte("pyu")
 	pcountCommand    = []byte("pcount")
+	syncWatchCommand = []byte("syncwatch")
+	pollCommand      = []byte("poll")
 
 	pcountQuery = db.GetMain("info").Field("pyu").Default(0)
 
@@ -56,9 +72,6 @@ func init() {
 
 // Parse a matched hash command
 func parseCommand(match []byte, board string) (types.Command, error) {
-
-	// TODO: #syncwatch
-
 	var com types.Command
 	switch {
 
@@ -106,52 +119,226 @@ func parseCommand(match []byte, board string) (types.Command, error) {
 		com.Val = res
 		return com, err
 
+	// Poll. Options are parsed from the following lines of the post and
+	// written, as each line is committed.
+	case bytes.Equal(match, pollCommand):
+		com.Type = types.Poll
+		com.Val = types.PollData{
+			Options: []string{},
+			Votes:   []uint{},
+		}
+		return com, nil
+
+	// Synchronised timer
+	case bytes.HasPrefix(match, syncWatchCommand):
+		if val, ok := parseSyncWatch(match, time.Now().Unix()); ok {
+			com.Type = types.SyncWatch
+			com.Val = val
+		}
+		return com, nil
+
 	// Dice throw
-	default:
-		val, err := parseDice(match)
+	case diceRegexp.Match(match):
+		val, err := parseDice(match, board)
 		switch err {
 		case nil:
 			com.Type = types.Dice
 			com.Val = val
 			return com, nil
-		case errTooManyRolls, errDieTooBig: // Consider command invalid
+		case errTooManyRolls, errDieTooBig, errInvalidDice:
+			// Consider command invalid
 			return com, nil
 		default:
 			return com, err
 		}
+
+	// Board-defined commands
+	default:
+		return parseCustomCommand(string(match), board)
 	}
 }
 
-// Parse dice throw commands
-func parseDice(match []byte) ([]uint16, error) {
-	dice := diceRegexp.FindSubmatch(match)
+// Parse a board-defined hash command. Returns an empty command, if the board
+// has no such command.
+func parseCustomCommand(name, board string) (com types.Command, err error) {
+	for _, c := range config.GetBoardConfigs(board).Commands {
+		if c.Name != name {
+			continue
+		}
+		switch c.Type {
+		case config.CustomRandom:
+			if len(c.Answers) != 0 {
+				com.Type = types.CustomAnswer
+				com.Val = types.CustomCommandResult{
+					Name: name,
+					Val:  c.Answers[rand.Intn(len(c.Answers))],
+				}
+			}
+		case config.CustomCounter:
+			var res int
+			err = db.One(customCounterQuery(board, name), &res)
+			com.Type = types.CustomCounter
+			com.Val = types.CustomCommandResult{
+				Name: name,
+				Val:  res,
+			}
+		}
+		return
+	}
+	return
+}
 
-	var rolls int
-	if len(dice[1]) == 0 {
-		rolls = 1
-	} else {
-		var err error
-		rolls, err = strconv.Atoi(string(dice[1]))
-		if err != nil {
-			return nil, err
+// Increment a board's custom command counter and return its new value
+func customCounterQuery(board, name string) r.Term {
+	return db.
+		GetMain("info").
+		Update(
+			func(info r.Term) map[string]interface{} {
+				return map[string]interface{}{
+					"commandCtrs": map[string]interface{}{
+						board: map[string]r.Term{
+							name: info.
+								Field("commandCtrs").
+								Field(board).
+								Field(name).
+								Default(0).
+								Add(1),
+						},
+					},
+				}
+			},
+			r.UpdateOpts{
+				ReturnChanges: true,
+			},
+		).
+		Field("changes").
+		AtIndex(0).
+		Field("new_val").
+		Field("commandCtrs").
+		Field(board).
+		Field(name)
+}
+
+// ValidateCommands validates the names and types of board-defined hash
+// commands. Names must not shadow built-in commands.
+func ValidateCommands(commands []config.CustomCommand) error {
+	names := make(map[string]bool, len(commands))
+	for _, c := range commands {
+		if names[c.Name] {
+			return errDuplicateCommand
+		}
+		names[c.Name] = true
+
+		name := []byte(c.Name)
+		invalid := !customCommandRegexp.Match(name) ||
+			diceRegexp.Match(name) ||
+			bytes.HasPrefix(name, syncWatchCommand)
+		for _, b := range [...][]byte{
+			flipCommand, eightballCommand, pyuCommand, pcountCommand,
+			pollCommand,
+		} {
+			if bytes.Equal(name, b) {
+				invalid = true
+			}
 		}
-		if rolls > 10 {
-			return nil, errTooManyRolls
+		if invalid {
+			return errInvalidCommandName
+		}
+
+		switch c.Type {
+		case config.CustomRandom:
+			if len(c.Answers) == 0 {
+				return errNoAnswers
+			}
+		case config.CustomCounter:
+		default:
+			return errInvalidCommandType
 		}
 	}
+	return nil
+}
 
-	max, err := strconv.Atoi(string(dice[2]))
-	if err != nil {
-		return nil, err
+// Parse dice throw commands of the form [N]dM[khK|klK][+X|-X]. khK and klK
+// keep only the K highest or lowest rolls. X is added to or subtracted from
+// the total.
+func parseDice(match []byte, board string) (val types.DiceRoll, err error) {
+	dice := diceRegexp.FindSubmatch(match)
+	maxRolls, maxSides := config.GetBoardConfigs(board).DiceLimits()
+
+	// All numbers are limited in length by the regex, so can not overflow
+	atoi := func(b []byte, def int) int {
+		if len(b) == 0 {
+			return def
+		}
+		i, _ := strconv.Atoi(string(b))
+		return i
 	}
-	if max > 100 {
-		return nil, errDieTooBig
+	rolls := atoi(dice[1], 1)
+	sides := atoi(dice[2], 0)
+	keep := atoi(dice[4], rolls)
+	val.Modifier = atoi(dice[6], 0)
+	if string(dice[5]) == "-" {
+		val.Modifier = -val.Modifier
 	}
 
-	val := make([]uint16, rolls)
-	for i := 0; i < rolls; i++ {
-		val[i] = uint16(rand.Intn(max)) + 1
+	switch {
+	case rolls > maxRolls:
+		return val, errTooManyRolls
+	case sides > maxSides:
+		return val, errDieTooBig
+	case rolls == 0, sides == 0, keep == 0, keep > rolls,
+		val.Modifier > config.MaxDiceModifier,
+		val.Modifier < -config.MaxDiceModifier:
+		return val, errInvalidDice
+	}
+
+	val.Rolls = make([]uint16, rolls)
+	for i := range val.Rolls {
+		val.Rolls[i] = uint16(rand.Intn(sides)) + 1
+	}
+
+	kept := make([]int, rolls)
+	for i, r := range val.Rolls {
+		kept[i] = int(r)
+	}
+	sort.Ints(kept)
+	if string(dice[3]) == "h" {
+		kept = kept[rolls-keep:]
+	} else {
+		kept = kept[:keep]
+	}
+	val.Total = val.Modifier
+	for _, r := range kept {
+		val.Total += r
 	}
 
 	return val, nil
 }
+
+// Parse a #syncwatch[hours:]minutes:seconds [+offset] command into the Unix
+// timestamps of the timer's start and end. The timer starts offset seconds
+// after now. Returns false, if the duration is invalid.
+func parseSyncWatch(match []byte, now int64) ([2]int64, bool) {
+	m := syncWatchRegexp.FindSubmatch(match)
+	if m == nil {
+		return [2]int64{}, false
+	}
+
+	var parts [4]int64
+	for i := range parts {
+		if len(m[i+1]) != 0 {
+			parts[i], _ = strconv.ParseInt(string(m[i+1]), 10, 64)
+		}
+	}
+	hours, minutes, seconds, offset := parts[0], parts[1], parts[2], parts[3]
+	if seconds > 59 || (len(m[1]) != 0 && minutes > 59) {
+		return [2]int64{}, false
+	}
+	duration := hours*3600 + minutes*60 + seconds
+	if duration == 0 {
+		return [2]int64{}, false
+	}
+
+	start := now + offset
+	return [2]int64{start, start + duration}, true
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/bakape/meguca/config"
@@ -26,23 +27,44 @@ func TestFlip(t *testing.T) {
 }
 
 func TestDice(t *testing.T) {
-	t.Parallel()
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID: "tg",
+		BoardPublic: config.BoardPublic{
+			PostParseConfigs: config.PostParseConfigs{
+				MaxDice:     20,
+				MaxDieSides: 1000,
+			},
+		},
+	})
 
 	cases := [...]struct {
-		name, in   string
-		isNil      bool
-		rolls, max int
+		name, in, board string
+		isNil           bool
+		rolls, max      int
+		modifier, keep  int
+		highest         bool
 	}{
-		{"too many sides", `d101`, true, 0, 0},
-		{"too many dice", `11d100`, true, 0, 0},
-		{"too many dice and sides", `11d101`, true, 0, 0},
-		{"valid single die", `d10`, false, 1, 10},
-		{"valid multiple dice", `10d100`, false, 10, 100},
+		{"too many sides", `d101`, "a", true, 0, 0, 0, 0, false},
+		{"too many dice", `11d100`, "a", true, 0, 0, 0, 0, false},
+		{"too many dice and sides", `11d101`, "a", true, 0, 0, 0, 0, false},
+		{"zero sides", `d0`, "a", true, 0, 0, 0, 0, false},
+		{"zero dice", `0d6`, "a", true, 0, 0, 0, 0, false},
+		{"keep too many", `2d6kh3`, "a", true, 0, 0, 0, 0, false},
+		{"keep none", `2d6kl0`, "a", true, 0, 0, 0, 0, false},
+		{"modifier too big", `d6+10001`, "a", true, 0, 0, 0, 0, false},
+		{"valid single die", `d10`, "a", false, 1, 10, 0, 1, true},
+		{"valid multiple dice", `10d100`, "a", false, 10, 100, 0, 10, true},
+		{"modifier", `2d20+5`, "a", false, 2, 20, 5, 2, true},
+		{"negative modifier", `d20-3`, "a", false, 1, 20, -3, 1, true},
+		{"keep highest", `4d6kh3`, "a", false, 4, 6, 0, 3, true},
+		{"keep lowest", `2d20kl1+2`, "a", false, 2, 20, 2, 1, false},
+		{"board limits", `20d1000`, "tg", false, 20, 1000, 0, 20, true},
+		{"over board limits", `21d1000`, "tg", true, 0, 0, 0, 0, false},
 	}
 	for i := range cases {
 		c := cases[i]
 		t.Run(c.name, func(t *testing.T) {
-			com, err := parseCommand([]byte(c.in), "a")
+			com, err := parseCommand([]byte(c.in), c.board)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -50,19 +72,123 @@ func TestDice(t *testing.T) {
 				if com.Val != nil {
 					t.Fatalf("unexpected value: %#v", com.Val)
 				}
-			} else {
-				if com.Type != types.Dice {
-					t.Fatalf("unexpected command type: %d", com.Type)
-				}
-				val := com.Val.([]uint16)
-				if l := len(val); l != c.rolls {
-					LogUnexpected(t, c.rolls, l)
+				return
+			}
+
+			if com.Type != types.Dice {
+				t.Fatalf("unexpected command type: %d", com.Type)
+			}
+			val := com.Val.(types.DiceRoll)
+			if l := len(val.Rolls); l != c.rolls {
+				LogUnexpected(t, c.rolls, l)
+			}
+			if val.Modifier != c.modifier {
+				LogUnexpected(t, c.modifier, val.Modifier)
+			}
+
+			kept := make([]int, 0, len(val.Rolls))
+			for _, r := range val.Rolls {
+				if r < 1 || int(r) > c.max {
+					t.Fatalf("roll out of range: %d", r)
 				}
+				kept = append(kept, int(r))
+			}
+			sort.Ints(kept)
+			if c.highest {
+				kept = kept[len(kept)-c.keep:]
+			} else {
+				kept = kept[:c.keep]
+			}
+			total := c.modifier
+			for _, r := range kept {
+				total += r
+			}
+			if val.Total != total {
+				LogUnexpected(t, total, val.Total)
 			}
 		})
 	}
 }
 
+func TestSyncWatch(t *testing.T) {
+	t.Parallel()
+
+	const now = 1000
+	cases := [...]struct {
+		name, in string
+		valid    bool
+		val      [2]int64
+	}{
+		{"minutes and seconds", "syncwatch24:00", true, [2]int64{1000, 2440}},
+		{"with hours", "syncwatch1:02:03", true, [2]int64{1000, 4723}},
+		{"with offset", "syncwatch0:10 +20", true, [2]int64{1020, 1030}},
+		{"no time", "syncwatch", false, [2]int64{}},
+		{"too many seconds", "syncwatch1:60", false, [2]int64{}},
+		{"too many minutes", "syncwatch1:60:00", false, [2]int64{}},
+		{"zero duration", "syncwatch0:00", false, [2]int64{}},
+		{"invalid offset", "syncwatch1:00 20", false, [2]int64{}},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			val, ok := parseSyncWatch([]byte(c.in), now)
+			if ok != c.valid {
+				t.Fatalf("unexpected validity: %t", ok)
+			}
+			if val != c.val {
+				LogUnexpected(t, c.val, val)
+			}
+		})
+	}
+
+	t.Run("command", func(t *testing.T) {
+		t.Parallel()
+
+		com, err := parseCommand([]byte("syncwatch1:00"), "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if com.Type != types.SyncWatch {
+			t.Fatalf("unexpected command type: %d", com.Type)
+		}
+		val := com.Val.([2]int64)
+		if d := val[1] - val[0]; d != 60 {
+			LogUnexpected(t, 60, d)
+		}
+	})
+
+	t.Run("invalid command", func(t *testing.T) {
+		t.Parallel()
+
+		com, err := parseCommand([]byte("syncwatch1:60"), "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if com.Val != nil {
+			t.Fatalf("unexpected value: %#v", com.Val)
+		}
+	})
+}
+
+func TestPoll(t *testing.T) {
+	t.Parallel()
+
+	com, err := parseCommand([]byte("poll"), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, com, types.Command{
+		Type: types.Poll,
+		Val: types.PollData{
+			Options: []string{},
+			Votes:   []uint{},
+		},
+	})
+}
+
 func Test8ball(t *testing.T) {
 	answers := []string{"Yes", "No"}
 	config.SetBoardConfigs(config.BoardConfigs{
@@ -127,3 +253,178 @@ func TestPyu(t *testing.T) {
 		}
 	})
 }
+
+func TestCustomCommands(t *testing.T) {
+	assertTableClear(t, "main")
+	assertInsert(t, "main", db.Document{ID: "info"})
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID: "q",
+		Commands: []config.CustomCommand{
+			{
+				Name:    "quote",
+				Type:    config.CustomRandom,
+				Answers: []string{"foo"},
+			},
+			{
+				Name: "counter",
+				Type: config.CustomCounter,
+			},
+		},
+	})
+
+	cases := [...]struct {
+		name, in, board string
+		com             types.Command
+	}{
+		{
+			"random answer", "quote", "q",
+			types.Command{
+				Type: types.CustomAnswer,
+				Val: types.CustomCommandResult{
+					Name: "quote",
+					Val:  "foo",
+				},
+			},
+		},
+		{
+			"increment counter", "counter", "q",
+			types.Command{
+				Type: types.CustomCounter,
+				Val: types.CustomCommandResult{
+					Name: "counter",
+					Val:  1,
+				},
+			},
+		},
+		{
+			"increment counter again", "counter", "q",
+			types.Command{
+				Type: types.CustomCounter,
+				Val: types.CustomCommandResult{
+					Name: "counter",
+					Val:  2,
+				},
+			},
+		},
+		{"no such command", "rank", "q", types.Command{}},
+		{"other board", "quote", "a", types.Command{}},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			com, err := parseCommand([]byte(c.in), c.board)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertDeepEquals(t, com, c.com)
+		})
+	}
+}
+
+func TestValidateCommands(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		in   config.CustomCommand
+		err  error
+	}{
+		{
+			"valid random",
+			config.CustomCommand{
+				Name:    "quote",
+				Answers: []string{"foo"},
+			},
+			nil,
+		},
+		{
+			"valid counter",
+			config.CustomCommand{
+				Name: "rank_2",
+				Type: config.CustomCounter,
+			},
+			nil,
+		},
+		{
+			"no answers",
+			config.CustomCommand{
+				Name: "quote",
+			},
+			errNoAnswers,
+		},
+		{
+			"invalid type",
+			config.CustomCommand{
+				Name: "quote",
+				Type: 2,
+			},
+			errInvalidCommandType,
+		},
+		{
+			"invalid characters",
+			config.CustomCommand{
+				Name: "Quote",
+				Type: config.CustomCounter,
+			},
+			errInvalidCommandName,
+		},
+		{
+			"built-in command",
+			config.CustomCommand{
+				Name: "flip",
+				Type: config.CustomCounter,
+			},
+			errInvalidCommandName,
+		},
+		{
+			"dice",
+			config.CustomCommand{
+				Name: "d20",
+				Type: config.CustomCounter,
+			},
+			errInvalidCommandName,
+		},
+		{
+			"syncwatch",
+			config.CustomCommand{
+				Name: "syncwatch",
+				Type: config.CustomCounter,
+			},
+			errInvalidCommandName,
+		},
+		{
+			"poll",
+			config.CustomCommand{
+				Name: "poll",
+				Type: config.CustomCounter,
+			},
+			errInvalidCommandName,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateCommands([]config.CustomCommand{c.in})
+			if err != c.err {
+				LogUnexpected(t, c.err, err)
+			}
+		})
+	}
+
+	t.Run("duplicate", func(t *testing.T) {
+		t.Parallel()
+
+		c := config.CustomCommand{
+			Name: "counter",
+			Type: config.CustomCounter,
+		}
+		err := ValidateCommands([]config.CustomCommand{c, c})
+		if err != errDuplicateCommand {
+			LogUnexpected(t, errDuplicateCommand, err)
+		}
+	})
+}
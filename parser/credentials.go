@@ -1,7 +1,10 @@
 package parser
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
+	"strconv"
 	"strings"
 
 	"github.com/aquilax/tripcode"
@@ -16,8 +19,9 @@ var (
 	errPostPasswordTooLong = ErrTooLong("post password")
 )
 
-// ParseName parses the name field into a name and tripcode, if any
-func ParseName(name string) (string, string, error) {
+// ParseName parses the name field into a name and tripcode, if any, and
+// applies content filters to the name
+func ParseName(name, board string) (string, string, error) {
 	if name == "" {
 		return name, name, nil
 	}
@@ -27,29 +31,46 @@ func ParseName(name string) (string, string, error) {
 	name = strings.TrimSpace(name)
 
 	// #password for tripcodes and ##password for secure tripcodes
+	var trip string
 	firstHash := strings.IndexByte(name, '#')
 	if firstHash > -1 {
 		password := name[firstHash+1:]
 		name = name[:firstHash]
-		if password[0] == '#' {
-			trip := tripcode.SecureTripcode(password[1:], config.Get().Salt)
-			return name, trip, nil
+		if password != "" && password[0] == '#' {
+			trip = tripcode.SecureTripcode(password[1:], config.Get().Salt)
+		} else {
+			trip = tripcode.Tripcode(password)
 		}
-		return name, tripcode.Tripcode(password), nil
 	}
 
-	return name, "", nil
+	name, err := applyFilters(name, board)
+	if err != nil {
+		return "", "", err
+	}
+	return name, trip, nil
+}
+
+// PosterID derives a short poster identifier from the poster's IP and the
+// parent thread. The ID is stable within a thread, but differs between threads,
+// so posters can not be tracked across threads.
+func PosterID(ip string, op int64) string {
+	h := sha256.New()
+	h.Write([]byte(config.Get().Salt))
+	h.Write([]byte(ip))
+	h.Write([]byte(strconv.FormatInt(op, 10)))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:6])
 }
 
-// ParseSubject verifies and trims a thread subject string
-func ParseSubject(s string) (string, error) {
+// ParseSubject verifies and trims a thread subject string and applies content
+// filters to it
+func ParseSubject(s, board string) (string, error) {
 	if s == "" {
 		return s, errNoSubject
 	}
 	if len(s) > maxLengthSubject {
 		return s, errSubjectTooLong
 	}
-	return strings.TrimSpace(s), nil
+	return applyFilters(strings.TrimSpace(s), board)
 }
 
 // FormatEmail validates and checks
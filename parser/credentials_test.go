@@ -27,7 +27,7 @@ func TestParseName(t *testing.T) {
 		t.Run(c.testName, func(t *testing.T) {
 			t.Parallel()
 
-			name, trip, err := ParseName(c.in)
+			name, trip, err := ParseName(c.in, "a")
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -42,7 +42,7 @@ func TestParseName(t *testing.T) {
 
 	t.Run("name too long", func(t *testing.T) {
 		t.Parallel()
-		_, _, err := ParseName(genString(maxLengthName + 1))
+		_, _, err := ParseName(genString(maxLengthName+1), "a")
 		if err != errNameTooLong {
 			UnexpectedError(t, err)
 		}
@@ -73,7 +73,7 @@ func TestParseSubject(t *testing.T) {
 	for i := range cases {
 		c := cases[i]
 		t.Run(c.name, func(t *testing.T) {
-			sub, err := ParseSubject(c.in)
+			sub, err := ParseSubject(c.in, "a")
 			if err != c.err {
 				UnexpectedError(t, err)
 			}
@@ -136,3 +136,21 @@ func TestFormatEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestPosterID(t *testing.T) {
+	t.Parallel()
+
+	id := PosterID("::1", 1)
+	if len(id) != 8 {
+		t.Fatalf("unexpected poster ID length: %d", len(id))
+	}
+	if s := PosterID("::1", 1); s != id {
+		LogUnexpected(t, id, s)
+	}
+	if PosterID("::1", 2) == id {
+		t.Error("poster ID not unique per thread")
+	}
+	if PosterID("::2", 1) == id {
+		t.Error("poster ID not unique per IP")
+	}
+}
@@ -0,0 +1,97 @@
+// Global and board-specific content filters
+
+package parser
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/bakape/meguca/config"
+)
+
+const (
+	maxFilters              = 100
+	maxLengthFilterPattern  = 200
+	maxLengthFilterReplacer = 200
+)
+
+var (
+	errTooManyFilters        = errors.New("too many filters")
+	errNoFilterPattern       = errors.New("no filter pattern")
+	errFilterPatternTooLong  = ErrTooLong("filter pattern")
+	errFilterReplacerTooLong = ErrTooLong("filter replacement")
+	errInvalidFilterAction   = errors.New("invalid filter action")
+	errNoFilterBanDuration   = errors.New("no filter ban duration")
+	errFilterMatchesEmpty    = errors.New("filter matches empty string")
+	errNewlineInReplacement  = errors.New("newline in filter replacement")
+)
+
+// ErrFiltered is returned, when text matches a filter, that rejects the post
+// or bans its author
+type ErrFiltered struct {
+	config.Filter
+}
+
+func (e ErrFiltered) Error() string {
+	return "post rejected by filter"
+}
+
+// ValidateFilters validates a list of content filters before it is written to
+// the database
+func ValidateFilters(filters []config.Filter) error {
+	if len(filters) > maxFilters {
+		return errTooManyFilters
+	}
+	for _, f := range filters {
+		switch {
+		case f.Pattern == "":
+			return errNoFilterPattern
+		case len(f.Pattern) > maxLengthFilterPattern:
+			return errFilterPatternTooLong
+		case len(f.Replacement) > maxLengthFilterReplacer:
+			return errFilterReplacerTooLong
+		case strings.ContainsRune(f.Replacement, '\n'):
+			return errNewlineInReplacement
+		case f.Action > config.FilterBan:
+			return errInvalidFilterAction
+		case f.Action == config.FilterBan && f.BanDuration == 0:
+			return errNoFilterBanDuration
+		}
+
+		re, err := config.CompileFilter(f)
+		if err != nil {
+			return err
+		}
+		if re.MatchString("") {
+			return errFilterMatchesEmpty
+		}
+	}
+	return nil
+}
+
+// Apply the global and the board's filters to text in order. Returns the text
+// with all replacements performed or ErrFiltered on the first matching filter,
+// that rejects the post.
+func applyFilters(text, board string) (string, error) {
+	lists := [...][]config.CompiledFilter{
+		config.GetFilters(),
+		config.GetBoardConfigs(board).CompiledFilters,
+	}
+	for _, filters := range lists {
+		for _, f := range filters {
+			if !f.Re.MatchString(text) {
+				continue
+			}
+
+			if f.Action != config.FilterReplace {
+				return "", ErrFiltered{f.Filter}
+			}
+			if f.Regex {
+				text = f.Re.ReplaceAllString(text, f.Replacement)
+			} else {
+				text = f.Re.ReplaceAllLiteralString(text, f.Replacement)
+			}
+		}
+	}
+	return text, nil
+}
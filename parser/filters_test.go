@@ -0,0 +1,226 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/bakape/meguca/config"
+	. "github.com/bakape/meguca/test"
+)
+
+// Set global and board "a" filters and return a function, that restores the
+// previous global configuration
+func setFilters(global, board []config.Filter) func() {
+	old := *config.Get()
+	conf := old
+	conf.Filters = global
+	config.Set(conf)
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID:      "a",
+		Filters: board,
+	})
+	return func() {
+		config.Set(old)
+	}
+}
+
+func TestApplyFilters(t *testing.T) {
+	global := []config.Filter{
+		{
+			Pattern:     "BAD",
+			Replacement: "good",
+		},
+		{
+			Pattern: "spam",
+			Action:  config.FilterReject,
+		},
+	}
+	board := []config.Filter{
+		{
+			Regex:       true,
+			Pattern:     `(\d+)chan`,
+			Replacement: "chan$1",
+		},
+		{
+			Regex:       true,
+			Pattern:     `^buy\b`,
+			Action:      config.FilterBan,
+			BanDuration: 60,
+		},
+	}
+	defer setFilters(global, board)()
+
+	cases := [...]struct {
+		name, in, out string
+		action        config.FilterAction
+		rejected      bool
+	}{
+		{"no match", "hello", "hello", 0, false},
+		{"literal", "a bad bAd day", "a good good day", 0, false},
+		{"regex", "4chan", "chan4", 0, false},
+		{"both lists", "bad 4chan", "good chan4", 0, false},
+		{"reject", "more Spam", "", config.FilterReject, true},
+		{"ban", "buy now", "", config.FilterBan, true},
+		{"no ban", "don't buy now", "don't buy now", 0, false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			out, err := applyFilters(c.in, "a")
+			if c.rejected {
+				f, ok := err.(ErrFiltered)
+				if !ok {
+					t.Fatalf("unexpected error: %#v", err)
+				}
+				if f.Action != c.action {
+					LogUnexpected(t, c.action, f.Action)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != c.out {
+				LogUnexpected(t, c.out, out)
+			}
+		})
+	}
+}
+
+func TestFilteredParsing(t *testing.T) {
+	defer setFilters(nil, []config.Filter{
+		{
+			Pattern:     "foo",
+			Replacement: "bar",
+		},
+		{
+			Pattern: "nope",
+			Action:  config.FilterReject,
+		},
+	})()
+
+	t.Run("line", func(t *testing.T) {
+		line, _, _, _, err := ParseLine([]byte("foo Foo"), "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(line); s != "bar bar" {
+			LogUnexpected(t, "bar bar", s)
+		}
+	})
+
+	t.Run("name", func(t *testing.T) {
+		name, _, err := ParseName(" foo ", "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "bar" {
+			LogUnexpected(t, "bar", name)
+		}
+	})
+
+	t.Run("subject", func(t *testing.T) {
+		_, err := ParseSubject("nope", "a")
+		if _, ok := err.(ErrFiltered); !ok {
+			UnexpectedError(t, err)
+		}
+	})
+}
+
+func TestValidateFilters(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name   string
+		filter config.Filter
+		err    error
+	}{
+		{
+			"valid",
+			config.Filter{Pattern: "foo"},
+			nil,
+		},
+		{
+			"no pattern",
+			config.Filter{},
+			errNoFilterPattern,
+		},
+		{
+			"pattern too long",
+			config.Filter{Pattern: genString(maxLengthFilterPattern + 1)},
+			errFilterPatternTooLong,
+		},
+		{
+			"replacement too long",
+			config.Filter{
+				Pattern:     "foo",
+				Replacement: genString(maxLengthFilterReplacer + 1),
+			},
+			errFilterReplacerTooLong,
+		},
+		{
+			"newline in replacement",
+			config.Filter{
+				Pattern:     "foo",
+				Replacement: "a\nb",
+			},
+			errNewlineInReplacement,
+		},
+		{
+			"invalid action",
+			config.Filter{
+				Pattern: "foo",
+				Action:  config.FilterBan + 1,
+			},
+			errInvalidFilterAction,
+		},
+		{
+			"no ban duration",
+			config.Filter{
+				Pattern: "foo",
+				Action:  config.FilterBan,
+			},
+			errNoFilterBanDuration,
+		},
+		{
+			"matches empty string",
+			config.Filter{
+				Regex:   true,
+				Pattern: "a*",
+			},
+			errFilterMatchesEmpty,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateFilters([]config.Filter{c.filter})
+			if err != c.err {
+				UnexpectedError(t, err)
+			}
+		})
+	}
+
+	t.Run("invalid regex", func(t *testing.T) {
+		t.Parallel()
+		err := ValidateFilters([]config.Filter{
+			{
+				Regex:   true,
+				Pattern: "(",
+			},
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("too many filters", func(t *testing.T) {
+		t.Parallel()
+		filters := make([]config.Filter, maxFilters+1)
+		if err := ValidateFilters(filters); err != errTooManyFilters {
+			UnexpectedError(t, err)
+		}
+	})
+}
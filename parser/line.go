@@ -9,26 +9,43 @@ import (
 
 var (
 	// CommandRegexp matches any hash command in a line
-	CommandRegexp = regexp.MustCompile(`^#(flip|\d*d\d+|8ball|pyu|pcount)$`)
+	CommandRegexp = regexp.MustCompile(
+		`^#(flip|8ball|pyu|pcount|poll` +
+			`|\d{0,3}d\d{1,5}(?:k[hl]\d{1,3})?(?:[+-]\d{1,5})?` +
+			`|syncwatch(?:\d{1,2}:)?\d{1,2}:\d{1,2}(?: \+\d{1,4})?` +
+			`|[a-z][a-z0-9_]{0,19})$`,
+	)
 
 	// ErrBodyTooLong is returned, when a post text body has exceeded
 	// MaxLengthBody
 	ErrBodyTooLong = ErrTooLong("post body")
 )
 
-// ParseLine parses a full text line of a post
+// ParseLine applies content filters to a full text line of a post and parses
+// the filtered line. The filtered line is returned for the caller to commit, if
+// it differs from the original.
 func ParseLine(line []byte, board string) (
-	links types.LinkMap, command types.Command, err error,
+	filtered []byte,
+	links types.LinkMap,
+	boardLinks []string,
+	command types.Command,
+	err error,
 ) {
+	text, err := applyFilters(string(line), board)
+	if err != nil {
+		return
+	}
+	filtered = []byte(text)
+
 	// Find and parse hash commands
 	if config.GetBoardConfigs(board).HashCommands {
-		match := CommandRegexp.FindSubmatch(line)
+		match := CommandRegexp.FindSubmatch(filtered)
 		if match != nil {
 			command, err = parseCommand(match[1], board)
 			return
 		}
 	}
 
-	links, err = parseLinks(line)
+	links, boardLinks, err = parseLinks(filtered)
 	return
 }
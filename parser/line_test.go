@@ -14,7 +14,7 @@ func TestParseLine(t *testing.T) {
 	})
 
 	t.Run("commands disabled", func(t *testing.T) {
-		links, com, err := ParseLine([]byte("#flip"), "a")
+		_, links, _, com, err := ParseLine([]byte("#flip"), "a")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -34,7 +34,7 @@ func TestParseLine(t *testing.T) {
 			},
 		})
 
-		links, com, err := ParseLine([]byte("#flip"), "a")
+		_, links, _, com, err := ParseLine([]byte("#flip"), "a")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -44,5 +44,13 @@ func TestParseLine(t *testing.T) {
 		if com.Type != types.Flip {
 			t.Fatalf("unexpected command type: %d", com.Type)
 		}
+
+		_, _, _, com, err = ParseLine([]byte("#syncwatch1:30:00 +10"), "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if com.Type != types.SyncWatch {
+			t.Fatalf("unexpected command type: %d", com.Type)
+		}
 	})
 }
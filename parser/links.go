@@ -1,52 +1,96 @@
 package parser
 
 import (
+	"bytes"
 	"regexp"
 	"strconv"
 
+	"github.com/bakape/meguca/config"
 	"github.com/bakape/meguca/db"
 	"github.com/bakape/meguca/types"
-	r "github.com/dancannon/gorethink"
 )
 
-var linkRegexp = regexp.MustCompile(`(?:^| )>{2,}(\d+)\b`)
+var (
+	linkRegexp      = regexp.MustCompile(`^>{2,}(\d+)\b`)
+	crossLinkRegexp = regexp.MustCompile(`^>{3,}\/(\w+)\/(\d+)\b`)
+	boardLinkRegexp = regexp.MustCompile(`^>{3,}\/(\w+)\/$`)
+)
 
-// Extract post links from a text fragment, verify and retrieve their
-// parenthood
-func parseLinks(frag []byte) (types.LinkMap, error) {
-	matches := linkRegexp.FindAllSubmatch(frag, -1)
-	if matches == nil {
-		return nil, nil
-	}
-	links := make(types.LinkMap, len(matches))
-	for _, match := range matches {
-		id, err := strconv.ParseInt(string(match[1]), 10, 64)
-		if err != nil {
-			return nil, err
+// Extract post and board links from a text fragment. Verify and retrieve the
+// parenthood of all linked posts at once. Cross-board post links are only
+// valid, if the post belongs to the specified board.
+func parseLinks(frag []byte) (
+	links types.LinkMap, boardLinks []string, err error,
+) {
+	// Boards linked posts must belong to, keyed by post ID. Empty string
+	// denotes any board.
+	var boards map[int64]string
+	for _, word := range bytes.Split(frag, []byte{' '}) {
+		if len(word) < 3 || word[0] != '>' {
+			continue
 		}
 
-		var parenthood struct {
-			OP    int64
-			Board string
+		var (
+			board string
+			id    int64
+		)
+		if m := linkRegexp.FindSubmatch(word); m != nil {
+			id, err = strconv.ParseInt(string(m[1]), 10, 64)
+		} else if m := crossLinkRegexp.FindSubmatch(word); m != nil {
+			board = string(m[1])
+			id, err = strconv.ParseInt(string(m[2]), 10, 64)
+		} else if m := boardLinkRegexp.FindSubmatch(word); m != nil {
+			board = string(m[1])
+			if config.IsBoard(board) && !containsString(boardLinks, board) {
+				boardLinks = append(boardLinks, board)
+			}
+			continue
+		} else {
+			continue
 		}
-		q := db.FindPost(id).Pluck("op", "board").Default(nil)
-		err = db.One(q, &parenthood)
 		if err != nil {
-			if err == r.ErrEmptyResult { // Points to invalid post. Ignore.
-				continue
-			}
-			return nil, err
+			return
 		}
-		links[id] = types.Link{
-			OP:    parenthood.OP,
-			Board: parenthood.Board,
+
+		if boards == nil {
+			boards = make(map[int64]string)
+		}
+		if prev, ok := boards[id]; !ok || prev != "" {
+			boards[id] = board
+		}
+	}
+	if boards == nil {
+		return
+	}
+
+	ids := make([]int64, 0, len(boards))
+	for id := range boards {
+		ids = append(ids, id)
+	}
+	links, err = db.GetParenthood(ids...)
+	if err != nil {
+		return
+	}
+	for id, board := range boards {
+		if l, ok := links[id]; ok && board != "" && l.Board != board {
+			delete(links, id)
 		}
 	}
 
 	// All links invalid
 	if len(links) == 0 {
-		return nil, nil
+		links = nil
 	}
 
-	return links, nil
+	return
+}
+
+// Returns, if the slice contains the string
+func containsString(arr []string, s string) bool {
+	for _, a := range arr {
+		if a == s {
+			return true
+		}
+	}
+	return false
 }
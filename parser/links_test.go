@@ -3,6 +3,7 @@ package parser
 import (
 	"testing"
 
+	"github.com/bakape/meguca/config"
 	. "github.com/bakape/meguca/test"
 	"github.com/bakape/meguca/types"
 )
@@ -18,23 +19,59 @@ func TestParseLinks(t *testing.T) {
 			Board: "a",
 		},
 	})
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+	})
 
 	cases := [...]struct {
-		name, in string
-		links    types.LinkMap
+		name, in   string
+		links      types.LinkMap
+		boardLinks []string
 	}{
-		{"no links", "foo bar baz", nil},
+		{"no links", "foo bar baz", nil, nil},
 		{
-			"valid links",
-			" >>>1  >>4 ",
-			types.LinkMap{
+			name: "valid links",
+			in:   " >>>1  >>4 ",
+			links: types.LinkMap{
 				4: types.Link{
 					OP:    2,
 					Board: "a",
 				},
 			},
 		},
-		{"all links invalid", " >>1 >>2 >>33", nil},
+		{
+			name: "all links invalid",
+			in:   " >>1 >>2 >>33",
+		},
+		{
+			name: "cross-board link",
+			in:   ">>>/a/4",
+			links: types.LinkMap{
+				4: types.Link{
+					OP:    2,
+					Board: "a",
+				},
+			},
+		},
+		{
+			name: "cross-board link to wrong board",
+			in:   ">>>/c/4",
+		},
+		{
+			name: "plain and cross-board link to same post",
+			in:   ">>>/c/4 >>4",
+			links: types.LinkMap{
+				4: types.Link{
+					OP:    2,
+					Board: "a",
+				},
+			},
+		},
+		{
+			name:       "board links",
+			in:         ">>>/a/ >>>/c/ >>>>/a/",
+			boardLinks: []string{"a"},
+		},
 	}
 
 	for i := range cases {
@@ -42,11 +79,12 @@ func TestParseLinks(t *testing.T) {
 		t.Run(c.name, func(t *testing.T) {
 			t.Parallel()
 
-			links, err := parseLinks([]byte(c.in))
+			links, boardLinks, err := parseLinks([]byte(c.in))
 			if err != nil {
 				t.Fatal(err)
 			}
 			AssertDeepEquals(t, links, c.links)
+			AssertDeepEquals(t, boardLinks, c.boardLinks)
 		})
 	}
 }
@@ -7,11 +7,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"time"
 
+	"github.com/bakape/meguca/auth"
 	"github.com/bakape/meguca/config"
 	"github.com/bakape/meguca/db"
 	"github.com/bakape/meguca/parser"
+	"github.com/bakape/meguca/types"
 	r "github.com/dancannon/gorethink"
 )
 
@@ -22,9 +26,17 @@ const (
 
 	maxAnswers      = 100  // Maximum number of eightball answers
 	maxEightballLen = 2000 // Total chars in eightball
+	maxCommands     = 20   // Maximum number of custom hash commands
+	maxCommandsLen  = 5000 // Total chars in custom hash command answers
 	maxNoticeLen    = 500
 	maxRulesLen     = 5000
 	maxTitleLen     = 100
+	maxBanReasonLen = 100
+
+	// Shortest network prefixes a ban can apply to. Prevents banning
+	// excessively large address ranges.
+	minBanPrefixV4 = 16
+	minBanPrefixV6 = 32
 )
 
 var (
@@ -33,6 +45,19 @@ var (
 	errTitleTooLong     = parser.ErrTooLong("board title")
 	errNoticeTooLong    = parser.ErrTooLong("notice")
 	errRulesTooLong     = parser.ErrTooLong("rules")
+	errBanReasonTooLong = parser.ErrTooLong("ban reason")
+	errNoBanReason      = errors.New("no ban reason")
+	errInvalidDuration  = errors.New("invalid ban duration")
+	errInvalidPrefix    = errors.New("invalid ban network prefix")
+	errNoPost           = errors.New("post does not exist")
+	errAccessDenied     = errors.New("access denied")
+	errInvalidPosition  = errors.New("invalid staff position")
+	errNoUser           = errors.New("user does not exist")
+	errLastOwner        = errors.New("can not remove last board owner")
+	errInvalidPage      = errors.New("invalid page")
+	errDiceLimits       = errors.New("dice limits too high")
+	errTooManyCommands  = errors.New("too many custom commands")
+	errCommandsTooLong  = parser.ErrTooLong("custom command answers")
 )
 
 // Embed in every request that needs authentication
@@ -52,6 +77,31 @@ type boardConfigRequest struct {
 	ID string `json:"id"`
 }
 
+// Request to ban the poster of a post. If Global is set, the poster is banned
+// from all boards. Duration is in minutes. If Prefix is set, the entire network
+// of the poster's IP with the specified prefix length is banned.
+type banRequest struct {
+	loginCredentials
+	Global   bool
+	ID       int64
+	Duration int64
+	Prefix   uint
+	Reason   string
+}
+
+// Request to add or remove a user from a staff position on a board
+type staffRequest struct {
+	loginCredentials
+	Board, Position, User string
+}
+
+// Request for a page of a board's moderation log
+type modLogRequest struct {
+	loginCredentials
+	Page int
+	db.ModLogFilter
+}
+
 // Decode JSON sent in a request with a read limit of 8 KB. Returns if the
 // decoding succeeded.
 func decodeJSON(w http.ResponseWriter, r *http.Request, dest interface{}) bool {
@@ -69,7 +119,7 @@ func configureBoard(w http.ResponseWriter, req *http.Request) {
 	var msg boardConfigSettingRequest
 	isValid := decodeJSON(w, req, &msg) &&
 		isLoggedIn(w, req, msg.UserID, msg.Session) &&
-		isBoardOwner(w, req, msg.ID, msg.UserID) &&
+		canPerform(w, msg.ID, msg.UserID, auth.ConfigureBoard) &&
 		validateConfigs(w, msg.BoardConfigs)
 	if !isValid {
 		return
@@ -80,16 +130,268 @@ func configureBoard(w http.ResponseWriter, req *http.Request) {
 	conf.Spoiler = "default.jpg"
 	conf.Banners = []string{}
 
-	// TODO: Staff configuration
-	conf.Staff = map[string][]string{
-		"owners": {msg.UserID},
+	// Staff is managed separately through addStaff() and removeStaff().
+	// Filters and custom commands are only modified, if sent.
+	omit := []interface{}{"staff"}
+	if conf.Filters == nil {
+		omit = append(omit, "filters")
+	}
+	if conf.Commands == nil {
+		omit = append(omit, "commands")
+	}
+	q := r.Table("boards").Get(msg.ID).Update(r.Expr(conf).Without(omit...))
+	if err := db.Write(q); err != nil {
+		text500(w, req, err)
+		return
+	}
+
+	logModeration(w, req, types.ModLogEntry{
+		Type:  types.ConfigureBoard,
+		Board: msg.ID,
+		By:    msg.UserID,
+	})
+}
+
+// Validate a request to modify board staff. Only users with the permission to
+// configure the board may modify its staff.
+func decodeStaffRequest(w http.ResponseWriter, req *http.Request) (
+	msg staffRequest, ok bool,
+) {
+	ok = decodeJSON(w, req, &msg) &&
+		isLoggedIn(w, req, msg.UserID, msg.Session) &&
+		canPerform(w, msg.Board, msg.UserID, auth.ConfigureBoard)
+	if ok && !auth.IsPosition(msg.Position) {
+		text400(w, errInvalidPosition)
+		ok = false
+	}
+	return
+}
+
+// Add a registered user to a staff position on a board
+func addStaff(w http.ResponseWriter, req *http.Request) {
+	msg, ok := decodeStaffRequest(w, req)
+	if !ok {
+		return
+	}
+
+	var exists bool
+	q := db.GetAccount(msg.User).Eq(nil).Not()
+	if err := db.One(q, &exists); err != nil {
+		text500(w, req, err)
+		return
+	}
+	if !exists {
+		text400(w, errNoUser)
+		return
+	}
+
+	writeStaff(w, req, msg, types.AddStaff, func(s r.Term) r.Term {
+		return s.SetInsert(msg.User)
+	})
+}
+
+// Remove a user from a staff position on a board
+func removeStaff(w http.ResponseWriter, req *http.Request) {
+	msg, ok := decodeStaffRequest(w, req)
+	if !ok {
+		return
+	}
+
+	// Boards must always have at least one owner
+	if msg.Position == "owners" {
+		owners := config.GetBoardConfigs(msg.Board).Staff["owners"]
+		if len(owners) == 1 && owners[0] == msg.User {
+			text400(w, errLastOwner)
+			return
+		}
 	}
 
-	q := r.Table("boards").Get(msg.ID).Update(conf)
+	writeStaff(w, req, msg, types.RemoveStaff, func(s r.Term) r.Term {
+		return s.SetDifference([]string{msg.User})
+	})
+}
+
+// Apply a modification function to the array of users holding a staff
+// position on a board and log the change
+func writeStaff(
+	w http.ResponseWriter,
+	req *http.Request,
+	msg staffRequest,
+	action types.ModerationAction,
+	fn func(r.Term) r.Term,
+) {
+	staff := r.Row.Field("staff").Field(msg.Position).Default([]string{})
+	q := r.Table("boards").Get(msg.Board).Update(map[string]interface{}{
+		"staff": map[string]r.Term{
+			msg.Position: fn(staff),
+		},
+	})
 	if err := db.Write(q); err != nil {
 		text500(w, req, err)
 		return
 	}
+
+	logModeration(w, req, types.ModLogEntry{
+		Type:  action,
+		Board: msg.Board,
+		By:    msg.UserID,
+		Data:  msg.Position + " " + msg.User,
+	})
+}
+
+// Ban the poster of a post from posting on the post's board or globally. Only
+// the admin account can issue global bans.
+func banPoster(w http.ResponseWriter, req *http.Request) {
+	var msg banRequest
+	isValid := decodeJSON(w, req, &msg) &&
+		isLoggedIn(w, req, msg.UserID, msg.Session)
+	if !isValid {
+		return
+	}
+
+	var err error
+	switch {
+	case msg.Reason == "":
+		err = errNoBanReason
+	case len(msg.Reason) > maxBanReasonLen:
+		err = errBanReasonTooLong
+	case msg.Duration <= 0:
+		err = errInvalidDuration
+	}
+	if err != nil {
+		text400(w, err)
+		return
+	}
+
+	var post struct {
+		Board, IP string
+	}
+	q := db.FindPost(msg.ID).Pluck("board", "ip").Default(nil)
+	err = db.One(q, &post)
+	switch err {
+	case nil:
+	case r.ErrEmptyResult:
+		text400(w, errNoPost)
+		return
+	default:
+		text500(w, req, err)
+		return
+	}
+
+	board := post.Board
+	if msg.Global {
+		if msg.UserID != "admin" {
+			text403(w, errAccessDenied)
+			return
+		}
+		board = "all"
+	} else if !canPerform(w, board, msg.UserID, auth.BanPoster) {
+		return
+	}
+
+	ip, err := banRange(post.IP, msg.Prefix)
+	if err != nil {
+		text400(w, err)
+		return
+	}
+
+	err = db.InsertBan(auth.Ban{
+		IP:      ip,
+		Board:   board,
+		Reason:  msg.Reason,
+		By:      msg.UserID,
+		Expires: time.Now().Add(time.Duration(msg.Duration) * time.Minute),
+	})
+	if err != nil {
+		text500(w, req, err)
+		return
+	}
+
+	logModeration(w, req, types.ModLogEntry{
+		Type:   types.BanPoster,
+		Target: msg.ID,
+		Board:  board,
+		By:     msg.UserID,
+		Data:   msg.Reason,
+	})
+}
+
+// Return the IP or network in CIDR notation to ban. A prefix of zero bans only
+// the exact IP.
+func banRange(ip string, prefix uint) (string, error) {
+	if prefix == 0 {
+		return ip, nil
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", errInvalidPrefix
+	}
+	bits, min := 128, uint(minBanPrefixV6)
+	if v4 := parsed.To4(); v4 != nil {
+		parsed = v4
+		bits, min = 32, minBanPrefixV4
+	}
+	if prefix < min || prefix > uint(bits) {
+		return "", errInvalidPrefix
+	}
+
+	mask := net.CIDRMask(int(prefix), bits)
+	network := net.IPNet{
+		IP:   parsed.Mask(mask),
+		Mask: mask,
+	}
+	return network.String(), nil
+}
+
+// Serve a page of the moderation log of a board to its staff. The "all" board
+// serves the global moderation log to the admin account.
+func serveModLog(
+	w http.ResponseWriter,
+	req *http.Request,
+	params map[string]string,
+) {
+	var msg modLogRequest
+	isValid := decodeJSON(w, req, &msg) &&
+		isLoggedIn(w, req, msg.UserID, msg.Session)
+	if !isValid {
+		return
+	}
+
+	board := params["board"]
+	if msg.UserID != "admin" {
+		if board == "all" || !auth.IsStaff(msg.UserID, board) {
+			text403(w, errAccessDenied)
+			return
+		}
+	}
+	if msg.Page < 0 {
+		text400(w, errInvalidPage)
+		return
+	}
+
+	entries, err := db.GetModLog(board, msg.Page, msg.ModLogFilter)
+	switch err {
+	case nil:
+	case db.ErrNoSuchPage:
+		text404(w)
+		return
+	default:
+		text500(w, req, err)
+		return
+	}
+	serveJSON(w, req, "", entries)
+}
+
+// Record a staff action in the moderation log
+func logModeration(
+	w http.ResponseWriter,
+	req *http.Request,
+	entry types.ModLogEntry,
+) {
+	if err := db.LogModeration(entry); err != nil {
+		text500(w, req, err)
+	}
 }
 
 // Assert the user login session ID is valid
@@ -121,25 +423,18 @@ func isLoggedIn(
 	return true
 }
 
-// Assert the user is one of the board's owners
-func isBoardOwner(
+// Assert the user holds a staff position on the board, that grants the
+// specified permission
+func canPerform(
 	w http.ResponseWriter,
-	req *http.Request,
 	board, userID string,
-) (isOwner bool) {
-	if staff := config.GetBoardConfigs(board).Staff; staff != nil {
-		for _, o := range staff["owners"] {
-			if o == userID {
-				isOwner = true
-				break
-			}
-		}
-	}
-
-	if !isOwner {
-		http.Error(w, "403 Not board owner", 403)
+	perm auth.Permission,
+) bool {
+	if !auth.CanPerform(userID, board, perm) {
+		http.Error(w, "403 Insufficient permissions", 403)
+		return false
 	}
-	return
+	return true
 }
 
 // Validate length limit compliance of various fields
@@ -148,6 +443,15 @@ func validateConfigs(w http.ResponseWriter, conf config.BoardConfigs) bool {
 	for _, answer := range conf.Eightball {
 		totalLen += len(answer)
 	}
+	commandsLen, tooManyAnswers := 0, false
+	for _, c := range conf.Commands {
+		for _, answer := range c.Answers {
+			commandsLen += len(answer)
+		}
+		if len(c.Answers) > maxAnswers {
+			tooManyAnswers = true
+		}
+	}
 
 	var err error
 	switch {
@@ -161,6 +465,20 @@ func validateConfigs(w http.ResponseWriter, conf config.BoardConfigs) bool {
 		err = errRulesTooLong
 	case len(conf.Title) > maxTitleLen:
 		err = errTitleTooLong
+	case conf.MaxDice > config.MaxDice,
+		conf.MaxDieSides > config.MaxDieSides:
+		err = errDiceLimits
+	case len(conf.Commands) > maxCommands:
+		err = errTooManyCommands
+	case tooManyAnswers:
+		err = errTooManyAnswers
+	case commandsLen > maxCommandsLen:
+		err = errCommandsTooLong
+	default:
+		err = parser.ValidateFilters(conf.Filters)
+		if err == nil {
+			err = parser.ValidateCommands(conf.Commands)
+		}
 	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("400 %s", err), 400)
@@ -177,7 +495,7 @@ func servePrivateBoardConfigs(w http.ResponseWriter, r *http.Request) {
 	var msg boardConfigRequest
 	isValid := decodeJSON(w, r, &msg) &&
 		isLoggedIn(w, r, msg.UserID, msg.Session) &&
-		isBoardOwner(w, r, msg.ID, msg.UserID)
+		canPerform(w, msg.ID, msg.UserID, auth.ConfigureBoard)
 	if !isValid {
 		return
 	}
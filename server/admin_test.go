@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
@@ -13,7 +14,9 @@ import (
 	"github.com/bakape/meguca/auth"
 	"github.com/bakape/meguca/config"
 	"github.com/bakape/meguca/db"
+	"github.com/bakape/meguca/parser"
 	. "github.com/bakape/meguca/test"
+	"github.com/bakape/meguca/types"
 	r "github.com/dancannon/gorethink"
 )
 
@@ -96,11 +99,13 @@ func encodeBody(t *testing.T, data interface{}) io.Reader {
 	return bytes.NewReader(marshalJSON(t, data))
 }
 
-func TestNotBoardOwner(t *testing.T) {
+func TestInsufficientPermissions(t *testing.T) {
 	assertTableClear(t, "accounts")
 	writeSampleUser(t)
 
-	fns := [...]http.HandlerFunc{configureBoard, servePrivateBoardConfigs}
+	fns := [...]http.HandlerFunc{
+		configureBoard, servePrivateBoardConfigs, addStaff, removeStaff,
+	}
 
 	for i := range fns {
 		fn := fns[i]
@@ -110,7 +115,7 @@ func TestNotBoardOwner(t *testing.T) {
 			rec, req := newJSONPair(t, "/", sampleLoginCredentials)
 			fn(rec, req)
 			assertCode(t, rec, 403)
-			assertBody(t, rec, "403 Not board owner\n")
+			assertBody(t, rec, "403 Insufficient permissions\n")
 		})
 	}
 }
@@ -203,6 +208,61 @@ func TestBoardConfiguration(t *testing.T) {
 	AssertDeepEquals(t, res, conf)
 }
 
+func TestBoardConfigurationFilters(t *testing.T) {
+	assertTableClear(t, "accounts", "boards")
+	writeSampleUser(t)
+	filters := []config.Filter{
+		{
+			Pattern: "foo",
+			Action:  config.FilterReject,
+		},
+	}
+	assertInsert(t, "boards", config.BoardConfigs{
+		ID: "a",
+		Staff: map[string][]string{
+			"owners": {"user1"},
+		},
+		Filters: filters,
+	})
+
+	configure := func(t *testing.T, filters []config.Filter) {
+		data := boardConfigSettingRequest{
+			loginCredentials: sampleLoginCredentials,
+			BoardConfigs: config.BoardConfigs{
+				ID:      "a",
+				Filters: filters,
+			},
+		}
+		rec, req := newJSONPair(t, "/admin/configureBoard", data)
+		router.ServeHTTP(rec, req)
+		assertCode(t, rec, 200)
+	}
+	assertFilters := func(t *testing.T, std []config.Filter) {
+		var res []config.Filter
+		q := r.Table("boards").Get("a").Field("filters")
+		if err := db.All(q, &res); err != nil {
+			t.Fatal(err)
+		}
+		AssertDeepEquals(t, res, std)
+	}
+
+	t.Run("omitted", func(t *testing.T) {
+		configure(t, nil)
+		assertFilters(t, filters)
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		std := []config.Filter{
+			{
+				Pattern:     "bar",
+				Replacement: "baz",
+			},
+		}
+		configure(t, std)
+		assertFilters(t, std)
+	})
+}
+
 func TestValidateConfigs(t *testing.T) {
 	t.Parallel()
 
@@ -257,6 +317,70 @@ func TestValidateConfigs(t *testing.T) {
 			},
 			errTitleTooLong,
 		},
+		{
+			"too many dice",
+			config.BoardConfigs{
+				BoardPublic: config.BoardPublic{
+					PostParseConfigs: config.PostParseConfigs{
+						MaxDice: config.MaxDice + 1,
+					},
+				},
+			},
+			errDiceLimits,
+		},
+		{
+			"too many die sides",
+			config.BoardConfigs{
+				BoardPublic: config.BoardPublic{
+					PostParseConfigs: config.PostParseConfigs{
+						MaxDieSides: config.MaxDieSides + 1,
+					},
+				},
+			},
+			errDiceLimits,
+		},
+		{
+			"too many custom commands",
+			config.BoardConfigs{
+				Commands: make([]config.CustomCommand, maxCommands+1),
+			},
+			errTooManyCommands,
+		},
+		{
+			"too many custom command answers",
+			config.BoardConfigs{
+				Commands: []config.CustomCommand{
+					{
+						Name:    "quote",
+						Answers: make([]string, maxAnswers+1),
+					},
+				},
+			},
+			errTooManyAnswers,
+		},
+		{
+			"custom command answers too long",
+			config.BoardConfigs{
+				Commands: []config.CustomCommand{
+					{
+						Name:    "quote",
+						Answers: []string{genString(maxCommandsLen + 1)},
+					},
+				},
+			},
+			errCommandsTooLong,
+		},
+		{
+			"invalid filter",
+			config.BoardConfigs{
+				Filters: []config.Filter{
+					{
+						Pattern: genString(1000),
+					},
+				},
+			},
+			parser.ErrTooLong("filter pattern"),
+		},
 	}
 
 	for i := range cases {
@@ -283,3 +407,208 @@ func genString(len int) string {
 	}
 	return buf.String()
 }
+
+func TestBanPoster(t *testing.T) {
+	assertTableClear(t, "accounts", "posts", "bans")
+	writeSampleUser(t)
+	setBoardOwner(t, "a", "user1")
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID: 1,
+			},
+			OP:    1,
+			Board: "a",
+		},
+		IP: "207.178.71.93",
+	})
+
+	cases := [...]struct {
+		name, reason string
+		id, duration int64
+		global       bool
+		code         int
+	}{
+		{"no reason", "", 1, 60, false, 400},
+		{"reason too long", genString(maxBanReasonLen + 1), 1, 60, false, 400},
+		{"invalid duration", "foo", 1, 0, false, 400},
+		{"no post", "foo", 99, 60, false, 400},
+		{"global ban by non-admin", "foo", 1, 60, true, 403},
+		{"valid", "foo", 1, 60, false, 200},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			rec, req := newJSONPair(t, "/admin/ban", banRequest{
+				loginCredentials: sampleLoginCredentials,
+				ID:               c.id,
+				Duration:         c.duration,
+				Reason:           c.reason,
+				Global:           c.global,
+			})
+			router.ServeHTTP(rec, req)
+			assertCode(t, rec, c.code)
+		})
+	}
+
+	ban, banned, err := db.IsBanned("a", "207.178.71.93")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !banned {
+		t.Fatal("poster not banned")
+	}
+	if ban.By != "user1" || ban.Reason != "foo" {
+		t.Errorf("unexpected ban: %#v", ban)
+	}
+}
+
+func TestBanRange(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, ip, out string
+		prefix        uint
+		err           error
+	}{
+		{"exact IP", "207.178.71.93", "207.178.71.93", 0, nil},
+		{"IPv4 network", "207.178.71.93", "207.178.0.0/16", 16, nil},
+		{"IPv6 network", "2001:db8::1", "2001:db8::/48", 48, nil},
+		{"IPv4 prefix too short", "207.178.71.93", "", 8, errInvalidPrefix},
+		{"IPv4 prefix too long", "207.178.71.93", "", 33, errInvalidPrefix},
+		{"IPv6 prefix too short", "2001:db8::1", "", 16, errInvalidPrefix},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			out, err := banRange(c.ip, c.prefix)
+			if err != c.err {
+				UnexpectedError(t, err)
+			}
+			if out != c.out {
+				LogUnexpected(t, c.out, out)
+			}
+		})
+	}
+}
+
+func setBoardOwner(t *testing.T, board, owner string) {
+	config.ClearBoards()
+	_, err := config.SetBoardConfigs(config.BoardConfigs{
+		ID: board,
+		Staff: map[string][]string{
+			"owners": {owner},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaffManagement(t *testing.T) {
+	assertTableClear(t, "accounts", "boards")
+	writeSampleUser(t)
+	assertInsert(t, "accounts", auth.User{
+		ID:       "user2",
+		Sessions: []auth.Session{},
+	})
+	setBoardOwner(t, "a", "user1")
+	assertInsert(t, "boards", config.BoardConfigs{
+		ID: "a",
+		Staff: map[string][]string{
+			"owners": {"user1"},
+		},
+	})
+
+	cases := [...]struct {
+		name, url, position, user string
+		code                      int
+	}{
+		{"invalid position", "/admin/addStaff", "admins", "user2", 400},
+		{"no such user", "/admin/addStaff", "moderators", "nope", 400},
+		{"add", "/admin/addStaff", "moderators", "user2", 200},
+		{"add again", "/admin/addStaff", "moderators", "user2", 200},
+		{"add janitor", "/admin/addStaff", "janitors", "user2", 200},
+		{"remove janitor", "/admin/removeStaff", "janitors", "user2", 200},
+		{"remove last owner", "/admin/removeStaff", "owners", "user1", 400},
+	}
+
+	for _, c := range cases {
+		rec, req := newJSONPair(t, c.url, staffRequest{
+			loginCredentials: sampleLoginCredentials,
+			Board:            "a",
+			Position:         c.position,
+			User:             c.user,
+		})
+		router.ServeHTTP(rec, req)
+		if rec.Code != c.code {
+			t.Errorf("%s: unexpected status code: %d", c.name, rec.Code)
+		}
+	}
+
+	var staff map[string][]string
+	q := r.Table("boards").Get("a").Field("staff")
+	if err := db.One(q, &staff); err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, staff["owners"], []string{"user1"})
+	AssertDeepEquals(t, staff["moderators"], []string{"user2"})
+	if l := len(staff["janitors"]); l != 0 {
+		t.Errorf("unexpected janitor count: %d", l)
+	}
+}
+
+func TestServeModLog(t *testing.T) {
+	assertTableClear(t, "accounts", "modLog")
+	writeSampleUser(t)
+	setBoardOwner(t, "a", "user1")
+	err := db.LogModeration(types.ModLogEntry{
+		Type:  types.ConfigureBoard,
+		Board: "a",
+		By:    "user1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := [...]struct {
+		name, board string
+		page, code  int
+	}{
+		{"not staff", "c", 0, 403},
+		{"global log", "all", 0, 403},
+		{"invalid page", "a", -1, 400},
+		{"past last page", "a", 1, 404},
+		{"valid", "a", 0, 200},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec, req := newJSONPair(t, "/json/modLog/"+c.board, modLogRequest{
+				loginCredentials: sampleLoginCredentials,
+				Page:             c.page,
+			})
+			router.ServeHTTP(rec, req)
+			assertCode(t, rec, c.code)
+		})
+	}
+
+	rec, req := newJSONPair(t, "/json/modLog/a", modLogRequest{
+		loginCredentials: sampleLoginCredentials,
+	})
+	router.ServeHTTP(rec, req)
+	var res []types.ModLogEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Type != types.ConfigureBoard {
+		t.Errorf("unexpected moderation log: %#v", res)
+	}
+}
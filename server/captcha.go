@@ -0,0 +1,57 @@
+// Locally generated captcha challenges
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bakape/meguca/auth"
+	"github.com/bakape/meguca/captcha"
+	"github.com/bakape/meguca/config"
+	"github.com/bakape/meguca/db"
+	"github.com/bakape/meguca/server/websockets"
+)
+
+var errTooManyCaptchas = errors.New("too many captcha requests")
+
+// New captcha challenge. The ID and solution are to be sent back in the
+// types.Captcha of any request, that requires a captcha.
+type captchaResponse struct {
+	ID    string `json:"id"`
+	Image []byte `json:"image"` // Base64-encoded PNG
+}
+
+// Generate a new captcha challenge and serve it to the client
+func serveCaptcha(w http.ResponseWriter, req *http.Request) {
+	if conf := config.Get(); !conf.Captcha || !conf.LocalCaptcha {
+		text404(w)
+		return
+	}
+	if !websockets.AllowCaptcha(auth.GetIP(req)) {
+		http.Error(w, "429 "+errTooManyCaptchas.Error(), 429)
+		return
+	}
+
+	solution, img, err := captcha.New()
+	if err != nil {
+		text500(w, req, err)
+		return
+	}
+	id, err := auth.RandomID(32)
+	if err != nil {
+		text500(w, req, err)
+		return
+	}
+	err = db.InsertCaptcha(id, solution, time.Now().Add(captcha.Expiry))
+	if err != nil {
+		text500(w, req, err)
+		return
+	}
+
+	serveJSON(w, req, "", captchaResponse{
+		ID:    id,
+		Image: img,
+	})
+}
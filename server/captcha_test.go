@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"testing"
+
+	"github.com/bakape/meguca/config"
+	"github.com/bakape/meguca/db"
+	r "github.com/dancannon/gorethink"
+)
+
+func setCaptchaConfigs(enabled, local bool) {
+	conf := config.Defaults
+	conf.Captcha = enabled
+	conf.LocalCaptcha = local
+	config.Set(conf)
+}
+
+func TestServeCaptcha(t *testing.T) {
+	assertTableClear(t, "captchas")
+	defer setCaptchaConfigs(false, false)
+
+	cases := [...]struct {
+		name           string
+		enabled, local bool
+	}{
+		{"disabled", false, true},
+		{"remote provider", true, false},
+	}
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			setCaptchaConfigs(c.enabled, c.local)
+			rec, req := newPair("/captcha")
+			router.ServeHTTP(rec, req)
+			assertCode(t, rec, 404)
+		})
+	}
+
+	setCaptchaConfigs(true, true)
+	rec, req := newPair("/captcha")
+	router.ServeHTTP(rec, req)
+	assertCode(t, rec, 200)
+
+	var res captchaResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(bytes.NewReader(res.Image)); err != nil {
+		t.Fatal(err)
+	}
+
+	var solution string
+	q := r.Table("captchas").Get(res.ID).Field("solution")
+	if err := db.One(q, &solution); err != nil {
+		t.Fatal(err)
+	}
+	solved, err := db.SolveCaptcha(res.ID, solution)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !solved {
+		t.Error("captcha not solved")
+	}
+}
+
+func TestServeCaptchaRateLimit(t *testing.T) {
+	assertTableClear(t, "captchas")
+	defer setCaptchaConfigs(false, false)
+	setCaptchaConfigs(true, true)
+	(*config.Get()).CaptchasPerMinute = 2
+
+	for i, code := range [...]int{200, 200, 429} {
+		rec, req := newPair("/captcha")
+		req.RemoteAddr = "203.0.113.7:1234" // Not shared with other tests
+		router.ServeHTTP(rec, req)
+		if rec.Code != code {
+			t.Fatalf("unexpected status code of request %d: %d", i, rec.Code)
+		}
+	}
+}
@@ -18,6 +18,7 @@ func init() {
 	handleDaemon = func(arg string) {
 		switch arg {
 		case "debug":
+			go handleInterrupt()
 			startServer()
 		case "stop":
 			killDaemon()
@@ -69,6 +70,12 @@ func daemonise() {
 		return nil
 	}, syscall.SIGUSR1)
 
+	// Graceful shutdown
+	daemon.SetSigHandler(func(_ os.Signal) error {
+		shutdown()
+		return daemon.ErrStop
+	}, syscall.SIGTERM, syscall.SIGQUIT)
+
 	go startServer()
 	if err := daemon.ServeSignals(); err != nil {
 		log.Fatalf("daemon runtime error: %s\n", err)
@@ -4,7 +4,9 @@ import (
 	"net/http"
 
 	"github.com/bakape/meguca/auth"
+	"github.com/bakape/meguca/db"
 	"github.com/bakape/meguca/templates"
+	"github.com/bakape/meguca/util"
 	"github.com/mssola/user_agent"
 )
 
@@ -72,6 +74,32 @@ func boardHTML(w http.ResponseWriter, r *http.Request, p map[string]string) {
 	serveHTML(w, r, data, etag)
 }
 
+// Serves a page of the archive of a board. Only available as noscript HTML.
+func archiveHTML(w http.ResponseWriter, r *http.Request, p map[string]string) {
+	b := p["board"]
+	if !auth.IsBoard(b) {
+		text404(w)
+		return
+	}
+	page, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	archive, err := db.GetArchive(b, page)
+	if err != nil {
+		text500(w, r, err)
+		return
+	}
+	last := len(archive.Threads) < db.ArchivePageSize
+	data, err := templates.Archive(b, archive, page, last)
+	if err != nil {
+		text500(w, r, err)
+		return
+	}
+	serveHTML(w, r, data, util.HashBuffer(data))
+}
+
 // Asserts a thread exists on the specific board and renders the index template
 func threadHTML(w http.ResponseWriter, r *http.Request, p map[string]string) {
 	id, ok := validateThread(w, r, p)
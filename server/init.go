@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 	"time"
 
 	"github.com/bakape/meguca/auth"
@@ -95,6 +97,7 @@ func Start() {
 	if isWindows {
 		switch arg {
 		case "debug", "start":
+			go handleInterrupt()
 			startServer()
 		case "init": // For internal use only
 			os.Exit(0)
@@ -155,3 +158,20 @@ func startServer() {
 		log.Fatal(err)
 	}
 }
+
+// Clean up this instance's state in the database before the process exits
+func shutdown() {
+	if err := websockets.RemovePresence(); err != nil {
+		log.Printf("error removing presence: %s\n", err)
+	}
+}
+
+// Shut down gracefully, when the attached server receives an interrupt or
+// termination signal
+func handleInterrupt() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	<-ch
+	shutdown()
+	os.Exit(0)
+}
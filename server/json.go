@@ -214,6 +214,26 @@ func boardJSON(w http.ResponseWriter, r *http.Request, p map[string]string) {
 	serveJSON(w, r, etag, data)
 }
 
+// Serves the JSON of a page of archived threads of a board
+func archiveJSON(w http.ResponseWriter, r *http.Request, p map[string]string) {
+	b := p["board"]
+	if !auth.IsBoard(b) {
+		text404(w)
+		return
+	}
+	page, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := db.GetArchive(b, page)
+	if err != nil {
+		text500(w, r, err)
+		return
+	}
+	serveJSON(w, r, "", data)
+}
+
 // Retrieves board data from the database and the associated etag header. If an
 // error occurred and the calling function should return, ok = false.
 func boardData(w http.ResponseWriter, r *http.Request, b string) (
@@ -322,9 +342,10 @@ func spoilerImage(w http.ResponseWriter, req *http.Request) {
 
 	var res struct {
 		Image    types.Image
+		Board    string
 		Password []byte
 	}
-	q := db.FindPost(msg.ID).Pluck("image", "password").Default(nil)
+	q := db.FindPost(msg.ID).Pluck("image", "board", "password").Default(nil)
 	if err := db.One(q, &res); err != nil {
 		text500(w, req, err)
 		return
@@ -341,6 +362,15 @@ func spoilerImage(w http.ResponseWriter, req *http.Request) {
 		text403(w, err)
 		return
 	}
+	_, banned, err := db.IsBanned(res.Board, auth.GetIP(req))
+	if err != nil {
+		text500(w, req, err)
+		return
+	}
+	if banned {
+		text403(w, auth.ErrBanned)
+		return
+	}
 
 	logMsg, err := websockets.EncodeMessage(websockets.MessageSpoiler, msg.ID)
 	if err != nil {
@@ -385,6 +415,12 @@ func serveBoardTimestamps(w http.ResponseWriter, req *http.Request) {
 	serveJSON(w, req, "", ctrs)
 }
 
+// Serve the number of unique IPs synchronised to all server instances, each
+// board and each thread
+func serveOnlineCounts(w http.ResponseWriter, r *http.Request) {
+	serveJSON(w, r, "", websockets.Clients.OnlineCounts())
+}
+
 // Serve map of internal file type enums to extensions. Needed for
 // version-independent backwards compatibility with external applications.
 func serveExtensionMap(w http.ResponseWriter, r *http.Request) {
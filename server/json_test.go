@@ -463,9 +463,69 @@ func TestServeBoardTimeStamps(t *testing.T) {
 	assertBody(t, rec, `{"a":2,"c":3}`)
 }
 
+func TestServeOnlineCounts(t *testing.T) {
+	t.Parallel()
+	rec, req := newPair("/json/online")
+	router.ServeHTTP(rec, req)
+	assertBody(t, rec, `{"total":0,"boards":{},"threads":{}}`)
+}
+
 func TestServeExtensionMap(t *testing.T) {
 	t.Parallel()
 	rec, req := newPair("/json/extensions")
 	router.ServeHTTP(rec, req)
 	assertCode(t, rec, 200)
 }
+
+func TestArchiveJSON(t *testing.T) {
+	assertTableClear(t, "threads", "posts")
+	setBoards(t, "a")
+	assertInsert(t, "threads", map[string]interface{}{
+		"id":         1,
+		"board":      "a",
+		"postCtr":    1,
+		"archived":   true,
+		"archivedAt": 10,
+	})
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID: 1,
+			},
+			OP:    1,
+			Board: "a",
+		},
+		LastUpdated: 2,
+	})
+
+	cases := [...]struct {
+		name, url, query string
+		code             int
+		body             string
+	}{
+		{"invalid board", "aaa", "", 404, ""},
+		{"invalid page", "a", "?page=-1", 400, ""},
+		{
+			"valid board", "a", "", 200,
+			`{"ctr":0,"threads":[{"archived":true,"postCtr":1,` +
+				`"imageCtr":0,"id":1,"time":0,"lastUpdated":2,` +
+				`"replyTime":0,"board":"a","subject":"",` +
+				`"archivedAt":10}]}`,
+		},
+		{"past last page", "a", "?page=1", 200, `{"ctr":0,"threads":[]}`},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec, req := newPair("/json/" + c.url + "/archive" + c.query)
+			router.ServeHTTP(rec, req)
+			assertCode(t, rec, c.code)
+			if c.code == 200 {
+				assertBody(t, rec, c.body)
+			}
+		})
+	}
+}
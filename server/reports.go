@@ -0,0 +1,163 @@
+// Post reporting by readers and the staff review queue
+
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bakape/meguca/auth"
+	"github.com/bakape/meguca/db"
+	"github.com/bakape/meguca/parser"
+	"github.com/bakape/meguca/server/websockets"
+	"github.com/bakape/meguca/types"
+	r "github.com/dancannon/gorethink"
+)
+
+const maxReportReasonLen = 100
+
+var (
+	errNoReportReason      = errors.New("no report reason")
+	errReportReasonTooLong = parser.ErrTooLong("report reason")
+	errTooManyReports      = errors.New("too many reports")
+	errNoReport            = errors.New("report does not exist")
+)
+
+// Request to report a post for violating the rules
+type reportRequest struct {
+	ID     int64
+	Reason string
+}
+
+// Request for the report queue of a board
+type reportQueueRequest struct {
+	loginCredentials
+	Board string
+}
+
+// Request to resolve a report. If Delete is set, the reported post is deleted
+// and all reports on it are resolved. Otherwise only the report is dismissed.
+type reportResolutionRequest struct {
+	loginCredentials
+	ID     string
+	Delete bool
+}
+
+// Report a post to the staff of its board
+func reportPost(w http.ResponseWriter, req *http.Request) {
+	var msg reportRequest
+	if !decodeJSON(w, req, &msg) {
+		return
+	}
+
+	var err error
+	switch {
+	case msg.Reason == "":
+		err = errNoReportReason
+	case len(msg.Reason) > maxReportReasonLen:
+		err = errReportReasonTooLong
+	}
+	if err != nil {
+		text400(w, err)
+		return
+	}
+
+	ip := auth.GetIP(req)
+	if !websockets.AllowReport(ip) {
+		http.Error(w, "429 "+errTooManyReports.Error(), 429)
+		return
+	}
+
+	post, err := db.GetPost(msg.ID)
+	switch err {
+	case nil:
+	case r.ErrEmptyResult:
+		text400(w, errNoPost)
+		return
+	default:
+		text500(w, req, err)
+		return
+	}
+
+	err = db.InsertReport(types.Report{
+		Target: msg.ID,
+		Board:  post.Board,
+		Reason: msg.Reason,
+		IP:     ip,
+	})
+	if err != nil {
+		text500(w, req, err)
+	}
+}
+
+// Serve all unresolved reports on a board to its staff
+func serveReports(w http.ResponseWriter, req *http.Request) {
+	var msg reportQueueRequest
+	isValid := decodeJSON(w, req, &msg) &&
+		isLoggedIn(w, req, msg.UserID, msg.Session)
+	if !isValid {
+		return
+	}
+	if !auth.IsStaff(msg.UserID, msg.Board) {
+		text403(w, errAccessDenied)
+		return
+	}
+
+	reports, err := db.GetReports(msg.Board)
+	if err != nil {
+		text500(w, req, err)
+		return
+	}
+	serveJSON(w, req, "", reports)
+}
+
+// Dismiss a report or delete the reported post
+func resolveReport(w http.ResponseWriter, req *http.Request) {
+	var msg reportResolutionRequest
+	isValid := decodeJSON(w, req, &msg) &&
+		isLoggedIn(w, req, msg.UserID, msg.Session)
+	if !isValid {
+		return
+	}
+
+	report, err := db.GetReport(msg.ID)
+	switch err {
+	case nil:
+	case r.ErrEmptyResult:
+		text400(w, errNoReport)
+		return
+	default:
+		text500(w, req, err)
+		return
+	}
+
+	if !msg.Delete {
+		if !auth.IsStaff(msg.UserID, report.Board) {
+			text403(w, errAccessDenied)
+			return
+		}
+		if err := db.DeleteReport(msg.ID); err != nil {
+			text500(w, req, err)
+		}
+		return
+	}
+
+	if !canPerform(w, report.Board, msg.UserID, auth.DeletePost) {
+		return
+	}
+	if err := websockets.DeletePost(report.Target); err != nil {
+		text500(w, req, err)
+		return
+	}
+	if err := db.DeleteReportsOnPost(report.Board, report.Target); err != nil {
+		text500(w, req, err)
+		return
+	}
+	logModeration(w, req, types.ModLogEntry{
+		Type:   types.DeletePost,
+		Target: report.Target,
+		Board:  report.Board,
+		By:     msg.UserID,
+		Data:   report.Reason,
+	})
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bakape/meguca/db"
+	"github.com/bakape/meguca/types"
+)
+
+func TestReportPost(t *testing.T) {
+	assertTableClear(t, "posts", "reports")
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID: 1,
+			},
+			OP:    1,
+			Board: "a",
+		},
+	})
+
+	cases := [...]struct {
+		name, reason string
+		id           int64
+		code         int
+	}{
+		{"no reason", "", 1, 400},
+		{"reason too long", genString(maxReportReasonLen + 1), 1, 400},
+		{"no post", "foo", 99, 400},
+		{"valid", "foo", 1, 200},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			rec, req := newJSONPair(t, "/json/report", reportRequest{
+				ID:     c.id,
+				Reason: c.reason,
+			})
+			router.ServeHTTP(rec, req)
+			assertCode(t, rec, c.code)
+		})
+	}
+
+	reports, err := db.GetReports("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("unexpected reports: %#v", reports)
+	}
+	r := reports[0]
+	if r.Target != 1 || r.Reason != "foo" || r.Board != "a" {
+		t.Errorf("unexpected report: %#v", r)
+	}
+}
+
+func TestReportRateLimit(t *testing.T) {
+	assertTableClear(t, "posts", "reports")
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID: 1,
+			},
+			OP:    1,
+			Board: "a",
+		},
+	})
+
+	report := func(code int) {
+		rec, req := newJSONPair(t, "/json/report", reportRequest{
+			ID:     1,
+			Reason: "foo",
+		})
+		req.RemoteAddr = "203.0.113.8:1234" // Not shared with other tests
+		router.ServeHTTP(rec, req)
+		assertCode(t, rec, code)
+	}
+
+	for i := 0; i < 5; i++ {
+		report(200)
+	}
+	report(429)
+
+	// Resolving reports does not reset the limit
+	assertTableClear(t, "reports")
+	report(429)
+}
+
+func TestServeReports(t *testing.T) {
+	assertTableClear(t, "accounts", "reports")
+	writeSampleUser(t)
+	setBoardOwner(t, "a", "user1")
+	assertInsert(t, "reports", types.Report{
+		ID:     "foo",
+		Target: 1,
+		Board:  "a",
+		Reason: "bar",
+	})
+
+	rec, req := newJSONPair(t, "/admin/reports", reportQueueRequest{
+		loginCredentials: sampleLoginCredentials,
+		Board:            "c",
+	})
+	router.ServeHTTP(rec, req)
+	assertCode(t, rec, 403)
+
+	rec, req = newJSONPair(t, "/admin/reports", reportQueueRequest{
+		loginCredentials: sampleLoginCredentials,
+		Board:            "a",
+	})
+	router.ServeHTTP(rec, req)
+	assertCode(t, rec, 200)
+
+	var res []types.Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].ID != "foo" {
+		t.Errorf("unexpected reports: %#v", res)
+	}
+}
+
+func TestResolveReport(t *testing.T) {
+	assertTableClear(t, "accounts", "reports", "posts", "threads")
+	writeSampleUser(t)
+	setBoardOwner(t, "a", "user1")
+	assertInsert(t, "threads", types.DatabaseThread{
+		ID:      1,
+		Board:   "a",
+		PostCtr: 1,
+	})
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID: 2,
+			},
+			OP:    1,
+			Board: "a",
+		},
+		Log: [][]byte{},
+	})
+	assertInsert(t, "reports", []types.Report{
+		{ID: "1", Target: 2, Board: "a"},
+		{ID: "2", Target: 2, Board: "a"},
+		{ID: "3", Target: 2, Board: "a"},
+	})
+
+	cases := [...]struct {
+		name, id string
+		del      bool
+		code     int
+	}{
+		{"no report", "99", false, 400},
+		{"dismiss", "1", false, 200},
+		{"delete post", "2", true, 200},
+	}
+
+	for _, c := range cases {
+		msg := reportResolutionRequest{
+			loginCredentials: sampleLoginCredentials,
+			ID:               c.id,
+			Delete:           c.del,
+		}
+		rec, req := newJSONPair(t, "/admin/resolveReport", msg)
+		router.ServeHTTP(rec, req)
+		if rec.Code != c.code {
+			t.Errorf("%s: unexpected status code: %d", c.name, rec.Code)
+		}
+	}
+
+	reports, err := db.GetReports("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 0 {
+		t.Errorf("reports not resolved: %#v", reports)
+	}
+
+	var deleted bool
+	if err := db.One(db.FindPost(2).Field("deleted"), &deleted); err != nil {
+		t.Fatal(err)
+	}
+	if !deleted {
+		t.Error("reported post not deleted")
+	}
+}
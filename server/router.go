@@ -63,11 +63,13 @@ func createRouter() http.Handler {
 	// HTML
 	r.GET("/", wrapHandler(redirectToDefault))
 	r.GET("/:board/", boardHTML)
+	r.GET("/:board/archive", archiveHTML)
 	r.GET("/:board/:thread", threadHTML)
 
 	// JSON API
 	json := r.NewGroup("/json")
 	json.GET("/:board/", boardJSON)
+	json.GET("/:board/archive", archiveJSON)
 	json.GET("/:board/:thread", threadJSON)
 	json.GET("/post/:post", servePost)
 	json.GET("/config", wrapHandler(serveConfigs))
@@ -77,17 +79,28 @@ func createRouter() http.Handler {
 	json.GET("/positions/:position/:user", serveStaffPositions)
 	json.POST("/spoiler", wrapHandler(spoilerImage))
 	json.GET("/boardTimestamps", wrapHandler(serveBoardTimestamps))
+	json.GET("/online", wrapHandler(serveOnlineCounts))
+	json.POST("/modLog/:board", serveModLog)
+	json.POST("/report", wrapHandler(reportPost))
 
 	// Administration JSON API for logged in users
 	admin := r.NewGroup("/admin")
 	admin.POST("/configureBoard", wrapHandler(configureBoard))
 	admin.POST("/boardConfig", wrapHandler(servePrivateBoardConfigs))
+	admin.POST("/ban", wrapHandler(banPoster))
+	admin.POST("/addStaff", wrapHandler(addStaff))
+	admin.POST("/removeStaff", wrapHandler(removeStaff))
+	admin.POST("/reports", wrapHandler(serveReports))
+	admin.POST("/resolveReport", wrapHandler(resolveReport))
 
 	// Assets
 	r.GET("/assets/*path", serveAssets)
 	r.GET("/images/*path", serveImages)
 	r.GET("/worker.js", wrapHandler(serveWorker))
 
+	// Locally generated captchas
+	r.GET("/captcha", wrapHandler(serveCaptcha))
+
 	// Websocket API
 	r.GET("/socket", wrapHandler(websockets.Handler))
 
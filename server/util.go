@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 
 	"github.com/bakape/meguca/auth"
 	"github.com/bakape/meguca/util"
@@ -51,6 +52,22 @@ func logError(r *http.Request, err interface{}) {
 	}
 }
 
+// Parse the zero-indexed page number from the "page" query parameter. Defaults
+// to the first page. If the page number is invalid, writes 400 and returns
+// false.
+func parsePage(w http.ResponseWriter, r *http.Request) (int, bool) {
+	s := r.URL.Query().Get("page")
+	if s == "" {
+		return 0, true
+	}
+	page, err := strconv.Atoi(s)
+	if err != nil || page < 0 {
+		text400(w, errInvalidPage)
+		return 0, false
+	}
+	return page, true
+}
+
 // Text-only 404 response
 func text404(w http.ResponseWriter) {
 	http.Error(w, "404 Not found", 404)
@@ -158,6 +158,7 @@ func commitLogin(code loginResponseCode, typ MessageType, id string, c *Client)
 
 		c.sessionToken = msg.Session
 		c.UserID = id
+		Clients.setUser(c, id)
 	}
 
 	return c.sendMessage(typ, msg)
@@ -228,6 +229,7 @@ func authenticateSession(data []byte, c *Client) error {
 	if isSession {
 		c.sessionToken = req.Session
 		c.UserID = req.ID
+		Clients.setUser(c, req.ID)
 	}
 
 	return c.sendMessage(MessageAuthenticate, isSession)
@@ -255,6 +257,7 @@ func logOut(_ []byte, c *Client) error {
 func commitLogout(query r.Term, c *Client) error {
 	c.UserID = ""
 	c.sessionToken = ""
+	Clients.setUser(c, "")
 	if err := db.Write(query); err != nil {
 		return err
 	}
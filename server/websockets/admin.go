@@ -9,6 +9,7 @@ import (
 
 	"github.com/bakape/meguca/config"
 	"github.com/bakape/meguca/db"
+	"github.com/bakape/meguca/parser"
 	"github.com/bakape/meguca/types"
 	r "github.com/dancannon/gorethink"
 )
@@ -47,16 +48,34 @@ func configServer(data []byte, c *Client) error {
 	if err := decodeMessage(data, &conf); err != nil {
 		return err
 	}
+	if err := parser.ValidateFilters(conf.Filters); err != nil {
+		return err
+	}
 
 	query := db.GetMain("config").
 		Replace(func(doc r.Term) r.Term {
-			return r.Expr(conf).Merge(map[string]string{
+			merge := map[string]interface{}{
 				"id": "config",
-			})
+			}
+
+			// Filters are only modified, if sent
+			if conf.Filters == nil {
+				merge["filters"] = doc.Field("filters").Default(nil)
+			}
+
+			return r.Expr(conf).Merge(merge)
 		})
 	if err := db.Write(query); err != nil {
 		return err
 	}
+	err := db.LogModeration(types.ModLogEntry{
+		Type:  types.ConfigureServer,
+		Board: "all",
+		By:    c.UserID,
+	})
+	if err != nil {
+		return err
+	}
 
 	return c.sendMessage(MessageConfigServer, true)
 }
@@ -105,6 +124,14 @@ func createBoard(data []byte, c *Client) error {
 	} else if err != nil {
 		return err
 	}
+	err := db.LogModeration(types.ModLogEntry{
+		Type:  types.CreateBoard,
+		Board: req.Name,
+		By:    c.UserID,
+	})
+	if err != nil {
+		return err
+	}
 
 	return c.sendMessage(MessageCreateBoard, boardCreated)
 }
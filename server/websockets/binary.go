@@ -0,0 +1,405 @@
+// Compact binary websocket message encoding. Message payloads are transcoded
+// between JSON and the MessagePack format, so all message types and the
+// replication log support both encodings without separate serialization code.
+
+package websockets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Encoding of messages sent to and received from a client. Negotiated with the
+// synchronisation request.
+type Encoding uint8
+
+const (
+	// TextEncoding is the default encoding. Messages are sent as text frames
+	// and consist of a two character message type and a JSON payload.
+	TextEncoding Encoding = iota
+
+	// BinaryEncoding sends messages as binary frames consisting of a single
+	// byte message type and a MessagePack payload
+	BinaryEncoding
+)
+
+var errInvalidBinary = errors.New("invalid binary payload")
+
+// Convert a text-encoded message, as stored in the replication log and update
+// feed buffers, to the binary encoding. The null-byte separated parts of
+// MessageConcat are converted to an array of binary messages.
+func textToBinary(msg []byte) ([]byte, error) {
+	if len(msg) < 2 {
+		return nil, errInvalidPayload(msg)
+	}
+	uncast, err := strconv.ParseUint(string(msg[:2]), 10, 8)
+	if err != nil {
+		return nil, errInvalidPayload(msg)
+	}
+	typ := MessageType(uncast)
+	data := msg[2:]
+
+	if typ != MessageConcat {
+		payload, err := jsonToBinary(data)
+		if err != nil {
+			return nil, err
+		}
+		return prependMessageType(BinaryEncoding, typ, payload), nil
+	}
+
+	parts := bytes.Split(data, []byte{0})
+	var buf bytes.Buffer
+	buf.WriteByte(byte(MessageConcat))
+	writeBinaryLength(&buf, len(parts), 0x90, 0xdc)
+	for _, p := range parts {
+		conv, err := textToBinary(p)
+		if err != nil {
+			return nil, err
+		}
+		writeBinaryBytes(&buf, conv)
+	}
+	return buf.Bytes(), nil
+}
+
+// Convert a JSON payload to MessagePack
+func jsonToBinary(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeBinaryValue(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write a value decoded from JSON as MessagePack
+func writeBinaryValue(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		return writeBinaryNumber(buf, v)
+	case string:
+		writeBinaryLength(buf, len(v), 0xa0, 0xda)
+		buf.WriteString(v)
+	case []interface{}:
+		writeBinaryLength(buf, len(v), 0x90, 0xdc)
+		for _, v := range v {
+			if err := writeBinaryValue(buf, v); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		// Sort keys for deterministic output
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		writeBinaryLength(buf, len(v), 0x80, 0xde)
+		for _, k := range keys {
+			writeBinaryLength(buf, len(k), 0xa0, 0xda)
+			buf.WriteString(k)
+			if err := writeBinaryValue(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return errInvalidBinary
+	}
+	return nil
+}
+
+// Write a JSON number as the smallest fitting MessagePack integer or a 64 bit
+// float
+func writeBinaryNumber(buf *bytes.Buffer, n json.Number) error {
+	if i, err := n.Int64(); err == nil {
+		writeBinaryInt(buf, i)
+		return nil
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, u)
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	buf.WriteByte(0xcb)
+	binary.Write(buf, binary.BigEndian, f)
+	return nil
+}
+
+func writeBinaryInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		buf.WriteByte(byte(i))
+	case i >= -32 && i < 0:
+		buf.WriteByte(byte(int8(i)))
+	case i >= 0 && i <= math.MaxUint8:
+		buf.Write([]byte{0xcc, byte(i)})
+	case i >= 0 && i <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(i))
+	case i >= 0 && i <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(i))
+	case i >= 0:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, uint64(i))
+	case i >= math.MinInt8:
+		buf.Write([]byte{0xd0, byte(int8(i))})
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+// Write the header of a string, array or map. fix is the type byte of the
+// fixed size variant and wide the type byte of the 16 bit length variant.
+// The 32 bit length variant always follows the 16 bit one.
+func writeBinaryLength(buf *bytes.Buffer, l int, fix, wide byte) {
+	// Fixed size strings can be up to 31 bytes, arrays and maps up to 15
+	// elements
+	max := 15
+	if fix == 0xa0 {
+		max = 31
+	}
+
+	switch {
+	case l <= max:
+		buf.WriteByte(fix | byte(l))
+	case fix == 0xa0 && l <= math.MaxUint8:
+		buf.Write([]byte{0xd9, byte(l)})
+	case l <= math.MaxUint16:
+		buf.WriteByte(wide)
+		binary.Write(buf, binary.BigEndian, uint16(l))
+	default:
+		buf.WriteByte(wide + 1)
+		binary.Write(buf, binary.BigEndian, uint32(l))
+	}
+}
+
+// Write a MessagePack byte array
+func writeBinaryBytes(buf *bytes.Buffer, b []byte) {
+	l := len(b)
+	switch {
+	case l <= math.MaxUint8:
+		buf.Write([]byte{0xc4, byte(l)})
+	case l <= math.MaxUint16:
+		buf.WriteByte(0xc5)
+		binary.Write(buf, binary.BigEndian, uint16(l))
+	default:
+		buf.WriteByte(0xc6)
+		binary.Write(buf, binary.BigEndian, uint32(l))
+	}
+	buf.Write(b)
+}
+
+// Convert a MessagePack payload received from the client to JSON, so it can be
+// passed to the message handlers. Byte arrays are converted to base64 strings,
+// as expected by encoding/json.
+func binaryToJSON(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	r := binaryReader{data: data}
+	v, err := r.readValue(0)
+	if err != nil {
+		return nil, err
+	}
+	if r.pos != len(data) {
+		return nil, errInvalidBinary
+	}
+	return json.Marshal(v)
+}
+
+// Maximum nesting depth of decoded MessagePack values
+const maxBinaryDepth = 32
+
+// Decodes MessagePack values from a byte slice
+type binaryReader struct {
+	pos  int
+	data []byte
+}
+
+// Read the next n bytes
+func (r *binaryReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.data)-r.pos < n {
+		return nil, errInvalidBinary
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// Read a big endian unsigned integer of n bytes
+func (r *binaryReader) readUint(n int) (uint64, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, b := range b {
+		u = u<<8 | uint64(b)
+	}
+	return u, nil
+}
+
+// Read a big endian signed integer of n bytes
+func (r *binaryReader) readInt(n int) (int64, error) {
+	u, err := r.readUint(n)
+	if err != nil {
+		return 0, err
+	}
+	shift := uint(64 - n*8)
+	return int64(u<<shift) >> shift, nil
+}
+
+// Read the length of a variable size value with n length bytes
+func (r *binaryReader) readLength(n int) (int, error) {
+	u, err := r.readUint(n)
+	if err != nil {
+		return 0, err
+	}
+	// Each element is at least one byte long, which bounds allocations by the
+	// message size
+	if u > uint64(len(r.data)-r.pos) {
+		return 0, errInvalidBinary
+	}
+	return int(u), nil
+}
+
+func (r *binaryReader) readValue(depth int) (interface{}, error) {
+	if depth > maxBinaryDepth {
+		return nil, errInvalidBinary
+	}
+	b, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := b[0]; {
+	case t <= 0x7f:
+		return int64(t), nil
+	case t >= 0xe0:
+		return int64(int8(t)), nil
+	case t&0xf0 == 0x80:
+		return r.readMap(int(t&0x0f), depth)
+	case t&0xf0 == 0x90:
+		return r.readArray(int(t&0x0f), depth)
+	case t&0xe0 == 0xa0:
+		return r.readString(int(t & 0x1f))
+	}
+
+	var l int
+	switch t := b[0]; t {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		if l, err = r.readLength(1 << (t - 0xc4)); err != nil {
+			return nil, err
+		}
+		bin, err := r.next(l)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(bin), nil
+	case 0xca:
+		u, err := r.readUint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := r.readUint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return r.readUint(1 << (t - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		return r.readInt(1 << (t - 0xd0))
+	case 0xd9, 0xda, 0xdb:
+		if l, err = r.readLength(1 << (t - 0xd9)); err != nil {
+			return nil, err
+		}
+		return r.readString(l)
+	case 0xdc, 0xdd:
+		if l, err = r.readLength(2 << (t - 0xdc)); err != nil {
+			return nil, err
+		}
+		return r.readArray(l, depth)
+	case 0xde, 0xdf:
+		if l, err = r.readLength(2 << (t - 0xde)); err != nil {
+			return nil, err
+		}
+		return r.readMap(l, depth)
+	default:
+		return nil, errInvalidBinary
+	}
+}
+
+func (r *binaryReader) readString(l int) (string, error) {
+	b, err := r.next(l)
+	return string(b), err
+}
+
+func (r *binaryReader) readArray(l, depth int) ([]interface{}, error) {
+	arr := make([]interface{}, l)
+	for i := range arr {
+		v, err := r.readValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+	return arr, nil
+}
+
+// Only string keys are supported, as JSON objects can not have any other
+func (r *binaryReader) readMap(l, depth int) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, l)
+	for i := 0; i < l; i++ {
+		k, err := r.readValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, errInvalidBinary
+		}
+		if m[key], err = r.readValue(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
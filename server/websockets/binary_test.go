@@ -0,0 +1,243 @@
+package websockets
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/bakape/meguca/test"
+	"github.com/gorilla/websocket"
+)
+
+func TestJSONToBinary(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in string
+		out      []byte
+	}{
+		{"empty", "", nil},
+		{"null", "null", []byte{0xc0}},
+		{"bool", "true", []byte{0xc3}},
+		{"positive fixint", "127", []byte{0x7f}},
+		{"negative fixint", "-32", []byte{0xe0}},
+		{"uint8", "200", []byte{0xcc, 200}},
+		{"uint16", "256", []byte{0xcd, 1, 0}},
+		{"int8", "-33", []byte{0xd0, 0xdf}},
+		{"uint64", "18446744073709551615", []byte{
+			0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		}},
+		{"float", "0.5", []byte{0xcb, 0x3f, 0xe0, 0, 0, 0, 0, 0, 0}},
+		{"fixstr", `"abc"`, []byte{0xa3, 'a', 'b', 'c'}},
+		{"append message", "[1,97]", []byte{0x92, 0x01, 0x61}},
+		{
+			"map with sorted keys",
+			`{"b":1,"a":null}`,
+			[]byte{0x82, 0xa1, 'a', 0xc0, 0xa1, 'b', 0x01},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := jsonToBinary([]byte(c.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertDeepEquals(t, res, c.out)
+		})
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]string{
+		`null`,
+		`false`,
+		`-70000`,
+		`4294967296`,
+		`-1.25`,
+		`"` + strings.Repeat("a", 40) + `"`,
+		`"` + strings.Repeat("a", 300) + `"`,
+		`[1,[2,[3]],{"a":"b"}]`,
+		`{"id":1,"links":[[2,3]],"board":"a","editing":true}`,
+		`[` + strings.Repeat("0,", 20) + `0]`,
+	}
+
+	for i := range cases {
+		in := cases[i]
+		t.Run(in, func(t *testing.T) {
+			t.Parallel()
+
+			bin, err := jsonToBinary([]byte(in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := binaryToJSON(bin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var std, res interface{}
+			if err := json.Unmarshal([]byte(in), &std); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(out, &res); err != nil {
+				t.Fatal(err)
+			}
+			AssertDeepEquals(t, res, std)
+		})
+	}
+}
+
+func TestBinaryToJSONByteArray(t *testing.T) {
+	t.Parallel()
+
+	res, err := binaryToJSON([]byte{0xc4, 0x02, 'h', 'i'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const std = `"aGk="`
+	if s := string(res); s != std {
+		LogUnexpected(t, std, s)
+	}
+}
+
+func TestInvalidBinary(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		in   []byte
+	}{
+		{"truncated", []byte{0xcd, 0x01}},
+		{"trailing data", []byte{0x01, 0x02}},
+		{"non-string key", []byte{0x81, 0x01, 0x01}},
+		{"length overflow", []byte{0xdd, 0xff, 0xff, 0xff, 0xff}},
+		{"unsupported type", []byte{0xc1}},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := binaryToJSON(c.in); err != errInvalidBinary {
+				UnexpectedError(t, err)
+			}
+		})
+	}
+}
+
+func TestEncodeBinaryMessage(t *testing.T) {
+	t.Parallel()
+
+	msg, err := EncodeMessageAs(
+		BinaryEncoding,
+		MessageAppend,
+		[2]int64{1, 'a'},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, msg, []byte{byte(MessageAppend), 0x92, 0x01, 0x61})
+}
+
+func TestTextToBinary(t *testing.T) {
+	t.Parallel()
+
+	res, err := textToBinary([]byte("03[1,97]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, res, []byte{byte(MessageAppend), 0x92, 0x01, 0x61})
+
+	// Concatenated messages are converted to an array of binary messages
+	res, err = textToBinary([]byte("42041\u0000062"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []byte{
+		byte(MessageConcat), 0x92,
+		0xc4, 0x02, byte(MessageBackspace), 0x01,
+		0xc4, 0x02, byte(MessageClosePost), 0x02,
+	}
+	AssertDeepEquals(t, res, std)
+}
+
+func TestBinaryNegotiation(t *testing.T) {
+	setBoardConfigs(t, false)
+	defer Clients.Clear()
+	defer feeds.Clear()
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, wcl := sv.NewClient()
+
+	msg := syncRequest{
+		Binary: true,
+		Board:  "a",
+	}
+	if err := synchronise(marshalJSON(t, msg), cl); err != nil {
+		t.Fatal(err)
+	}
+	if cl.encoding != BinaryEncoding {
+		t.Fatal("binary encoding not negotiated")
+	}
+
+	typ, res, err := wcl.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != websocket.BinaryMessage {
+		t.Fatalf("invalid received message format: %d", typ)
+	}
+	AssertDeepEquals(t, res, []byte{byte(MessageSynchronise), 0x80})
+
+	// Binary frames are accepted after negotiation
+	frame := []byte{byte(MessageNOOP)}
+	if err := cl.handleMessage(websocket.BinaryMessage, frame); err != nil {
+		t.Fatal(err)
+	}
+
+	// Text-encoded feed messages are converted on sending
+	if err := cl.send([]byte("06[2]")); err != nil {
+		t.Fatal(err)
+	}
+	_, res, err = wcl.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, res, []byte{byte(MessageClosePost), 0x91, 0x02})
+}
+
+func TestSharedBinaryEncoding(t *testing.T) {
+	t.Parallel()
+
+	var cls [2]*Client
+	for i := range cls {
+		cls[i] = &Client{
+			sendExternal: make(chan *outgoingMessage, 1),
+		}
+	}
+	sendToAll(cls[:], []byte("06[2]"))
+
+	var frames [2][]byte
+	for i, cl := range cls {
+		msg := <-cl.sendExternal
+		conv, err := msg.toBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertDeepEquals(t, conv, []byte{byte(MessageClosePost), 0x91, 0x02})
+		frames[i] = conv
+	}
+
+	// Transcoded only once for all clients
+	if &frames[0][0] != &frames[1][0] {
+		t.Error("binary encoding not shared")
+	}
+}
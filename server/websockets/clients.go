@@ -1,21 +1,41 @@
 package websockets
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/bakape/meguca/auth"
+	"github.com/bakape/meguca/db"
+)
 
 // Clients stores all synchronized websocket clients in a thread-safe map
 var Clients = ClientMap{
 	// Start with 100 to avoid reallocations on server start
 	clients: make(map[*Client]SyncID, 100),
+	users:   make(map[*Client]string),
 }
 
 // ClientMap is a thread-safe store for all clients connected to this server
-// instance
+// instance. Also holds the clients of other server instances sharing the
+// database, as last read from the presence registry.
 type ClientMap struct {
 	// Map of clients to the threads or boards they are synced to
 	clients map[*Client]SyncID
+	// Map of logged in clients to their user IDs
+	users map[*Client]string
+	// Clients synchronised to other server instances
+	remote []db.PresenceClient
 	sync.RWMutex
 }
 
+// OnlineCounts contains the number of unique IPs synchronised to all server
+// instances, to each board and to each thread. Board counts include clients
+// synchronised to threads on the board.
+type OnlineCounts struct {
+	Total   int            `json:"total"`
+	Boards  map[string]int `json:"boards"`
+	Threads map[int64]int  `json:"threads"`
+}
+
 // SyncID contains the board and thread the client are currently synced to. If
 // the client is on the board page, thread = 0.
 type SyncID struct {
@@ -43,24 +63,197 @@ func (c *ClientMap) remove(cl *Client) {
 	c.Lock()
 	defer c.Unlock()
 	delete(c.clients, cl)
+	delete(c.users, cl)
+}
+
+// Set the user ID the client is logged in as. An empty string denotes the
+// client has logged out.
+func (c *ClientMap) setUser(cl *Client, id string) {
+	c.Lock()
+	defer c.Unlock()
+	if id == "" {
+		delete(c.users, cl)
+	} else {
+		c.users[cl] = id
+	}
 }
 
-// CountByIP returns the number of unique IPs synchronized with the server
+// SendToStaff sends a message to all clients logged in as staff of the board
+func (c *ClientMap) SendToStaff(board string, msg []byte) {
+	c.RLock()
+	defer c.RUnlock()
+	for cl, id := range c.users {
+		if auth.IsStaff(id, board) {
+			cl.Send(msg)
+		}
+	}
+}
+
+// Run fn for every client synchronised to any server instance. Must be called
+// with the read lock held.
+func (c *ClientMap) forEach(fn func(cl db.PresenceClient)) {
+	for cl, sync := range c.clients {
+		fn(db.PresenceClient{
+			IP:     cl.IP,
+			Board:  sync.Board,
+			OP:     sync.OP,
+			Typing: cl.isTyping(),
+		})
+	}
+	for _, cl := range c.remote {
+		fn(cl)
+	}
+}
+
+// CountByIP returns the number of unique IPs synchronized with all server
+// instances
 func (c *ClientMap) CountByIP() int {
 	c.RLock()
-	ips := make(map[string]bool, len(c.clients))
-	for cl := range c.clients {
+	ips := make(map[string]bool, len(c.clients)+len(c.remote))
+	c.forEach(func(cl db.PresenceClient) {
 		ips[cl.IP] = true
-	}
+	})
 	c.RUnlock()
 	return len(ips)
 }
 
+// OnlineCounts returns the number of unique IPs synchronised to all server
+// instances, each board and each thread
+func (c *ClientMap) OnlineCounts() OnlineCounts {
+	var (
+		ips     = make(map[string]bool)
+		boards  = make(map[string]map[string]bool)
+		threads = make(map[int64]map[string]bool)
+	)
+	add := func(set map[string]bool, ip string) map[string]bool {
+		if set == nil {
+			set = make(map[string]bool)
+		}
+		set[ip] = true
+		return set
+	}
+
+	c.RLock()
+	c.forEach(func(cl db.PresenceClient) {
+		ips[cl.IP] = true
+		boards[cl.Board] = add(boards[cl.Board], cl.IP)
+		if cl.OP != 0 {
+			threads[cl.OP] = add(threads[cl.OP], cl.IP)
+		}
+	})
+	c.RUnlock()
+
+	counts := OnlineCounts{
+		Total:   len(ips),
+		Boards:  make(map[string]int, len(boards)),
+		Threads: make(map[int64]int, len(threads)),
+	}
+	for b, set := range boards {
+		counts.Boards[b] = len(set)
+	}
+	for id, set := range threads {
+		counts.Threads[id] = len(set)
+	}
+	return counts
+}
+
+// Returns the number of unique IPs synchronised to each thread and clients
+// with an open post in it across all server instances
+func (c *ClientMap) threadViewers() map[int64]viewerCounts {
+	ips := make(map[int64]map[string]bool)
+	counts := make(map[int64]viewerCounts)
+
+	c.RLock()
+	c.forEach(func(cl db.PresenceClient) {
+		if cl.OP == 0 {
+			return
+		}
+		set := ips[cl.OP]
+		if set == nil {
+			set = make(map[string]bool)
+			ips[cl.OP] = set
+		}
+		set[cl.IP] = true
+		if cl.Typing {
+			n := counts[cl.OP]
+			n.Typing++
+			counts[cl.OP] = n
+		}
+	})
+	c.RUnlock()
+
+	for op, set := range ips {
+		n := counts[op]
+		n.IPs = len(set)
+		counts[op] = n
+	}
+	return counts
+}
+
+// Returns the clients synchronised to this server instance for publishing to
+// the presence registry
+func (c *ClientMap) presence() []db.PresenceClient {
+	c.RLock()
+	defer c.RUnlock()
+	pres := make([]db.PresenceClient, 0, len(c.clients))
+	for cl, sync := range c.clients {
+		pres = append(pres, db.PresenceClient{
+			IP:     cl.IP,
+			Board:  sync.Board,
+			OP:     sync.OP,
+			Typing: cl.isTyping(),
+		})
+	}
+	return pres
+}
+
+// Set the clients synchronised to other server instances
+func (c *ClientMap) setRemote(remote []db.PresenceClient) {
+	c.Lock()
+	defer c.Unlock()
+	c.remote = remote
+}
+
+// Send the online count of each client's thread or board page to the client
+func (c *ClientMap) sendOnlineCounts() {
+	counts := c.OnlineCounts()
+
+	// Clients viewing the same count share the encoded message
+	encoded := make(map[int][]byte)
+
+	c.RLock()
+	defer c.RUnlock()
+	for cl, sync := range c.clients {
+		var n int
+		switch {
+		case sync.OP != 0:
+			n = counts.Threads[sync.OP]
+		case sync.Board == "all":
+			n = counts.Total
+		default:
+			n = counts.Boards[sync.Board]
+		}
+
+		msg, ok := encoded[n]
+		if !ok {
+			var err error
+			msg, err = EncodeMessage(MessageOnline, n)
+			if err != nil {
+				continue
+			}
+			encoded[n] = msg
+		}
+		cl.Send(msg)
+	}
+}
+
 // Clear removes all clients from the map
 func (c *ClientMap) Clear() {
 	c.Lock()
 	defer c.Unlock()
 	c.clients = make(map[*Client]SyncID)
+	c.users = make(map[*Client]string)
+	c.remote = nil
 }
 
 // GetSync returns if the current client is synced and  the thread and board it
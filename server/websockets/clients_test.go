@@ -3,12 +3,15 @@ package websockets
 import (
 	"testing"
 
+	"github.com/bakape/meguca/config"
+	"github.com/bakape/meguca/db"
 	. "github.com/bakape/meguca/test"
 )
 
 func newClientMap() *ClientMap {
 	return &ClientMap{
 		clients: make(map[*Client]SyncID),
+		users:   make(map[*Client]string),
 	}
 }
 
@@ -91,4 +94,122 @@ func TestCountByIP(t *testing.T) {
 	if count := m.CountByIP(); count != 2 {
 		LogUnexpected(t, 2, count)
 	}
+
+	// Clients of other server instances
+	m.setRemote([]db.PresenceClient{
+		{IP: "bar", Board: "a"},
+		{IP: "baz", Board: "c", OP: 3},
+	})
+	if count := m.CountByIP(); count != 3 {
+		LogUnexpected(t, 3, count)
+	}
+}
+
+func newOnlineClientMap(sv *mockWSServer) (
+	*ClientMap, [3]*Client,
+) {
+	m := newClientMap()
+	var cls [3]*Client
+	ids := [...]SyncID{
+		{OP: 1, Board: "a"},
+		{OP: 1, Board: "a"},
+		{Board: "a"},
+	}
+	for i := range cls {
+		cl, _ := sv.NewClient()
+		cl.IP = "foo"
+		cls[i] = cl
+		m.add(cl, ids[i])
+	}
+	cls[1].IP = "bar"
+	m.setRemote([]db.PresenceClient{
+		{IP: "foo", Board: "a", OP: 2},
+		{IP: "baz", Board: "a", OP: 1},
+		{IP: "baz", Board: "c"},
+	})
+	return m, cls
+}
+
+func TestOnlineCounts(t *testing.T) {
+	t.Parallel()
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	m, _ := newOnlineClientMap(sv)
+
+	std := OnlineCounts{
+		Total: 3,
+		Boards: map[string]int{
+			"a": 3,
+			"c": 1,
+		},
+		Threads: map[int64]int{
+			1: 3,
+			2: 1,
+		},
+	}
+	AssertDeepEquals(t, m.OnlineCounts(), std)
+}
+
+func TestSendOnlineCounts(t *testing.T) {
+	t.Parallel()
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	m, cls := newOnlineClientMap(sv)
+
+	m.sendOnlineCounts()
+
+	for _, cl := range cls {
+		select {
+		case msg := <-cl.sendExternal:
+			const std = "503"
+			if s := string(msg.text); s != std {
+				LogUnexpected(t, std, s)
+			}
+		default:
+			t.Error("online count not sent")
+		}
+	}
+}
+
+func TestSendToStaff(t *testing.T) {
+	config.ClearBoards()
+	_, err := config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		Staff: map[string][]string{
+			"janitors": {"janitor"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newClientMap()
+	sv := newWSServer(t)
+	defer sv.Close()
+
+	staff, _ := sv.NewClient()
+	m.setUser(staff, "janitor")
+	user, _ := sv.NewClient()
+	m.setUser(user, "user")
+	loggedOut, _ := sv.NewClient()
+	m.setUser(loggedOut, "janitor")
+	m.setUser(loggedOut, "")
+
+	m.SendToStaff("a", []byte("foo"))
+
+	select {
+	case msg := <-staff.sendExternal:
+		if s := string(msg.text); s != "foo" {
+			LogUnexpected(t, "foo", s)
+		}
+	default:
+		t.Error("staff not notified")
+	}
+	for _, cl := range [...]*Client{user, loggedOut} {
+		if len(cl.sendExternal) != 0 {
+			t.Error("non-staff notified")
+		}
+	}
 }
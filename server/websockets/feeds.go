@@ -1,10 +1,11 @@
-// Thread update feed management
+// Thread and board update feed management
 
 package websockets
 
 import (
 	"bytes"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/bakape/meguca/db"
@@ -12,6 +13,9 @@ import (
 	r "github.com/dancannon/gorethink"
 )
 
+// Seconds posts are kept in the update feed cache after their last update
+const cacheAge = 30
+
 // Post update kinds passed with feedUpdate
 const (
 	postInserted = iota
@@ -29,22 +33,44 @@ type feedContainer struct {
 	Add chan subRequest
 	// Remove client from subscribers
 	Remove chan subRequest
+	// Subscribe client to a board page feed
+	AddBoard chan boardSubRequest
+	// Remove client from board page feed subscribers
+	RemoveBoard chan boardSubRequest
 	// Remove all existing feeds and clients. Used only in tests.
 	clear chan struct{}
 	// Read from "posts" table change feed
 	read chan feedUpdate
+	// Read from "threads" table change feed, after the OP fields of the
+	// thread have been retrieved by resolveBoardUpdates
+	readBoards chan boardFeedUpdate
+	// Number of clients subscribed to board page feeds. Read outside the loop
+	// by resolveBoardUpdates, so only accessed atomically.
+	boardClients int32
 	// Current database change feed cursor
 	cursor *r.Cursor
+	// Current "threads" table change feed cursor
+	boardCursor *r.Cursor
 	// Map of thread IDs to their feeds
 	feeds map[int64]*updateFeed
+	// Map of boards to their board page feeds
+	boards map[string]*boardFeed
+	// Clients of all server instances, that thread viewer counts are read
+	// from
+	clients *ClientMap
 }
 
-// A feed with synchronization logic of a certain thread
-type updateFeed struct {
+// Buffer of messages to be sent to a feed's clients
+type messageBuffer struct {
 	// Indicates the buf contains multiple concatenated messages
 	multiple bool
 	// Buffer of unsent messages
 	buf bytes.Buffer
+}
+
+// A feed with synchronization logic of a certain thread
+type updateFeed struct {
+	messageBuffer
 	// Subscribed clients
 	clients []*Client
 	// Cache of posts updated within the last 30 s
@@ -53,6 +79,16 @@ type updateFeed struct {
 	// posts to JSON. Especially useful on server start, when many clients
 	// request synchronization at once. Set to null on any change of `cache`.
 	cacheJSON []byte
+	// Viewer counts last sent to the clients
+	viewers viewerCounts
+	// Encoded viewer count message last sent to the clients
+	viewersJSON []byte
+}
+
+// Number of unique IPs viewing a thread and clients with an open post in it
+type viewerCounts struct {
+	IPs    int `json:"ips"`
+	Typing int `json:"typing"`
 }
 
 // Change feed update message
@@ -62,6 +98,20 @@ type feedUpdate struct {
 	Log [][]byte
 }
 
+// A feed of thread creation, bumps, flag changes and deletion on a board page
+type boardFeed struct {
+	messageBuffer
+	// Subscribed clients
+	clients []*Client
+}
+
+// Board page change feed update message. Deleted threads only have their ID and
+// board set.
+type boardFeedUpdate struct {
+	Deleted bool              `gorethink:"deleted"`
+	Thread  types.BoardThread `gorethink:"thread"`
+}
+
 type timestampedPost struct {
 	types.Post
 	OP          int64 `json:"-"`
@@ -74,31 +124,54 @@ type subRequest struct {
 	client *Client
 }
 
-// Listen initializes and starts listening for post updates from RethinkDB
+// Request to add or remove a client to a board page subscription
+type boardSubRequest struct {
+	board  string
+	client *Client
+}
+
+// Listen initializes and starts listening for post updates and new reports
+// from RethinkDB
 func Listen() error {
+	db.EncodeArchiveMessage = encodeArchiveMessage
+	if err := initInstanceID(); err != nil {
+		return err
+	}
 	if err := feeds.streamUpdates(); err != nil {
 		return err
 	}
+	if err := feeds.streamBoardUpdates(); err != nil {
+		return err
+	}
 	go feeds.loop()
-	return nil
+	if !isTest {
+		go presenceLoop()
+	}
+	return listenToReports()
 }
 
 // Separate function to ease testing
 func newFeedContainer() feedContainer {
 	return feedContainer{
-		Add:    make(chan subRequest),
-		Remove: make(chan subRequest),
-		clear:  make(chan struct{}),
-		read:   make(chan feedUpdate),
+		Add:         make(chan subRequest),
+		Remove:      make(chan subRequest),
+		AddBoard:    make(chan boardSubRequest),
+		RemoveBoard: make(chan boardSubRequest),
+		clear:       make(chan struct{}),
+		read:        make(chan feedUpdate),
+		readBoards:  make(chan boardFeedUpdate),
 
 		// 100 len map to avoid some possible reallocation as the server starts
-		feeds: make(map[int64]*updateFeed, 100),
+		feeds:   make(map[int64]*updateFeed, 100),
+		boards:  make(map[string]*boardFeed),
+		clients: &Clients,
 	}
 }
 
 func (f *feedContainer) loop() {
 	cleanUp := time.Tick(time.Second * 10)
 	send := time.Tick(time.Millisecond * 200)
+	viewers := time.Tick(time.Second * 5)
 
 	for {
 		select {
@@ -106,12 +179,22 @@ func (f *feedContainer) loop() {
 			f.addClient(req.id, req.client)
 		case req := <-f.Remove:
 			f.removeClient(req.id, req.client)
+		case req := <-f.AddBoard:
+			f.addBoardClient(req.board, req.client)
+		case req := <-f.RemoveBoard:
+			f.removeBoardClient(req.board, req.client)
 		case update := <-f.read:
 			f.bufferUpdate(update)
+		case update := <-f.readBoards:
+			f.bufferBoardUpdate(update)
 		case <-f.clear:
 			f.feeds = make(map[int64]*updateFeed, 1)
+			f.boards = make(map[string]*boardFeed)
+			atomic.StoreInt32(&f.boardClients, 0)
 		case t := <-cleanUp:
 			f.cleanUp(t.Unix())
+		case <-viewers:
+			f.bufferViewers()
 		case <-send:
 			f.flushBuffers()
 		}
@@ -142,6 +225,9 @@ func (f *feedContainer) addClient(id int64, cl *Client) {
 		}
 	}
 	cl.Send(msg)
+	if feed.viewersJSON != nil {
+		cl.Send(feed.viewersJSON)
+	}
 }
 
 // Remove client from subscribers
@@ -157,6 +243,39 @@ func (f *feedContainer) removeClient(id int64, cl *Client) {
 	}
 }
 
+// Add client to a board page feed. Clients on the "/all/" meta-board receive
+// updates from all boards.
+func (f *feedContainer) addBoardClient(board string, cl *Client) {
+	feed, ok := f.boards[board]
+	if !ok {
+		feed = &boardFeed{}
+		f.boards[board] = feed
+	}
+	feed.clients = append(feed.clients, cl)
+	atomic.AddInt32(&f.boardClients, 1)
+}
+
+// Remove client from a board page feed and remove the feed, if it has no
+// clients left
+func (f *feedContainer) removeBoardClient(board string, cl *Client) {
+	feed, ok := f.boards[board]
+	if !ok {
+		return
+	}
+	for i, c := range feed.clients {
+		if c == cl {
+			copy(feed.clients[i:], feed.clients[i+1:])
+			feed.clients[len(feed.clients)-1] = nil
+			feed.clients = feed.clients[:len(feed.clients)-1]
+			atomic.AddInt32(&f.boardClients, -1)
+			break
+		}
+	}
+	if len(feed.clients) == 0 {
+		delete(f.boards, board)
+	}
+}
+
 // Remove all existing feeds and clients. Used only in tests.
 func (f *feedContainer) Clear() {
 	f.clear <- struct{}{}
@@ -174,8 +293,15 @@ func (f *feedContainer) cleanUp(time int64) {
 		}
 		return
 	}
+	if err := f.boardCursor.Err(); err != nil {
+		log.Printf("board update feed: %s\n", err)
+		if err := f.streamBoardUpdates(); err != nil {
+			panic(err)
+		}
+		return
+	}
 
-	time -= 30
+	time -= cacheAge
 
 	for thread, feed := range f.feeds {
 		for id, post := range feed.cache {
@@ -191,34 +317,51 @@ func (f *feedContainer) cleanUp(time int64) {
 	}
 }
 
-// Send any buffered messages to any listening clients
-func (f *feedContainer) flushBuffers() {
-	for _, feed := range f.feeds {
-		if feed.buf.Len() == 0 {
-			continue
-		}
+// Buffer the unique IPs and clients with open posts of each thread feed across
+// all server instances, if they changed since last sent. Sent together with
+// other buffered messages by flushBuffers.
+func (f *feedContainer) bufferViewers() {
+	viewers := f.clients.threadViewers()
+	for id, feed := range f.feeds {
 		if len(feed.clients) == 0 {
-			feed.multiple = false
-			feed.buf.Reset()
 			continue
 		}
 
-		buf := feed.buf.Bytes()
-		if feed.multiple {
-			feed.multiple = false
-			buf = prependMessageType(MessageConcat, buf)
-		} else {
-			// Need to copy, because the underlying array can be modified during
-			// sending to clients.
-			c := make([]byte, len(buf))
-			copy(c, buf)
-			buf = c
+		counts := viewers[id]
+		if counts == feed.viewers {
+			continue
 		}
-		feed.buf.Reset()
 
-		for _, client := range feed.clients {
-			client.Send(buf)
+		msg, err := EncodeMessage(MessageViewers, counts)
+		if err != nil {
+			log.Printf("could not encode: %#v\n", counts)
+			continue
 		}
+		feed.viewers = counts
+		feed.viewersJSON = msg
+		feed.writeToBuffer(msg)
+	}
+}
+
+// Send any buffered messages to any listening clients
+func (f *feedContainer) flushBuffers() {
+	for _, feed := range f.feeds {
+		sendToAll(feed.clients, feed.flush())
+	}
+	for _, feed := range f.boards {
+		sendToAll(feed.clients, feed.flush())
+	}
+}
+
+// Send a message to all clients in the slice, unless it is nil. The clients
+// share a single binary encoding of the message.
+func sendToAll(clients []*Client, msg []byte) {
+	if msg == nil {
+		return
+	}
+	shared := newOutgoingMessage(msg)
+	for _, c := range clients {
+		c.sendShared(shared)
 	}
 }
 
@@ -227,7 +370,7 @@ func (f *feedContainer) flushBuffers() {
 func (f *feedContainer) streamUpdates() error {
 	cursor, err := r.
 		Table("posts").
-		Between(r.Now().ToEpochTime().Sub(30), r.MaxVal, r.BetweenOpts{
+		Between(r.Now().ToEpochTime().Sub(cacheAge), r.MaxVal, r.BetweenOpts{
 			Index: "lastUpdated",
 		}).
 		Changes(r.ChangesOpts{
@@ -239,7 +382,12 @@ func (f *feedContainer) streamUpdates() error {
 			return ch.Field("type").Do(func(typ r.Term) r.Term {
 				return r.Branch(
 					typ.Eq("add").Or(typ.Eq("initial")),
-					ch.Field("new_val").Without("log", "ip", "password"),
+					ch.
+						Field("new_val").
+						Without(
+							"log", "logTimes", "ip", "password", "lease",
+							"voters",
+						),
 					typ.Eq("remove"),
 					nil,
 					ch.Field("new_val").Merge(map[string]interface{}{
@@ -263,6 +411,75 @@ func (f *feedContainer) streamUpdates() error {
 	return nil
 }
 
+// Subscribe to a stream of thread creation, bump, flag change and deletion
+// events for board page feeds. Change feeds only accept deterministic
+// transformations, so the public fields of the OP are retrieved separately by
+// resolveBoardUpdates.
+func (f *feedContainer) streamBoardUpdates() error {
+	cursor, err := r.
+		Table("threads").
+		Changes(r.ChangesOpts{
+			IncludeTypes: true,
+			Squash:       0.2,
+		}).
+		Map(func(ch r.Term) r.Term {
+			old := ch.Field("old_val")
+			new := ch.Field("new_val")
+			return r.Branch(
+				// Archived threads are removed from board pages
+				ch.Field("type").Eq("remove").Or(
+					new.Field("deleted").Default(false),
+					new.Field("archived").Default(false),
+					new.HasFields("archivedAt").Default(false),
+				),
+				map[string]interface{}{
+					"deleted": true,
+					"thread":  old.Pluck("id", "board"),
+				},
+				map[string]interface{}{
+					"thread": new,
+				},
+			)
+		}).
+		Run(db.RSession)
+	if err != nil {
+		return err
+	}
+
+	changes := make(chan boardFeedUpdate)
+	cursor.Listen(changes)
+	go f.resolveBoardUpdates(changes)
+	f.boardCursor = cursor
+
+	return nil
+}
+
+// Merge the public fields of the OP into each changed thread and pass the
+// update on to the feed loop. Runs in its own goroutine, so database round
+// trips do not block the loop. Updates are processed in order, so a thread can
+// not be reinserted after its deletion. Returns, when the change feed is
+// closed.
+func (f *feedContainer) resolveBoardUpdates(changes <-chan boardFeedUpdate) {
+	for update := range changes {
+		if !update.Deleted {
+			if atomic.LoadInt32(&f.boardClients) == 0 {
+				continue
+			}
+			thread, err := db.GetBoardThread(update.Thread.ID)
+			switch err {
+			case nil:
+				update.Thread = thread
+			case r.ErrEmptyResult: // Deleted in the meantime
+				continue
+			default:
+				log.Printf("board feed: %s\n", err)
+				continue
+			}
+		}
+		f.readBoards <- update
+	}
+}
+
 // Buffer the replication log updates received from the DB and cache the new
 // contents of the post.
 func (f *feedContainer) bufferUpdate(update feedUpdate) {
@@ -302,10 +519,68 @@ func (f *feedContainer) bufferUpdate(update feedUpdate) {
 	}
 }
 
-func (u *updateFeed) writeToBuffer(data []byte) {
-	if u.buf.Len() != 0 {
-		u.multiple = true
-		u.buf.WriteRune('\u0000')
+// Encode a thread creation, update or deletion and buffer it to the feeds of
+// the thread's board and the "/all/" meta-board, if they have any clients
+func (f *feedContainer) bufferBoardUpdate(update boardFeedUpdate) {
+	boards := [...]string{update.Thread.Board, "all"}
+	listened := false
+	for _, b := range boards {
+		if _, ok := f.boards[b]; ok {
+			listened = true
+			break
+		}
+	}
+	if !listened {
+		return
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if update.Deleted {
+		data, err = EncodeMessage(MessageBoardThreadDeleted, update.Thread.ID)
+	} else {
+		data, err = EncodeMessage(MessageBoardThread, update.Thread)
+	}
+	if err != nil {
+		log.Printf("could not encode: %#v\n", update.Thread)
+		return
+	}
+
+	for _, board := range boards {
+		if feed, ok := f.boards[board]; ok {
+			feed.writeToBuffer(data)
+		}
+	}
+}
+
+func (m *messageBuffer) writeToBuffer(data []byte) {
+	if m.buf.Len() != 0 {
+		m.multiple = true
+		m.buf.WriteRune('\u0000')
+	}
+	m.buf.Write(data)
+}
+
+// Return all buffered messages as a single message and reset the buffer.
+// Returns nil, if there are no buffered messages.
+func (m *messageBuffer) flush() []byte {
+	if m.buf.Len() == 0 {
+		return nil
+	}
+
+	buf := m.buf.Bytes()
+	if m.multiple {
+		m.multiple = false
+		buf = prependMessageType(TextEncoding, MessageConcat, buf)
+	} else {
+		// Need to copy, because the underlying array can be modified during
+		// sending to clients.
+		c := make([]byte, len(buf))
+		copy(c, buf)
+		buf = c
 	}
-	u.buf.Write(data)
+	m.buf.Reset()
+	return buf
 }
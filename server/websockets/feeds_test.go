@@ -71,9 +71,7 @@ func TestStreamUpdates(t *testing.T) {
 	})
 	assertMessage(t, wcl, encodeMessage(t, MessageInsertPost, post.Post))
 
-	q := db.FindPost(1).Update(map[string]interface{}{
-		"log": appendLog([]byte("bar")),
-	})
+	q := db.FindPost(1).Update(appendLog([]byte("bar")))
 	if err := db.Write(q); err != nil {
 		t.Fatal(err)
 	}
@@ -184,9 +182,11 @@ func TestFlushMultipleMessages(t *testing.T) {
 	feeds := newFeedContainer()
 	const msg = "a\u0000bc"
 	feeds.feeds[1] = &updateFeed{
-		clients:  []*Client{cl},
-		buf:      *bytes.NewBufferString(msg),
-		multiple: true,
+		clients: []*Client{cl},
+		messageBuffer: messageBuffer{
+			buf:      *bytes.NewBufferString(msg),
+			multiple: true,
+		},
 	}
 
 	feeds.flushBuffers()
@@ -210,6 +210,7 @@ func TestFeedCleanUp(t *testing.T) {
 	}
 	feeds := newFeedContainer()
 	feeds.cursor = new(r.Cursor)
+	feeds.boardCursor = new(r.Cursor)
 	feeds.feeds = map[int64]*updateFeed{
 		1: {}, // No clients or cache
 		2: { // No cache, has clients
@@ -242,3 +243,255 @@ func TestFeedCleanUp(t *testing.T) {
 	}
 	AssertDeepEquals(t, feeds.feeds, std)
 }
+
+func TestResolveBoardUpdates(t *testing.T) {
+	assertTableClear(t, "threads", "posts")
+	assertInsert(t, "threads", types.DatabaseThread{
+		ID:       1,
+		Board:    "a",
+		PostCtr:  2,
+		ImageCtr: 1,
+	})
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID:   1,
+				Time: 3,
+				Name: "foo",
+			},
+			OP:    1,
+			Board: "a",
+		},
+		LastUpdated: 4,
+	})
+
+	feeds := newFeedContainer()
+	feeds.addBoardClient("a", new(Client))
+	changes := make(chan boardFeedUpdate, 3)
+
+	// Change feed documents only contain the fields of the threads table
+	changes <- boardFeedUpdate{
+		Thread: types.BoardThread{
+			ID:    1,
+			Board: "a",
+		},
+	}
+	changes <- boardFeedUpdate{ // Nonexistent threads are skipped
+		Thread: types.BoardThread{
+			ID:    99,
+			Board: "a",
+		},
+	}
+	deleted := boardFeedUpdate{
+		Deleted: true,
+		Thread: types.BoardThread{
+			ID:    1,
+			Board: "a",
+		},
+	}
+	changes <- deleted
+	close(changes)
+	go feeds.resolveBoardUpdates(changes)
+
+	std := types.BoardThread{
+		ID:          1,
+		Board:       "a",
+		PostCtr:     2,
+		ImageCtr:    1,
+		Time:        3,
+		Name:        "foo",
+		LastUpdated: 4,
+	}
+	AssertDeepEquals(t, (<-feeds.readBoards).Thread, std)
+	AssertDeepEquals(t, <-feeds.readBoards, deleted)
+}
+
+func TestBufferBoardUpdate(t *testing.T) {
+	t.Parallel()
+
+	thread := types.BoardThread{
+		ID:       1,
+		Board:    "a",
+		PostCtr:  2,
+		ImageCtr: 1,
+		Time:     3,
+		Name:     "foo",
+	}
+
+	cases := [...]struct {
+		name   string
+		update boardFeedUpdate
+		buf    string
+	}{
+		{
+			name: "thread created or updated",
+			update: boardFeedUpdate{
+				Thread: thread,
+			},
+			buf: encodeMessage(t, MessageBoardThread, thread),
+		},
+		{
+			name: "thread deleted",
+			update: boardFeedUpdate{
+				Deleted: true,
+				Thread: types.BoardThread{
+					ID:    1,
+					Board: "a",
+				},
+			},
+			buf: encodeMessage(t, MessageBoardThreadDeleted, 1),
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			feeds := newFeedContainer()
+			cls := []*Client{new(Client)}
+			for _, b := range [...]string{"a", "c", "all"} {
+				feeds.addBoardClient(b, cls[0])
+			}
+			feeds.bufferBoardUpdate(c.update)
+
+			// Both the thread's board and "/all/" receive the update
+			for _, b := range [...]string{"a", "all"} {
+				if s := feeds.boards[b].buf.String(); s != c.buf {
+					LogUnexpected(t, c.buf, s)
+				}
+			}
+			if l := feeds.boards["c"].buf.Len(); l != 0 {
+				t.Errorf("update buffered to other board: %d", l)
+			}
+		})
+	}
+}
+
+func TestBufferViewers(t *testing.T) {
+	t.Parallel()
+
+	cls := [3]*Client{new(Client), new(Client), new(Client)}
+	cls[0].IP = "foo"
+	cls[1].IP = "foo"
+	cls[2].IP = "bar"
+	cls[1].setOpenPost(openPost{id: 2})
+
+	feeds := newFeedContainer()
+	feeds.clients = newClientMap()
+	for _, cl := range cls {
+		feeds.clients.add(cl, SyncID{
+			OP:    1,
+			Board: "a",
+		})
+	}
+
+	// Clients of other server instances
+	feeds.clients.setRemote([]db.PresenceClient{
+		{IP: "bar", Board: "a", OP: 1, Typing: true},
+		{IP: "baz", Board: "a", OP: 1},
+		{IP: "baz", Board: "a", OP: 2},
+	})
+
+	feeds.feeds[1] = &updateFeed{
+		clients: cls[:],
+	}
+	feeds.feeds[2] = &updateFeed{}
+	feed := feeds.feeds[1]
+
+	feeds.bufferViewers()
+	std := encodeMessage(t, MessageViewers, viewerCounts{
+		IPs:    3,
+		Typing: 2,
+	})
+	if s := string(feed.flush()); s != std {
+		LogUnexpected(t, std, s)
+	}
+	if feeds.feeds[2].buf.Len() != 0 {
+		t.Error("counts buffered for feed without clients")
+	}
+
+	// Unchanged counts are not resent
+	feeds.bufferViewers()
+	if feed.buf.Len() != 0 {
+		t.Error("unchanged counts buffered")
+	}
+
+	cls[1].setOpenPost(openPost{})
+	feeds.bufferViewers()
+	std = encodeMessage(t, MessageViewers, viewerCounts{
+		IPs:    3,
+		Typing: 1,
+	})
+	if s := string(feed.flush()); s != std {
+		LogUnexpected(t, std, s)
+	}
+}
+
+func TestRemoveBoardClient(t *testing.T) {
+	t.Parallel()
+
+	feeds := newFeedContainer()
+	cl1, cl2 := new(Client), new(Client)
+	feeds.addBoardClient("a", cl1)
+	feeds.addBoardClient("a", cl2)
+
+	feeds.removeBoardClient("a", cl1)
+	AssertDeepEquals(t, feeds.boards["a"].clients, []*Client{cl2})
+
+	// Feeds without clients are removed
+	feeds.removeBoardClient("a", cl2)
+	if _, ok := feeds.boards["a"]; ok {
+		t.Error("empty board feed not removed")
+	}
+}
+
+func TestStreamBoardUpdates(t *testing.T) {
+	assertTableClear(t, "posts", "threads")
+	feeds.Clear()
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, wcl := sv.NewClient()
+	sv.Add(1)
+	go readListenErrors(t, cl, sv)
+	feeds.AddBoard <- boardSubRequest{"all", cl}
+	defer feeds.Clear()
+
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID:   1,
+				Time: 3,
+			},
+			OP:    1,
+			Board: "a",
+		},
+		LastUpdated: 4,
+		Log:         [][]byte{},
+	})
+	assertInsert(t, "threads", types.DatabaseThread{
+		ID:        1,
+		Board:     "a",
+		PostCtr:   1,
+		ReplyTime: 3,
+	})
+	std := types.BoardThread{
+		ID:          1,
+		Board:       "a",
+		PostCtr:     1,
+		Time:        3,
+		ReplyTime:   3,
+		LastUpdated: 4,
+	}
+	assertMessage(t, wcl, encodeMessage(t, MessageBoardThread, std))
+
+	q := db.FindThread(1).Update(map[string]bool{
+		"deleted": true,
+	})
+	if err := db.Write(q); err != nil {
+		t.Fatal(err)
+	}
+	assertMessage(t, wcl, encodeMessage(t, MessageBoardThreadDeleted, 1))
+
+	cl.Close(nil)
+	sv.Wait()
+}
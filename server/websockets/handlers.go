@@ -12,6 +12,7 @@ import (
 	"strconv"
 
 	"github.com/bakape/meguca/config"
+	"github.com/bakape/meguca/db"
 	"github.com/bakape/meguca/types"
 )
 
@@ -33,6 +34,15 @@ const (
 	MessageInsertImage
 	MessageSpoiler
 	MessageDelete
+	MessageLock
+	MessageSticky
+	MessageArchive
+
+	// Vote for a poll option and increment its tally
+	MessageVote
+
+	// Set the options of a poll, as each line with an option is committed
+	MessagePoll
 )
 
 // >= 30 are miscellaneous and do not write to post models
@@ -64,6 +74,34 @@ const (
 	// one way ping, because the JS Websocket API does not provide access to
 	// pinging.
 	MessageNOOP
+
+	// Notifies the client it is banned from posting
+	MessageBanned
+
+	// Notifies logged in board staff of a new post report
+	MessageReport
+
+	// Notifies the client it has exceeded a rate limit and its last message
+	// was dropped
+	MessageRateLimited
+
+	// Thread creation or update on a board page update feed
+	MessageBoardThread
+
+	// Thread deletion on a board page update feed
+	MessageBoardThreadDeleted
+
+	// Instructs the client to refetch the thread, because the updates it has
+	// missed can not be replayed
+	MessageResync
+
+	// Number of unique IPs synchronised to the client's thread or board page
+	// across all server instances
+	MessageOnline
+
+	// Number of unique IPs viewing a thread and clients with an open post in
+	// it
+	MessageViewers
 )
 
 var (
@@ -91,6 +129,11 @@ var (
 		MessageSplice:         spliceText,
 		MessageInsertPost:     insertPost,
 		MessageInsertImage:    insertImage,
+		MessageDelete:         deletePost,
+		MessageLock:           lockThread,
+		MessageSticky:         stickyThread,
+		MessageArchive:        archiveThread,
+		MessageVote:           castVote,
 		MessageNOOP:           noop,
 	}
 )
@@ -107,25 +150,48 @@ func (e errCaptcha) Error() string {
 
 type handler func([]byte, *Client) error
 
-// Decode message JSON into the supplied type. Will augment, once we switch to
-// a binary message protocol.
+// Decode message JSON into the supplied type. Binary messages are converted to
+// JSON on receipt, so handlers only need to support a single encoding.
 func decodeMessage(data []byte, dest interface{}) error {
 	return json.Unmarshal(data, dest)
 }
 
-// EncodeMessage encodes a message for sending through websockets or writing to
-// the replication log.
+// EncodeMessage encodes a message in the text encoding for sending through
+// websockets or writing to the replication log
 func EncodeMessage(typ MessageType, msg interface{}) ([]byte, error) {
+	return EncodeMessageAs(TextEncoding, typ, msg)
+}
+
+// EncodeMessageAs encodes a message in the specified encoding
+func EncodeMessageAs(
+	enc Encoding,
+	typ MessageType,
+	msg interface{},
+) (
+	[]byte, error,
+) {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return nil, err
 	}
+	if enc == BinaryEncoding {
+		if data, err = jsonToBinary(data); err != nil {
+			return nil, err
+		}
+	}
 
-	return prependMessageType(typ, data), nil
+	return prependMessageType(enc, typ, data), nil
 }
 
 // Prepend the encoded websocket message type to an already encoded message
-func prependMessageType(typ MessageType, data []byte) []byte {
+func prependMessageType(enc Encoding, typ MessageType, data []byte) []byte {
+	if enc == BinaryEncoding {
+		encoded := make([]byte, len(data)+1)
+		encoded[0] = byte(typ)
+		copy(encoded[1:], data)
+		return encoded
+	}
+
 	encoded := make([]byte, len(data)+2)
 	typeString := strconv.FormatUint(uint64(typ), 10)
 
@@ -142,7 +208,8 @@ func prependMessageType(typ MessageType, data []byte) []byte {
 	return encoded
 }
 
-// Post a request to the SolveMedia API to authenticate a captcha
+// Authenticate a captcha with either the local or remote provider, as
+// configured
 func authenticateCaptcha(captcha types.Captcha, ip string) bool {
 	conf := config.Get()
 
@@ -154,9 +221,29 @@ func authenticateCaptcha(captcha types.Captcha, ip string) bool {
 	if captcha.Captcha == "" || captcha.CaptchaID == "" {
 		return false
 	}
+	if conf.LocalCaptcha {
+		return authenticateLocalCaptcha(captcha)
+	}
+	return authenticateSolveMedia(captcha, ip, conf.CaptchaPrivateKey)
+}
+
+// Verify the solution of a captcha generated by this server
+func authenticateLocalCaptcha(captcha types.Captcha) bool {
+	solved, err := db.SolveCaptcha(captcha.CaptchaID, captcha.Captcha)
+	if err != nil {
+		printCaptchaError(err)
+		return false
+	}
+	return solved
+}
 
+// Post a request to the SolveMedia API to authenticate a captcha
+func authenticateSolveMedia(
+	captcha types.Captcha,
+	ip, privateKey string,
+) bool {
 	data := url.Values{
-		"privatekey": {conf.CaptchaPrivateKey},
+		"privatekey": {privateKey},
 		"challenge":  {captcha.CaptchaID},
 		"response":   {captcha.Captcha},
 		"remoteip":   {ip},
@@ -3,8 +3,12 @@ package websockets
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/bakape/meguca/config"
+	"github.com/bakape/meguca/db"
 	. "github.com/bakape/meguca/test"
+	"github.com/bakape/meguca/types"
 )
 
 func marshalJSON(t testing.TB, msg interface{}) []byte {
@@ -43,3 +47,45 @@ func TestNOOPMessage(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestAuthenticateLocalCaptcha(t *testing.T) {
+	assertTableClear(t, "captchas")
+	isTest = false
+	defer func() {
+		isTest = true
+	}()
+	conf := config.Defaults
+	conf.Captcha = true
+	conf.LocalCaptcha = true
+	config.Set(conf)
+	defer config.Set(config.Defaults)
+
+	expires := time.Now().Add(time.Minute)
+	for _, id := range [...]string{"1", "2"} {
+		if err := db.InsertCaptcha(id, "123456", expires); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := [...]struct {
+		name    string
+		captcha types.Captcha
+		valid   bool
+	}{
+		{"no captcha", types.Captcha{}, false},
+		{"no ID", types.Captcha{Captcha: "123456"}, false},
+		{"wrong solution", types.Captcha{Captcha: "654321", CaptchaID: "1"}, false},
+		{"valid", types.Captcha{Captcha: "123456", CaptchaID: "2"}, true},
+		{"reused", types.Captcha{Captcha: "123456", CaptchaID: "2"}, false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			valid := authenticateCaptcha(c.captcha, "::1")
+			if valid != c.valid {
+				LogUnexpected(t, c.valid, valid)
+			}
+		})
+	}
+}
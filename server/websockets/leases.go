@@ -0,0 +1,66 @@
+// Exclusive ownership of open posts by a single connection
+
+package websockets
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/bakape/meguca/auth"
+	"github.com/bakape/meguca/db"
+)
+
+// Interval at which the lease on the client's open post is renewed, while the
+// client is idle
+const leaseHeartbeat = db.LeaseTimeout / 3
+
+var (
+	errLeaseLost = errors.New("open post lease lost")
+
+	// Random ID of this server instance. Prefixes connection IDs to keep them
+	// unique across all server instances sharing the database.
+	instanceID string
+
+	// Counter of connections to this server instance
+	connCtr uint64
+)
+
+// Generate the random ID of this server instance
+func initInstanceID() (err error) {
+	instanceID, err = auth.RandomID(8)
+	return
+}
+
+// Generate a new connection ID, unique across all server instances
+func newConnID() string {
+	ctr := atomic.AddUint64(&connCtr, 1)
+	return instanceID + "-" + strconv.FormatUint(ctr, 10)
+}
+
+// Renew the lease on the client's open post, if any. Returns errLeaseLost, if
+// the post has been reclaimed by another connection in the meantime.
+func (c *Client) renewLease() error {
+	if c.openPost.id == 0 {
+		return nil
+	}
+	ok, err := db.AcquireLease(c.openPost.id, c.connID)
+	switch {
+	case err != nil:
+		return err
+	case !ok:
+		c.setOpenPost(openPost{})
+		return errLeaseLost
+	default:
+		return nil
+	}
+}
+
+// Release the lease on the client's open post, if any, so the post can be
+// reclaimed right away after a disconnect
+func (c *Client) releaseLease() error {
+	if c.openPost.id == 0 {
+		return nil
+	}
+	return db.ReleaseLease(c.openPost.id, c.connID)
+}
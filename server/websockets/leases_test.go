@@ -0,0 +1,93 @@
+package websockets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bakape/meguca/db"
+	. "github.com/bakape/meguca/test"
+	"github.com/bakape/meguca/types"
+)
+
+func TestConnIDUniqueness(t *testing.T) {
+	t.Parallel()
+
+	if a, b := newConnID(), newConnID(); a == b {
+		t.Fatalf("duplicate connection IDs: %s", a)
+	}
+}
+
+func insertLeasedPost(t *testing.T, owner string) {
+	assertTableClear(t, "posts")
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				Editing: true,
+				ID:      1,
+				Body:    "abc",
+			},
+			OP:    1,
+			Board: "a",
+		},
+		Log: [][]byte{},
+		Lease: &types.Lease{
+			Owner:   owner,
+			Expires: time.Now().Add(time.Minute),
+		},
+	})
+}
+
+func TestUpdateWithLostLease(t *testing.T) {
+	insertLeasedPost(t, "other")
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	cl.openPost = openPost{
+		id:         1,
+		op:         1,
+		board:      "a",
+		bodyLength: 3,
+		time:       time.Now().Unix(),
+	}
+
+	if err := appendRune(marshalJSON(t, 'd'), cl); err != errLeaseLost {
+		UnexpectedError(t, err)
+	}
+	if cl.openPost.id != 0 {
+		t.Error("open post not cleared")
+	}
+	assertBody(t, 1, "abc")
+}
+
+func TestLeaseRenewalAndRelease(t *testing.T) {
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	insertLeasedPost(t, cl.connID)
+	cl.openPost = openPost{
+		id: 1,
+	}
+
+	if err := cl.renewLease(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cl.releaseLease(); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := db.AcquireLease(1, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("lease not released")
+	}
+
+	if err := cl.renewLease(); err != errLeaseLost {
+		UnexpectedError(t, err)
+	}
+	if cl.openPost.id != 0 {
+		t.Error("open post not cleared")
+	}
+}
@@ -0,0 +1,322 @@
+// Post deletion and other moderation message handlers
+
+package websockets
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/bakape/meguca/auth"
+	"github.com/bakape/meguca/config"
+	"github.com/bakape/meguca/db"
+	"github.com/bakape/meguca/parser"
+	"github.com/bakape/meguca/types"
+	r "github.com/dancannon/gorethink"
+)
+
+var errInvalidPost = errors.New("invalid post")
+
+// Request to delete a post. The password is not required, if the client is
+// logged in as staff of the post's parent board.
+type deletionRequest struct {
+	ID       int64
+	Password string
+}
+
+// Request to set or unset a moderation flag on a thread. Also used as the
+// message broadcast to clients synced to the thread.
+type threadFlagRequest struct {
+	ID  int64 `json:"id"`
+	Val bool  `json:"val"`
+}
+
+// Sent to banned clients attempting to post
+type banMessage struct {
+	Board   string `json:"board"`
+	Reason  string `json:"reason"`
+	Expires int64  `json:"expires"`
+}
+
+// Delete a post either created by the client or on a board the client is staff
+// of
+func deletePost(data []byte, c *Client) error {
+	var req deletionRequest
+	if err := decodeMessage(data, &req); err != nil {
+		return err
+	}
+
+	var post struct {
+		Board    string
+		Password []byte
+	}
+	q := db.FindPost(req.ID).Pluck("board", "password").Default(nil)
+	err := db.One(q, &post)
+	switch err {
+	case nil:
+	case r.ErrEmptyResult:
+		return errInvalidPost
+	default:
+		return err
+	}
+
+	// Only deletions performed through staff privileges are logged
+	if !c.canPerform(post.Board, auth.DeletePost) {
+		if auth.BcryptCompare(req.Password, post.Password) != nil {
+			return errAccessDenied
+		}
+		return DeletePost(req.ID)
+	}
+
+	if err := DeletePost(req.ID); err != nil {
+		return err
+	}
+	return db.LogModeration(types.ModLogEntry{
+		Type:   types.DeletePost,
+		Target: req.ID,
+		Board:  post.Board,
+		By:     c.UserID,
+	})
+}
+
+// Returns, if the client is logged in as staff of the board with the
+// specified permission
+func (c *Client) canPerform(board string, perm auth.Permission) bool {
+	return c.isLoggedIn() && auth.CanPerform(c.UserID, board, perm)
+}
+
+// Describes a boolean thread moderation flag
+type threadFlag struct {
+	key    string
+	perm   auth.Permission
+	typ    MessageType
+	action types.ModerationAction
+}
+
+var (
+	lockFlag = threadFlag{
+		"locked", auth.LockThread, MessageLock, types.LockThread,
+	}
+	stickyFlag = threadFlag{
+		"sticky", auth.StickyThread, MessageSticky, types.StickyThread,
+	}
+	archiveFlag = threadFlag{
+		"archived", auth.LockThread, MessageArchive, types.ArchiveThread,
+	}
+)
+
+// Lock or unlock a thread, preventing any new replies
+func lockThread(data []byte, c *Client) error {
+	return setThreadFlag(data, c, lockFlag)
+}
+
+// Set or unset a thread as sticky. Sticky threads are always displayed first on
+// the board page.
+func stickyThread(data []byte, c *Client) error {
+	return setThreadFlag(data, c, stickyFlag)
+}
+
+// Archive or unarchive a thread. Threads archived by staff are read-only and
+// exempt from expiry.
+func archiveThread(data []byte, c *Client) error {
+	return setThreadFlag(data, c, archiveFlag)
+}
+
+// Encode the message appended to the replication log of a thread's opening
+// post, when the thread expires and is archived
+func encodeArchiveMessage(id int64) ([]byte, error) {
+	return EncodeMessage(MessageArchive, threadFlagRequest{
+		ID:  id,
+		Val: true,
+	})
+}
+
+// Set a boolean thread flag, if the client has the required permission, and
+// broadcast the change to all clients synced to the thread through the
+// replication log of the opening post
+func setThreadFlag(data []byte, c *Client, flag threadFlag) error {
+	var req threadFlagRequest
+	if err := decodeMessage(data, &req); err != nil {
+		return err
+	}
+
+	var thread struct {
+		Deleted bool
+		Board   string
+	}
+	q := db.FindThread(req.ID).Pluck("board", "deleted").Default(nil)
+	err := db.One(q, &thread)
+	switch {
+	case err == r.ErrEmptyResult || thread.Deleted:
+		return errInvalidThread
+	case err != nil:
+		return err
+	}
+	if !c.canPerform(thread.Board, flag.perm) {
+		return errAccessDenied
+	}
+
+	msg, err := EncodeMessage(flag.typ, req)
+	if err != nil {
+		return err
+	}
+	update := map[string]interface{}{
+		flag.key: req.Val,
+	}
+	if flag.key == archiveFlag.key {
+		// Threads archived or unarchived by staff are exempt from the archive
+		// expiry
+		update["archivedAt"] = r.Literal()
+	}
+	q = db.FindThread(req.ID).Update(update)
+	if err := db.Write(q); err != nil {
+		return err
+	}
+	q = db.FindPost(req.ID).Update(appendLog(msg))
+	if err := db.Write(q); err != nil {
+		return err
+	}
+
+	return db.LogModeration(types.ModLogEntry{
+		Type:   flag.action,
+		Target: req.ID,
+		Board:  thread.Board,
+		By:     c.UserID,
+		Data:   strconv.FormatBool(req.Val),
+	})
+}
+
+// Checks, if the client is banned from posting on the board. If it is, the
+// client is notified of the ban's reason and expiry.
+func (c *Client) isBanned(board string) (bool, error) {
+	ban, banned, err := db.IsBanned(board, c.IP)
+	if err != nil || !banned {
+		return false, err
+	}
+	return true, c.sendMessage(MessageBanned, banMessage{
+		Board:   ban.Board,
+		Reason:  ban.Reason,
+		Expires: ban.Expires.Unix(),
+	})
+}
+
+// Handle post content matching a filter, that rejects the post. If the filter
+// bans the author, the client's IP is banned from the board and the client is
+// notified. Errors other than parser.ErrFiltered are returned unchanged.
+func (c *Client) handleFiltered(board string, err error) error {
+	filtered, ok := err.(parser.ErrFiltered)
+	if !ok || filtered.Action != config.FilterBan {
+		return err
+	}
+
+	duration := time.Duration(filtered.BanDuration) * time.Minute
+	ban := auth.Ban{
+		IP:      c.IP,
+		Board:   board,
+		Reason:  "automatic ban: " + err.Error(),
+		By:      "filter",
+		Expires: time.Now().Add(duration),
+	}
+	if err := db.InsertBan(ban); err != nil {
+		return err
+	}
+	msgErr := c.sendMessage(MessageBanned, banMessage{
+		Board:   ban.Board,
+		Reason:  ban.Reason,
+		Expires: ban.Expires.Unix(),
+	})
+	if msgErr != nil {
+		return msgErr
+	}
+	return err
+}
+
+// Delete the client's open post, after a committed line matched a filter, that
+// rejects the post. Errors other than parser.ErrFiltered are returned
+// unchanged.
+func (c *Client) rejectOpenPost(err error) error {
+	if _, ok := err.(parser.ErrFiltered); !ok {
+		return err
+	}
+	id, board := c.openPost.id, c.openPost.board
+	c.setOpenPost(openPost{})
+	if err := DeletePost(id); err != nil {
+		return err
+	}
+	return c.handleFiltered(board, err)
+}
+
+// DeletePost marks a post as deleted, clears its contents and writes the
+// deletion to the replication log. The parent thread's counters are
+// decremented and the post's image, if any, is deallocated. Deleting the
+// opening post of a thread also deletes the thread itself. Deleting an already
+// deleted post is a NOOP.
+func DeletePost(id int64) error {
+	msg, err := EncodeMessage(MessageDelete, id)
+	if err != nil {
+		return err
+	}
+
+	// Only write, if not yet deleted, so concurrent deletions do not decrement
+	// counters or deallocate images twice
+	q := db.
+		FindPost(id).
+		Update(
+			func(p r.Term) r.Term {
+				update := db.AppendLog(p, msg, time.Now().Unix())
+				update["deleted"] = true
+				update["editing"] = false
+				update["body"] = ""
+				update["image"] = r.Literal()
+				update["links"] = r.Literal()
+				update["boardLinks"] = r.Literal()
+				update["commands"] = r.Literal()
+				update["lease"] = r.Literal()
+				return r.Branch(
+					p.Field("deleted").Default(false),
+					map[string]interface{}{},
+					update,
+				)
+			},
+			r.UpdateOpts{ReturnChanges: true},
+		).
+		Field("changes").
+		AtIndex(0).
+		Field("old_val").
+		Pluck("op", "image").
+		Default(nil)
+
+	var res struct {
+		OP    int64
+		Image *types.Image
+	}
+	err = db.One(q, &res)
+	switch err {
+	case nil:
+	case r.ErrEmptyResult: // No such post or already deleted
+		return nil
+	default:
+		return err
+	}
+
+	// The opening post is not counted in postCtr. Clients synced to the thread
+	// are notified of its deletion through the replication log of the OP.
+	updates := make(map[string]interface{}, 2)
+	if res.OP == id {
+		updates["deleted"] = true
+	} else {
+		updates["postCtr"] = r.Row.Field("postCtr").Sub(1)
+	}
+	if res.Image != nil {
+		updates["imageCtr"] = r.Row.Field("imageCtr").Sub(1)
+	}
+	q = db.FindThread(res.OP).Update(updates)
+	if err := db.Write(q); err != nil {
+		return err
+	}
+
+	if res.Image != nil {
+		return db.DeallocateImage(res.Image.SHA1)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package websockets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bakape/meguca/auth"
+	"github.com/bakape/meguca/config"
+	"github.com/bakape/meguca/db"
+	. "github.com/bakape/meguca/test"
+	"github.com/bakape/meguca/types"
+	r "github.com/dancannon/gorethink"
+)
+
+func TestDeletePostValidations(t *testing.T) {
+	assertTableClear(t, "posts")
+	setBoardConfigs(t, false)
+
+	hash, err := auth.BcryptHash("123", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID: 2,
+			},
+			OP:    1,
+			Board: "a",
+		},
+		Password: hash,
+	})
+
+	cases := [...]struct {
+		name     string
+		id       int64
+		password string
+		err      error
+	}{
+		{"no post", 99, "123", errInvalidPost},
+		{"wrong password", 2, "aaa", errAccessDenied},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := deletionRequest{
+				ID:       c.id,
+				Password: c.password,
+			}
+			err := deletePost(marshalJSON(t, req), new(Client))
+			if err != c.err {
+				UnexpectedError(t, err)
+			}
+		})
+	}
+}
+
+func TestDeletePost(t *testing.T) {
+	assertTableClear(t, "posts", "threads", "images")
+	setBoardConfigs(t, false)
+	assertInsert(t, "images", types.ProtoImage{
+		ImageCommon: stdJPEG,
+		Posts:       2,
+	})
+	assertInsert(t, "threads", types.DatabaseThread{
+		ID:       1,
+		Board:    "a",
+		PostCtr:  1,
+		ImageCtr: 1,
+	})
+
+	hash, err := auth.BcryptHash("123", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID:   2,
+				Body: "foo",
+				Image: &types.Image{
+					ImageCommon: stdJPEG,
+					Name:        "foo",
+				},
+			},
+			OP:    1,
+			Board: "a",
+		},
+		Password: hash,
+		Log:      dummyLog,
+		Lease:    db.NewLease("foo"),
+	})
+
+	req := deletionRequest{
+		ID:       2,
+		Password: "123",
+	}
+	if err := deletePost(marshalJSON(t, req), new(Client)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Repeated deletion must not decrement counters again
+	if err := DeletePost(2); err != nil {
+		t.Fatal(err)
+	}
+
+	assertRepLog(t, 2, append(strDummyLog, "122"))
+	assertBody(t, 2, "")
+	assertImageCounter(t, 1, 0)
+
+	var post types.DatabasePost
+	if err := db.One(db.FindPost(2), &post); err != nil {
+		t.Fatal(err)
+	}
+	if !post.Deleted {
+		t.Error("post not marked deleted")
+	}
+	if post.Image != nil {
+		t.Error("image not removed from post")
+	}
+	if post.Lease != nil {
+		t.Error("lease not cleared")
+	}
+
+	var postCtr int
+	q := db.FindThread(1).Field("postCtr")
+	if err := db.One(q, &postCtr); err != nil {
+		t.Fatal(err)
+	}
+	if postCtr != 0 {
+		LogUnexpected(t, 0, postCtr)
+	}
+
+	var refs int
+	q = db.GetImage(stdJPEG.SHA1).Field("posts")
+	if err := db.One(q, &refs); err != nil {
+		t.Fatal(err)
+	}
+	if refs != 1 {
+		LogUnexpected(t, 1, refs)
+	}
+}
+
+func TestDeleteThreadAsStaff(t *testing.T) {
+	assertTableClear(t, "posts", "threads", "images", "modLog")
+	config.ClearBoards()
+	_, err := config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		Staff: map[string][]string{
+			"owners": {"user1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertInsert(t, "images", types.ProtoImage{
+		ImageCommon: stdJPEG,
+		Posts:       1,
+	})
+	assertInsert(t, "threads", types.DatabaseThread{
+		ID:       1,
+		Board:    "a",
+		ImageCtr: 1,
+	})
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID: 1,
+				Image: &types.Image{
+					ImageCommon: stdJPEG,
+					Name:        "foo",
+				},
+			},
+			OP:    1,
+			Board: "a",
+		},
+		Log: [][]byte{},
+	})
+
+	cl := new(Client)
+	cl.UserID = "user1"
+	cl.sessionToken = "foo"
+	req := deletionRequest{
+		ID: 1,
+	}
+	if err := deletePost(marshalJSON(t, req), cl); err != nil {
+		t.Fatal(err)
+	}
+
+	assertRepLog(t, 1, []string{"121"})
+	valid, err := db.ValidateOP(1, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid {
+		t.Error("deleted thread still valid")
+	}
+	assertImageCounter(t, 1, 0)
+
+	var entries []types.ModLogEntry
+	if err := db.All(r.Table("modLog"), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("unexpected moderation log: %#v", entries)
+	}
+	e := entries[0]
+	if e.Type != types.DeletePost || e.Target != 1 || e.By != "user1" {
+		t.Errorf("unexpected moderation log entry: %#v", e)
+	}
+}
+
+func TestBannedPostCreation(t *testing.T) {
+	assertTableClear(t, "bans")
+	setBoardConfigs(t, false)
+
+	expires := time.Now().Add(time.Hour)
+	err := db.InsertBan(auth.Ban{
+		IP:      "192.0.2.0/24", // Default httptest request IP range
+		Board:   "a",
+		Reason:  "foo",
+		Expires: expires,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, wcl := sv.NewClient()
+
+	req := threadCreationRequest{
+		Board: "a",
+	}
+	if err := insertThread(marshalJSON(t, req), cl); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := EncodeMessage(MessageBanned, banMessage{
+		Board:   "a",
+		Reason:  "foo",
+		Expires: expires.Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMessage(t, wcl, string(msg))
+}
+
+func TestSetThreadFlags(t *testing.T) {
+	assertTableClear(t, "posts", "threads")
+	config.ClearBoards()
+	_, err := config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		Staff: map[string][]string{
+			"moderators": {"mod"},
+			"janitors":   {"janitor"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertInsert(t, "images", types.ProtoImage{
+		ImageCommon: stdJPEG,
+		Posts:       1,
+	})
+	assertInsert(t, "threads", types.DatabaseThread{
+		ID:       1,
+		Board:    "a",
+		ImageCtr: 1,
+	})
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID: 1,
+				Image: &types.Image{
+					ImageCommon: stdJPEG,
+					Name:        "foo",
+				},
+			},
+			OP:    1,
+			Board: "a",
+		},
+		Log: [][]byte{},
+	})
+
+	newStaff := func(id string) *Client {
+		cl := new(Client)
+		cl.UserID = id
+		cl.sessionToken = "foo"
+		return cl
+	}
+
+	cases := [...]struct {
+		name string
+		id   int64
+		cl   *Client
+		fn   handler
+		err  error
+	}{
+		{"not logged in", 1, new(Client), lockThread, errAccessDenied},
+		{"no permission", 1, newStaff("janitor"), stickyThread, errAccessDenied},
+		{"no thread", 99, newStaff("mod"), lockThread, errInvalidThread},
+		{"lock", 1, newStaff("mod"), lockThread, nil},
+		{"sticky", 1, newStaff("mod"), stickyThread, nil},
+		{"archive", 1, newStaff("mod"), archiveThread, nil},
+	}
+
+	for _, c := range cases {
+		req := threadFlagRequest{
+			ID:  c.id,
+			Val: true,
+		}
+		if err := c.fn(marshalJSON(t, req), c.cl); err != c.err {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		}
+	}
+
+	var flags struct {
+		Locked, Sticky, Archived bool
+	}
+	if err := db.One(db.FindThread(1), &flags); err != nil {
+		t.Fatal(err)
+	}
+	if !flags.Locked || !flags.Sticky || !flags.Archived {
+		t.Errorf("thread flags not set: %#v", flags)
+	}
+	assertRepLog(t, 1, []string{
+		`13{"id":1,"val":true}`,
+		`14{"id":1,"val":true}`,
+		`15{"id":1,"val":true}`,
+	})
+}
+
+func TestEncodeArchiveMessage(t *testing.T) {
+	t.Parallel()
+
+	msg, err := encodeArchiveMessage(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, string(msg), `15{"id":1,"val":true}`)
+}
@@ -0,0 +1,194 @@
+// #poll command options and voting
+
+package websockets
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bakape/meguca/db"
+	"github.com/bakape/meguca/types"
+	r "github.com/dancannon/gorethink"
+)
+
+const (
+	maxPollOptions      = 20  // Maximum number of options in a poll
+	maxPollOptionLength = 100 // Maximum length of a poll option in runes
+)
+
+var errInvalidVote = errors.New("invalid vote")
+
+// Request to vote for a poll option. Also sent to listening clients to
+// increment the option's tally.
+type voteRequest struct {
+	ID     int64 `json:"id"`
+	Option int   `json:"option"`
+}
+
+// Message sent to listening clients, when an option is appended to a poll
+type pollMessage struct {
+	ID int64 `json:"id"`
+	types.PollData
+}
+
+// Parse the options of a poll from the text body of a post. All non-empty
+// lines after the first #poll command line are options.
+func parsePollOptions(body string) []string {
+	lines := strings.Split(body, "\n")
+	for i, l := range lines {
+		if l != "#poll" {
+			continue
+		}
+		options := make([]string, 0, len(lines)-i-1)
+		for _, o := range lines[i+1:] {
+			o = parsePollOption(o)
+			if o == "" {
+				continue
+			}
+			if len(options) == maxPollOptions {
+				break
+			}
+			options = append(options, o)
+		}
+		return options
+	}
+	return []string{}
+}
+
+// Parse a line of a post as a poll option. Returns an empty string, if the
+// line is not a valid option.
+func parsePollOption(line string) string {
+	line = strings.TrimSpace(line)
+	if runes := []rune(line); len(runes) > maxPollOptionLength {
+		line = string(runes[:maxPollOptionLength])
+	}
+	return line
+}
+
+// Append a committed line of the open post to the options of its poll, if the
+// line is a valid option. Options are written as soon as their line is
+// committed, so posts closed without a closePost request still have them.
+func appendPollOption(c *Client, line string) error {
+	o := parsePollOption(line)
+	if o == "" || len(c.openPost.pollOptions) == maxPollOptions {
+		return nil
+	}
+	c.openPost.pollOptions = append(c.openPost.pollOptions, o)
+	return writePoll(c)
+}
+
+// Write the current options of the open post's poll to the database and reset
+// its tallies
+func writePoll(c *Client) error {
+	poll := types.PollData{
+		Options: c.openPost.pollOptions,
+		Votes:   make([]uint, len(c.openPost.pollOptions)),
+	}
+	msg, err := EncodeMessage(MessagePoll, pollMessage{
+		ID:       c.openPost.id,
+		PollData: poll,
+	})
+	if err != nil {
+		return err
+	}
+
+	q := func(p r.Term) r.Term {
+		return p.
+			Field("commands").
+			Default([]types.Command{}).
+			Map(func(com r.Term) r.Term {
+				return r.Branch(
+					com.Field("type").Eq(types.Poll),
+					com.Merge(map[string]interface{}{
+						"val": r.Literal(poll),
+					}),
+					com,
+				)
+			})
+	}
+	return c.updatePost("commands", q, msg)
+}
+
+// Cast a vote for a poll option. Each IP and each logged in account can only
+// vote once per poll. Votes are only accepted after the poll's post has been
+// closed.
+func castVote(data []byte, c *Client) error {
+	var req voteRequest
+	if err := decodeMessage(data, &req); err != nil {
+		return err
+	}
+	if req.Option < 0 || req.Option >= maxPollOptions {
+		return errInvalidVote
+	}
+	msg, err := EncodeMessage(MessageVote, req)
+	if err != nil {
+		return err
+	}
+
+	voters := []string{"ip:" + c.IP}
+	if c.UserID != "" {
+		voters = append(voters, "user:"+c.UserID)
+	}
+	now := time.Now().Unix()
+
+	q := db.FindPost(req.ID).Update(func(p r.Term) r.Term {
+		i := p.
+			Field("commands").
+			Default([]interface{}{}).
+			OffsetsOf(func(com r.Term) r.Term {
+				return com.Field("type").Eq(types.Poll)
+			}).
+			Nth(0).
+			Default(-1)
+		return i.Do(func(i r.Term) r.Term {
+			valid := i.Ne(-1).
+				And(p.Field("editing").Not()).
+				And(p.
+					Field("commands").
+					Nth(i).
+					Field("val").
+					Field("votes").
+					Count().
+					Gt(req.Option),
+				).
+				And(p.
+					Field("voters").
+					Default([]string{}).
+					SetIntersection(voters).
+					IsEmpty(),
+				)
+
+			update := db.AppendLog(p, msg, now)
+			update["voters"] = p.
+				Field("voters").
+				Default([]string{}).
+				SetUnion(voters)
+			update["commands"] = p.
+				Field("commands").
+				ChangeAt(i, p.
+					Field("commands").
+					Nth(i).
+					Merge(map[string]interface{}{
+						"val": map[string]interface{}{
+							"votes": p.
+								Field("commands").
+								Nth(i).
+								Field("val").
+								Field("votes").
+								ChangeAt(req.Option, p.
+									Field("commands").
+									Nth(i).
+									Field("val").
+									Field("votes").
+									Nth(req.Option).
+									Add(1),
+								),
+						},
+					}),
+				)
+			return r.Branch(valid, update, map[string]interface{}{})
+		})
+	})
+	return db.Write(q)
+}
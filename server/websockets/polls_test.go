@@ -0,0 +1,276 @@
+package websockets
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bakape/meguca/config"
+	"github.com/bakape/meguca/db"
+	. "github.com/bakape/meguca/test"
+	"github.com/bakape/meguca/types"
+)
+
+func TestParsePollOptions(t *testing.T) {
+	t.Parallel()
+
+	var tooLong string
+	for i := 0; i < maxPollOptionLength+1; i++ {
+		tooLong += "a"
+	}
+	var tooMany string
+	for i := 0; i < maxPollOptions+1; i++ {
+		tooMany += "\nb"
+	}
+
+	cases := [...]struct {
+		name, in string
+		out      []string
+	}{
+		{"no poll", "abc\ndef", []string{}},
+		{"no options", "abc\n#poll", []string{}},
+		{"options", "abc\n#poll\n yes \n\nno", []string{"yes", "no"}},
+		{"option too long", "#poll\n" + tooLong, []string{tooLong[1:]}},
+		{"too many options", "#poll" + tooMany, []string{
+			"b", "b", "b", "b", "b", "b", "b", "b", "b", "b",
+			"b", "b", "b", "b", "b", "b", "b", "b", "b", "b",
+		}},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			AssertDeepEquals(t, parsePollOptions(c.in), c.out)
+		})
+	}
+}
+
+func TestAppendPollOption(t *testing.T) {
+	assertTableClear(t, "posts")
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				Editing: true,
+				ID:      2,
+				Body:    "#poll\nyes",
+				Commands: []types.Command{
+					{
+						Type: types.Poll,
+						Val: types.PollData{
+							Options: []string{"yes"},
+							Votes:   []uint{0},
+						},
+					},
+				},
+			},
+			OP:    1,
+			Board: "a",
+		},
+		Log: dummyLog,
+	})
+	setBoardConfigs(t, false)
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	cl.openPost = openPost{
+		id:          2,
+		op:          1,
+		bodyLength:  11,
+		board:       "a",
+		time:        time.Now().Unix(),
+		hasPoll:     true,
+		pollOptions: []string{"yes"},
+		Buffer:      *bytes.NewBufferString(" no "),
+	}
+
+	if err := parseLine(cl, true); err != nil {
+		t.Fatal(err)
+	}
+
+	assertRepLog(t, 2, append(
+		strDummyLog,
+		`17{"id":2,"options":["yes","no"],"votes":[0,0]}`,
+		"03[2,10]",
+	))
+	assertPoll(t, 2, types.PollData{
+		Options: []string{"yes", "no"},
+		Votes:   []uint{0, 0},
+	})
+}
+
+func TestEmptyLineNotPollOption(t *testing.T) {
+	assertTableClear(t, "posts")
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				Editing: true,
+				ID:      2,
+				Body:    "#poll\n",
+			},
+		},
+		Log: dummyLog,
+	})
+	setBoardConfigs(t, false)
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	cl.openPost = openPost{
+		id:         2,
+		op:         1,
+		bodyLength: 7,
+		board:      "a",
+		time:       time.Now().Unix(),
+		hasPoll:    true,
+		Buffer:     *bytes.NewBufferString("  "),
+	}
+
+	if err := parseLine(cl, true); err != nil {
+		t.Fatal(err)
+	}
+	assertRepLog(t, 2, append(strDummyLog, "03[2,10]"))
+}
+
+func assertPoll(t *testing.T, id int64, std types.PollData) {
+	var res types.PollData
+	q := db.FindPost(id).Field("commands").Nth(0).Field("val")
+	if err := db.One(q, &res); err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, res, std)
+}
+
+func TestSecondPollDropped(t *testing.T) {
+	assertTableClear(t, "posts")
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				Editing: true,
+				ID:      2,
+				Body:    "#poll",
+			},
+		},
+		Log: dummyLog,
+	})
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		BoardPublic: config.BoardPublic{
+			PostParseConfigs: config.PostParseConfigs{
+				HashCommands: true,
+			},
+		},
+	})
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	cl.openPost = openPost{
+		id:         2,
+		op:         1,
+		bodyLength: 5,
+		board:      "a",
+		time:       time.Now().Unix(),
+		hasPoll:    true,
+		Buffer:     *bytes.NewBufferString("#poll"),
+	}
+
+	if err := parseLine(cl, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Treated as an option of the first poll instead
+	assertRepLog(t, 2, append(
+		strDummyLog,
+		`17{"id":2,"options":["#poll"],"votes":[0]}`,
+		"03[2,10]",
+	))
+}
+
+func TestCastVote(t *testing.T) {
+	assertTableClear(t, "posts")
+	post := types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID: 2,
+				Commands: []types.Command{
+					{
+						Type: types.Flip,
+						Val:  true,
+					},
+					{
+						Type: types.Poll,
+						Val: types.PollData{
+							Options: []string{"yes", "no"},
+							Votes:   []uint{0, 0},
+						},
+					},
+				},
+			},
+		},
+		Log: dummyLog,
+	}
+	open := post
+	open.ID = 3
+	open.Editing = true
+	assertInsert(t, "posts", []types.DatabasePost{post, open})
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	cl.IP = "::1"
+
+	vote := func(id int64, option int) {
+		req := []byte(`{"id":` + strconv.FormatInt(id, 10) +
+			`,"option":` + strconv.Itoa(option) + "}")
+		if err := castVote(req, cl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertVotes := func(id int64, votes []uint) {
+		var res []uint
+		q := db.FindPost(id).Field("commands").Nth(1).Field("val").
+			Field("votes")
+		if err := db.One(q, &res); err != nil {
+			t.Fatal(err)
+		}
+		AssertDeepEquals(t, res, votes)
+	}
+
+	// Valid vote
+	vote(2, 1)
+	assertVotes(2, []uint{0, 1})
+	assertRepLog(t, 2, append(strDummyLog, `16{"id":2,"option":1}`))
+
+	// Same IP votes again
+	vote(2, 0)
+	assertVotes(2, []uint{0, 1})
+
+	// Different IP logged into an account
+	cl.IP = "::2"
+	cl.UserID = "foo"
+	vote(2, 0)
+	assertVotes(2, []uint{1, 1})
+
+	// Same account from a different IP
+	cl.IP = "::3"
+	vote(2, 0)
+	assertVotes(2, []uint{1, 1})
+
+	// Option out of bounds
+	cl.IP = "::4"
+	cl.UserID = ""
+	vote(2, 2)
+	assertVotes(2, []uint{1, 1})
+
+	// Post still open
+	vote(3, 0)
+	assertVotes(3, []uint{0, 0})
+
+	err := castVote([]byte(`{"id":2,"option":-1}`), cl)
+	if err != errInvalidVote {
+		UnexpectedError(t, err)
+	}
+}
@@ -23,6 +23,8 @@ var (
 	errImageNameTooLong  = errors.New("image name too long")
 	errNoTextOrImage     = errors.New("no text or image")
 	errThreadIsLocked    = errors.New("thread is locked")
+	errThreadIsArchived  = errors.New("thread is archived")
+	errImageLimit        = errors.New("thread image limit reached")
 )
 
 // Websocket message response codes
@@ -49,6 +51,7 @@ type imageRequest struct {
 
 type replyCreationRequest struct {
 	postCreationCommon
+	Sage bool
 	Body string
 }
 
@@ -70,6 +73,12 @@ func insertThread(data []byte, c *Client) (err error) {
 	if !auth.IsNonMetaBoard(req.Board) {
 		return errInvalidBoard
 	}
+	if banned, err := c.isBanned(req.Board); err != nil || banned {
+		return err
+	}
+	if limited, err := c.isRateLimited(threadLimit); err != nil || limited {
+		return err
+	}
 	if !authenticateCaptcha(req.Captcha, c.IP) {
 		return c.sendMessage(MessageInsertThread, threadCreationResponse{
 			Code: invalidInsertionCaptcha,
@@ -81,18 +90,28 @@ func insertThread(data []byte, c *Client) (err error) {
 		return err
 	}
 
-	post, now, err := constructPost(req.postCreationCommon, conf.ForcedAnon, c)
+	id, err := db.ReservePostID()
 	if err != nil {
 		return err
 	}
+	post, now, err := constructPost(
+		req.postCreationCommon,
+		req.Board,
+		id,
+		conf,
+		c,
+	)
+	if err != nil {
+		return c.handleFiltered(req.Board, err)
+	}
 	post.Board = req.Board
 	thread := types.DatabaseThread{
 		ReplyTime: now,
 		Board:     req.Board,
 	}
-	thread.Subject, err = parser.ParseSubject(req.Subject)
+	thread.Subject, err = parser.ParseSubject(req.Subject, req.Board)
 	if err != nil {
-		return err
+		return c.handleFiltered(req.Board, err)
 	}
 
 	// Perform this last, so there are less dangling images because of an error
@@ -106,10 +125,6 @@ func insertThread(data []byte, c *Client) (err error) {
 		}
 	}
 
-	id, err := db.ReservePostID()
-	if err != nil {
-		return err
-	}
 	thread.ID = id
 	post.ID = id
 	post.OP = id
@@ -123,14 +138,19 @@ func insertThread(data []byte, c *Client) (err error) {
 	if err := db.IncrementBoardCounter(req.Board); err != nil {
 		return err
 	}
+	if conf.MaxThreads != 0 {
+		if err := db.TrimBoard(req.Board, conf.MaxThreads); err != nil {
+			return err
+		}
+	}
 
-	c.openPost = openPost{
+	c.setOpenPost(openPost{
 		id:       id,
 		op:       id,
 		time:     now,
 		board:    req.Board,
 		hasImage: hasImage,
-	}
+	})
 
 	msg := threadCreationResponse{
 		Code: postCreated,
@@ -151,6 +171,12 @@ func insertPost(data []byte, c *Client) error {
 	}
 
 	_, sync := Clients.GetSync(c)
+	if banned, err := c.isBanned(sync.Board); err != nil || banned {
+		return err
+	}
+	if limited, err := c.isRateLimited(postLimit); err != nil || limited {
+		return err
+	}
 	conf, err := getBoardConfig(sync.Board)
 	if err != nil {
 		return err
@@ -162,22 +188,40 @@ func insertPost(data []byte, c *Client) error {
 		return errNoTextOrImage
 	}
 
-	// Check thread is not locked and retrieve the post counter
+	// Check thread is not locked, archived or deleted and retrieve the post
+	// and image counters
 	var threadAttrs struct {
-		Locked  bool
-		PostCtr int
+		Locked, Archived, Deleted bool
+		PostCtr, ImageCtr         uint
 	}
-	q := r.Table("threads").Get(sync.OP).Pluck("locked", "postCtr")
+	q := r.
+		Table("threads").
+		Get(sync.OP).
+		Pluck("locked", "archived", "deleted", "postCtr", "imageCtr")
 	if err := db.One(q, &threadAttrs); err != nil {
 		return err
 	}
-	if threadAttrs.Locked {
+	switch {
+	case threadAttrs.Deleted:
+		return errInvalidThread
+	case threadAttrs.Archived:
+		return errThreadIsArchived
+	case threadAttrs.Locked:
 		return errThreadIsLocked
-	}
-
-	post, now, err := constructPost(req.postCreationCommon, conf.ForcedAnon, c)
+	case hasImage && conf.ImageLimit != 0 &&
+		threadAttrs.ImageCtr >= conf.ImageLimit:
+		return errImageLimit
+	}
+
+	post, now, err := constructPost(
+		req.postCreationCommon,
+		sync.Board,
+		sync.OP,
+		conf,
+		c,
+	)
 	if err != nil {
-		return err
+		return c.handleFiltered(sync.Board, err)
 	}
 
 	// If the post contains a newline, slice till it and commit the remainder
@@ -190,6 +234,9 @@ func insertPost(data []byte, c *Client) error {
 	}
 	post.Body = req.Body
 
+	// Also support the legacy "sage" email field value
+	post.Sage = req.Sage || strings.EqualFold(post.Email, "sage")
+
 	post.OP = sync.OP
 	post.Board = sync.Board
 	post.ID, err = db.ReservePostID()
@@ -199,7 +246,11 @@ func insertPost(data []byte, c *Client) error {
 
 	updates := make(map[string]interface{}, 3)
 	updates["postCtr"] = r.Row.Field("postCtr").Add(1)
-	updates["replyTime"] = now
+	bump := !post.Sage &&
+		(conf.BumpLimit == 0 || threadAttrs.PostCtr < conf.BumpLimit)
+	if bump {
+		updates["replyTime"] = now
+	}
 
 	if hasImage {
 		img := req.Image
@@ -227,7 +278,7 @@ func insertPost(data []byte, c *Client) error {
 		return err
 	}
 
-	c.openPost = openPost{
+	c.setOpenPost(openPost{
 		id:         post.ID,
 		op:         sync.OP,
 		time:       now,
@@ -235,7 +286,7 @@ func insertPost(data []byte, c *Client) error {
 		Buffer:     *bytes.NewBuffer([]byte(post.Body)),
 		bodyLength: utf8.RuneCountInString(post.Body),
 		hasImage:   hasImage,
-	}
+	})
 
 	if forSplicing != "" {
 		if err := parseLine(c, true); err != nil {
@@ -264,8 +315,15 @@ func getBoardConfig(board string) (conf config.PostParseConfigs, err error) {
 	return
 }
 
-// Construct the common parts of the new post for both threads and replies
-func constructPost(req postCreationCommon, forcedAnon bool, c *Client) (
+// Construct the common parts of the new post for both threads and replies.
+// op is the ID of the parent thread, which for threads is the thread's own ID.
+func constructPost(
+	req postCreationCommon,
+	board string,
+	op int64,
+	conf config.PostParseConfigs,
+	c *Client,
+) (
 	post types.DatabasePost, now int64, err error,
 ) {
 	now = time.Now().Unix()
@@ -279,9 +337,13 @@ func constructPost(req postCreationCommon, forcedAnon bool, c *Client) (
 		},
 		LastUpdated: now,
 		IP:          c.IP,
+		Lease:       db.NewLease(c.connID),
+	}
+	if conf.PosterIDs {
+		post.PosterID = parser.PosterID(c.IP, op)
 	}
-	if !forcedAnon {
-		post.Name, post.Trip, err = parser.ParseName(req.Name)
+	if !conf.ForcedAnon {
+		post.Name, post.Trip, err = parser.ParseName(req.Name, board)
 		if err != nil {
 			return
 		}
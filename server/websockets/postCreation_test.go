@@ -7,6 +7,7 @@ import (
 
 	"github.com/bakape/meguca/config"
 	"github.com/bakape/meguca/db"
+	"github.com/bakape/meguca/parser"
 	. "github.com/bakape/meguca/test"
 	"github.com/bakape/meguca/types"
 	r "github.com/dancannon/gorethink"
@@ -364,6 +365,177 @@ func TestPostCreationOnLockedThread(t *testing.T) {
 	}
 }
 
+func TestPostCreationOnArchivedThread(t *testing.T) {
+	assertTableClear(t, "threads")
+	assertInsert(t, "threads", map[string]interface{}{
+		"id":       1,
+		"board":    "a",
+		"postCtr":  0,
+		"archived": true,
+	})
+	setBoardConfigs(t, true)
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	Clients.add(cl, SyncID{1, "a"})
+	defer Clients.Clear()
+
+	req := replyCreationRequest{
+		Body: "a",
+	}
+	if err := insertPost(marshalJSON(t, req), cl); err != errThreadIsArchived {
+		UnexpectedError(t, err)
+	}
+}
+
+func TestPostCreationPastImageLimit(t *testing.T) {
+	assertTableClear(t, "threads")
+	assertInsert(t, "threads", types.DatabaseThread{
+		ID:       1,
+		Board:    "a",
+		PostCtr:  3,
+		ImageCtr: 2,
+	})
+	config.ClearBoards()
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		BoardPublic: config.BoardPublic{
+			PostParseConfigs: config.PostParseConfigs{
+				ImageLimit: 2,
+			},
+		},
+	})
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	Clients.add(cl, SyncID{1, "a"})
+	defer Clients.Clear()
+
+	req := replyCreationRequest{
+		postCreationCommon: postCreationCommon{
+			Image: imageRequest{
+				Name:  "foo.jpeg",
+				Token: "123",
+			},
+		},
+	}
+	if err := insertPost(marshalJSON(t, req), cl); err != errImageLimit {
+		UnexpectedError(t, err)
+	}
+}
+
+func TestPostCreationPastBumpLimit(t *testing.T) {
+	assertTableClear(t, "main", "threads", "posts")
+	assertInsert(t, "threads", types.DatabaseThread{
+		ID:        1,
+		Board:     "a",
+		PostCtr:   3,
+		ReplyTime: 1,
+	})
+	populateMainTable(t)
+	config.ClearBoards()
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		BoardPublic: config.BoardPublic{
+			PostParseConfigs: config.PostParseConfigs{
+				BumpLimit: 3,
+			},
+		},
+	})
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	Clients.add(cl, SyncID{1, "a"})
+	defer Clients.Clear()
+
+	req := replyCreationRequest{
+		Body: "a",
+		postCreationCommon: postCreationCommon{
+			Password: "123",
+		},
+	}
+	if err := insertPost(marshalJSON(t, req), cl); err != nil {
+		t.Fatal(err)
+	}
+
+	var attrs struct {
+		PostCtr   int
+		ReplyTime int64
+	}
+	q := db.FindThread(1).Pluck("postCtr", "replyTime")
+	if err := db.One(q, &attrs); err != nil {
+		t.Fatal(err)
+	}
+	if attrs.PostCtr != 4 {
+		t.Errorf("unexpected post counter: %d", attrs.PostCtr)
+	}
+	if attrs.ReplyTime != 1 {
+		t.Error("thread bumped past bump limit")
+	}
+}
+
+func TestPostCreationWithSage(t *testing.T) {
+	cases := [...]struct {
+		name, email string
+		sage        bool
+	}{
+		{"sage flag", "", true},
+		{"legacy email", "SAGE", false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			assertTableClear(t, "main", "threads", "posts")
+			assertInsert(t, "threads", types.DatabaseThread{
+				ID:        1,
+				Board:     "a",
+				ReplyTime: 1,
+			})
+			populateMainTable(t)
+			setBoardConfigs(t, true)
+
+			sv := newWSServer(t)
+			defer sv.Close()
+			cl, _ := sv.NewClient()
+			Clients.add(cl, SyncID{1, "a"})
+			defer Clients.Clear()
+
+			req := replyCreationRequest{
+				Body: "a",
+				Sage: c.sage,
+				postCreationCommon: postCreationCommon{
+					Email:    c.email,
+					Password: "123",
+				},
+			}
+			if err := insertPost(marshalJSON(t, req), cl); err != nil {
+				t.Fatal(err)
+			}
+
+			var sage bool
+			if err := db.One(db.FindPost(6).Field("sage"), &sage); err != nil {
+				t.Fatal(err)
+			}
+			if !sage {
+				t.Error("post not marked as sage")
+			}
+
+			var replyTime int64
+			q := db.FindThread(1).Field("replyTime")
+			if err := db.One(q, &replyTime); err != nil {
+				t.Fatal(err)
+			}
+			if replyTime != 1 {
+				t.Error("thread bumped by sage post")
+			}
+		})
+	}
+}
+
 func TestPostCreation(t *testing.T) {
 	prepareForPostCreation(t)
 	setBoardConfigs(t, false)
@@ -603,6 +775,47 @@ func TestPostCreationForcedAnon(t *testing.T) {
 	}
 }
 
+func TestPostCreationWithPosterIDs(t *testing.T) {
+	prepareForPostCreation(t)
+	config.ClearBoards()
+	_, err := config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		BoardPublic: config.BoardPublic{
+			PostParseConfigs: config.PostParseConfigs{
+				PosterIDs: true,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	cl.IP = "::1"
+	Clients.add(cl, SyncID{1, "a"})
+	defer Clients.Clear()
+
+	req := replyCreationRequest{
+		Body: "a",
+		postCreationCommon: postCreationCommon{
+			Password: "123",
+		},
+	}
+	if err := insertPost(marshalJSON(t, req), cl); err != nil {
+		t.Fatal(err)
+	}
+
+	var id string
+	if err := db.One(db.FindPost(6).Field("posterID"), &id); err != nil {
+		t.Fatal(err)
+	}
+	if std := parser.PosterID("::1", 1); id != std {
+		LogUnexpected(t, std, id)
+	}
+}
+
 func assertImageCounter(t *testing.T, id int64, ctr int) {
 	var res int
 	q := db.FindThread(id).Field("imageCtr")
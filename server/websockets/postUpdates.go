@@ -1,6 +1,7 @@
 package websockets
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"time"
@@ -53,8 +54,9 @@ type spliceMessage struct {
 // Message sent to listening clients about a link or backlink insertion into
 // a post
 type linkMessage struct {
-	ID    int64         `json:"id"`
-	Links types.LinkMap `json:"links"`
+	ID         int64         `json:"id"`
+	Links      types.LinkMap `json:"links"`
+	BoardLinks []string      `json:"boardLinks,omitempty"`
 }
 
 // Message sent to all clients to inject a command result into a model
@@ -114,7 +116,9 @@ func appendRune(data []byte, c *Client) error {
 	if err != nil {
 		return err
 	}
-	q := r.Row.Field("body").Add(string(char))
+	q := func(p r.Term) r.Term {
+		return p.Field("body").Add(string(char))
+	}
 	if err := c.updatePost("body", q, msg); err != nil {
 		return err
 	}
@@ -124,44 +128,106 @@ func appendRune(data []byte, c *Client) error {
 	return nil
 }
 
-// Helper for running post update queries on the current open post
+// Helper for running post update queries on the current open post. val can
+// be either a value or a function, that computes the value from the post
+// document. The update is only applied, if the client holds the lease on the
+// post.
 func (c *Client) updatePost(key string, val interface{}, msg []byte) error {
-	return UpdatePost(c.openPost.id, key, val, msg)
+	return c.updatePostFields(map[string]interface{}{key: val}, msg)
+}
+
+// Like updatePost, but updates multiple fields with a single replication log
+// message
+func (c *Client) updatePostFields(
+	fields map[string]interface{},
+	msg []byte,
+) error {
+	now := time.Now().Unix()
+	ok, err := db.UpdateLeased(
+		c.openPost.id,
+		c.connID,
+		func(p r.Term) map[string]interface{} {
+			update := db.AppendLog(p, msg, now)
+			for key, val := range fields {
+				if fn, ok := val.(func(r.Term) r.Term); ok {
+					update[key] = fn(p)
+				} else {
+					update[key] = val
+				}
+			}
+			return update
+		},
+	)
+	switch {
+	case err != nil:
+		return err
+	case !ok:
+		c.setOpenPost(openPost{})
+		return errLeaseLost
+	default:
+		return nil
+	}
 }
 
 // UpdatePost post updates a single field of an existing post with the
 // appropriate replication log update and timestamp modification.
 func UpdatePost(id int64, key string, val interface{}, msg []byte) error {
-	update := map[string]interface{}{
-		key:           val,
-		"log":         appendLog(msg),
-		"lastUpdated": time.Now().Unix(),
-	}
+	update := appendLog(msg)
+	update[key] = val
 	return db.Write(r.Table("posts").Get(id).Update(update))
 }
 
-// Shorthand for creating a replication log append query
-func appendLog(msg []byte) r.Term {
-	return r.Row.Field("log").Append(msg)
+// Shorthand for creating the fields of a replication log append query
+func appendLog(msg []byte) map[string]interface{} {
+	return db.AppendLog(r.Row, msg, time.Now().Unix())
 }
 
-// Parse line contents and commit newline. If line contains hash commands or
+// Parse line contents and commit newline. If content filters modified the
+// line, the modified line is committed first. If line contains hash commands or
 // links to other posts also commit those and generate backlinks, if needed.
 // Appending the newline can be optionally omitted, to optimise post closing
 // and similar.
 func parseLine(c *Client, insertNewline bool) error {
 	c.openPost.bodyLength++
-	links, comm, err := parser.ParseLine(c.openPost.Bytes(), c.openPost.board)
+	line, links, boardLinks, comm, err := parser.ParseLine(
+		c.openPost.Bytes(),
+		c.openPost.board,
+	)
 	if err != nil {
-		return err
+		return c.rejectOpenPost(err)
+	}
+	if !bytes.Equal(line, c.openPost.Bytes()) {
+		err := spliceLine(spliceRequest{
+			spliceCoords: spliceCoords{Len: -1},
+			Text:         []rune(string(line)),
+		}, c)
+		if err != nil {
+			return err
+		}
 	}
 	defer c.openPost.Reset()
 
+	// Non-empty lines following a #poll command are its options
+	if c.openPost.hasPoll {
+		if err := appendPollOption(c, string(line)); err != nil {
+			return err
+		}
+	}
+
+	// Only one poll per post is allowed
+	if comm.Type == types.Poll && comm.Val != nil {
+		if c.openPost.hasPoll {
+			comm = types.Command{}
+		} else {
+			c.openPost.hasPoll = true
+		}
+	}
+
 	switch {
 	case comm.Val != nil:
 		err = writeCommand(comm, c)
-	case links != nil:
-		err = writeLinks(links, c)
+	case links != nil || boardLinks != nil:
+		err = writeLinks(links, boardLinks, c)
 	}
 	if err != nil {
 		return err
@@ -175,7 +241,9 @@ func parseLine(c *Client, insertNewline bool) error {
 		if err != nil {
 			return err
 		}
-		q := r.Row.Field("body").Add("\n")
+		q := func(p r.Term) r.Term {
+			return p.Field("body").Add("\n")
+		}
 		if err := c.updatePost("body", q, msg); err != nil {
 			return err
 		}
@@ -193,20 +261,35 @@ func writeCommand(comm types.Command, c *Client) error {
 	if err != nil {
 		return err
 	}
-	q := r.Row.Field("commands").Default([]types.Command{}).Append(comm)
+	q := func(p r.Term) r.Term {
+		return p.Field("commands").Default([]types.Command{}).Append(comm)
+	}
 	return c.updatePost("commands", q, msg)
 }
 
-// Write new links to other posts to the database
-func writeLinks(links types.LinkMap, c *Client) error {
+// Write new links to other posts and boards to the database
+func writeLinks(links types.LinkMap, boardLinks []string, c *Client) error {
 	msg, err := EncodeMessage(MessageLink, linkMessage{
-		ID:    c.openPost.id,
-		Links: links,
+		ID:         c.openPost.id,
+		Links:      links,
+		BoardLinks: boardLinks,
 	})
 	if err != nil {
 		return err
 	}
-	if err := c.updatePost("links", links, msg); err != nil {
+	fields := make(map[string]interface{}, 2)
+	if links != nil {
+		fields["links"] = links
+	}
+	if boardLinks != nil {
+		fields["boardLinks"] = func(p r.Term) r.Term {
+			return p.
+				Field("boardLinks").
+				Default([]string{}).
+				SetUnion(boardLinks)
+		}
+	}
+	if err := c.updatePostFields(fields, msg); err != nil {
 		return err
 	}
 
@@ -225,30 +308,28 @@ func writeLinks(links types.LinkMap, c *Client) error {
 }
 
 // Writes the location data of the post linking a post to the the post being
-// linked
+// linked. The linking post's parenthood is cached, as replies to it are likely
+// to follow.
 func writeBacklink(id, op int64, board string, destID int64) error {
+	link := types.Link{
+		OP:    op,
+		Board: board,
+	}
+	db.CacheParenthood(id, link)
+
 	msg, err := EncodeMessage(MessageBacklink, linkMessage{
 		ID: destID,
 		Links: types.LinkMap{
-			id: {
-				OP:    op,
-				Board: board,
-			},
+			id: link,
 		},
 	})
 	if err != nil {
 		return err
 	}
 
-	update := map[string]interface{}{
-		"backlinks": map[string]types.Link{
-			util.IDToString(id): types.Link{
-				OP:    op,
-				Board: board,
-			},
-		},
-		"log":         appendLog(msg),
-		"lastUpdated": time.Now().Unix(),
+	update := appendLog(msg)
+	update["backlinks"] = map[string]types.Link{
+		util.IDToString(id): link,
 	}
 	return db.Write(r.Table("posts").Get(destID).Update(update))
 }
@@ -273,7 +354,10 @@ func backspace(_ []byte, c *Client) error {
 	if err != nil {
 		return err
 	}
-	return c.updatePost("body", r.Row.Field("body").Slice(0, -1), msg)
+	q := func(p r.Term) r.Term {
+		return p.Field("body").Slice(0, -1)
+	}
+	return c.updatePost("body", q, msg)
 }
 
 // Close an open post and parse the last line, if needed.
@@ -295,7 +379,7 @@ func closePost(_ []byte, c *Client) error {
 		return err
 	}
 
-	c.openPost = openPost{}
+	c.setOpenPost(openPost{})
 	return nil
 }
 
@@ -389,22 +473,24 @@ func spliceLine(req spliceRequest, c *Client) error {
 	}
 
 	// Split body into lines, remove last line and replace with new text
-	q := r.Row.
-		Field("body").
-		Split("\n").
-		Do(func(b r.Term) r.Term {
-			return b.
-				Slice(0, -1).
-				Append(new).
-				Fold("", func(all, line r.Term) r.Term {
-					return all.Add(
-						all.Eq("").Branch(
-							line,
-							r.Expr("\n").Add(line),
-						),
-					)
-				})
-		})
+	q := func(p r.Term) r.Term {
+		return p.
+			Field("body").
+			Split("\n").
+			Do(func(b r.Term) r.Term {
+				return b.
+					Slice(0, -1).
+					Append(new).
+					Fold("", func(all, line r.Term) r.Term {
+						return all.Add(
+							all.Eq("").Branch(
+								line,
+								r.Expr("\n").Add(line),
+							),
+						)
+					})
+			})
+	}
 	if err := c.updatePost("body", q, msg); err != nil {
 		return err
 	}
@@ -436,9 +522,20 @@ func insertImage(data []byte, c *Client) error {
 		return err
 	}
 
-	if config.GetBoardConfigs(c.openPost.board).TextOnly {
+	conf := config.GetBoardConfigs(c.openPost.board)
+	if conf.TextOnly {
 		return errTextOnly
 	}
+	if conf.ImageLimit != 0 {
+		var imageCtr uint
+		q := r.Table("threads").Get(c.openPost.op).Field("imageCtr")
+		if err := db.One(q, &imageCtr); err != nil {
+			return err
+		}
+		if imageCtr >= conf.ImageLimit {
+			return errImageLimit
+		}
+	}
 
 	img, err := getImage(req.Token, req.Name, req.Spoiler)
 	if err != nil {
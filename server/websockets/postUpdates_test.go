@@ -307,6 +307,83 @@ func TestAppendNewline(t *testing.T) {
 	assertRepLog(t, 2, append(strDummyLog, "03[2,10]"))
 }
 
+func TestAppendNewlineWithFilter(t *testing.T) {
+	assertTableClear(t, "posts")
+	assertInsert(t, "posts", samplePost)
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		Filters: []config.Filter{
+			{
+				Pattern:     "B",
+				Replacement: "xx",
+			},
+		},
+	})
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	cl.openPost = openPost{
+		id:         2,
+		op:         1,
+		bodyLength: 3,
+		board:      "a",
+		time:       time.Now().Unix(),
+		Buffer:     *bytes.NewBuffer([]byte("abc")),
+	}
+
+	if err := appendRune([]byte("10"), cl); err != nil {
+		t.Fatal(err)
+	}
+
+	assertOpenPost(t, cl, 5, "")
+	assertBody(t, 2, "axxc\n")
+	assertRepLog(t, 2, append(
+		strDummyLog,
+		`05{"id":2,"start":0,"len":-1,"text":"axxc"}`,
+		"03[2,10]",
+	))
+}
+
+func TestClosePostWithRejectFilter(t *testing.T) {
+	assertTableClear(t, "posts", "threads")
+	assertInsert(t, "posts", samplePost)
+	assertInsert(t, "threads", types.DatabaseThread{
+		ID:      1,
+		Board:   "a",
+		PostCtr: 1,
+	})
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		Filters: []config.Filter{
+			{
+				Pattern: "abc",
+				Action:  config.FilterReject,
+			},
+		},
+	})
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	cl.openPost = openPost{
+		id:         2,
+		op:         1,
+		bodyLength: 3,
+		board:      "a",
+		time:       time.Now().Unix(),
+		Buffer:     *bytes.NewBuffer([]byte("abc")),
+	}
+
+	err := closePost(nil, cl)
+	if _, ok := err.(parser.ErrFiltered); !ok {
+		UnexpectedError(t, err)
+	}
+	AssertDeepEquals(t, cl.openPost, openPost{})
+	assertBody(t, 2, "")
+	assertRepLog(t, 2, append(strDummyLog, "122"))
+}
+
 func TestAppendNewlineWithHashCommand(t *testing.T) {
 	assertTableClear(t, "posts")
 	assertInsert(t, "posts", types.DatabasePost{
@@ -480,6 +557,50 @@ func TestAppendNewlineWithLinks(t *testing.T) {
 	}
 }
 
+func TestAppendNewlineWithBoardLinks(t *testing.T) {
+	assertTableClear(t, "posts")
+	assertInsert(t, "posts", types.DatabasePost{
+		StandalonePost: types.StandalonePost{
+			Post: types.Post{
+				ID:   2,
+				Body: ">>>/a/ >>>/a/",
+			},
+			Board: "a",
+			OP:    1,
+		},
+		Log: [][]byte{},
+	})
+	setBoardConfigs(t, false)
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	cl.openPost = openPost{
+		id:         2,
+		op:         1,
+		bodyLength: 13,
+		board:      "a",
+		time:       time.Now().Unix(),
+		Buffer:     *bytes.NewBuffer([]byte(">>>/a/ >>>/a/")),
+	}
+
+	if err := appendRune([]byte("10"), cl); err != nil {
+		t.Fatal(err)
+	}
+
+	assertRepLog(t, 2, []string{
+		`07{"id":2,"links":null,"boardLinks":["a"]}`,
+		`03[2,10]`,
+	})
+
+	var boardLinks []string
+	q := db.FindPost(2).Field("boardLinks")
+	if err := db.One(q, &boardLinks); err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, boardLinks, []string{"a"})
+}
+
 func TestBackspace(t *testing.T) {
 	assertTableClear(t, "posts")
 	assertInsert(t, "posts", samplePost)
@@ -873,6 +994,43 @@ func TestInsertImageOnTextOnlyBoard(t *testing.T) {
 	}
 }
 
+func TestInsertImagePastImageLimit(t *testing.T) {
+	assertTableClear(t, "threads")
+	assertInsert(t, "threads", types.DatabaseThread{
+		ID:       1,
+		Board:    "a",
+		PostCtr:  3,
+		ImageCtr: 2,
+	})
+	config.ClearBoards()
+	config.SetBoardConfigs(config.BoardConfigs{
+		ID: "a",
+		BoardPublic: config.BoardPublic{
+			PostParseConfigs: config.PostParseConfigs{
+				ImageLimit: 2,
+			},
+		},
+	})
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	cl.openPost = openPost{
+		id:    2,
+		op:    1,
+		board: "a",
+		time:  time.Now().Unix(),
+	}
+
+	req := imageRequest{
+		Name:  "foo.jpeg",
+		Token: "123",
+	}
+	if err := insertImage(marshalJSON(t, req), cl); err != errImageLimit {
+		UnexpectedError(t, err)
+	}
+}
+
 func TestInsertImage(t *testing.T) {
 	assertTableClear(t, "posts", "threads", "images", "imageTokens")
 	setBoardConfigs(t, false)
@@ -0,0 +1,55 @@
+// Publishing of the clients connected to this server instance and reading the
+// clients connected to other instances sharing the database
+
+package websockets
+
+import (
+	"log"
+	"time"
+
+	"github.com/bakape/meguca/db"
+)
+
+// Interval at which this instance's presence is published and online counts
+// are sent to clients
+const presenceHeartbeat = db.PresenceTimeout / 3
+
+// Periodically synchronise presence with other server instances. Must be
+// launched in a separate goroutine.
+func presenceLoop() {
+	for range time.Tick(presenceHeartbeat) {
+		if err := syncPresence(); err != nil {
+			log.Printf("presence: %s\n", err)
+		}
+	}
+}
+
+// RemovePresence removes this instance's presence document from the registry,
+// so its clients stop being counted by other instances. Called on graceful
+// shutdown.
+func RemovePresence() error {
+	if instanceID == "" {
+		return nil
+	}
+	return db.RemovePresence(instanceID)
+}
+
+// Publish this instance's clients to the presence registry, read the clients
+// of other instances and send updated online counts to all clients
+func syncPresence() error {
+	if err := db.WritePresence(instanceID, Clients.presence()); err != nil {
+		return err
+	}
+	instances, err := db.GetPresence(instanceID)
+	if err != nil {
+		return err
+	}
+
+	var remote []db.PresenceClient
+	for _, inst := range instances {
+		remote = append(remote, inst.Clients...)
+	}
+	Clients.setRemote(remote)
+	Clients.sendOnlineCounts()
+	return nil
+}
@@ -0,0 +1,69 @@
+package websockets
+
+import (
+	"testing"
+
+	"github.com/bakape/meguca/db"
+	. "github.com/bakape/meguca/test"
+)
+
+func TestSyncPresence(t *testing.T) {
+	assertTableClear(t, "presence")
+	defer Clients.Clear()
+
+	remote := []db.PresenceClient{
+		{
+			IP:    "::2",
+			Board: "a",
+			OP:    1,
+		},
+	}
+	if err := db.WritePresence("other", remote); err != nil {
+		t.Fatal(err)
+	}
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, _ := sv.NewClient()
+	cl.IP = "::1"
+	Clients.add(cl, SyncID{
+		OP:    1,
+		Board: "a",
+	})
+
+	if err := syncPresence(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Published own clients
+	res, err := db.GetPresence("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []db.InstancePresence{
+		{
+			ID: instanceID,
+			Clients: []db.PresenceClient{
+				{
+					IP:    "::1",
+					Board: "a",
+					OP:    1,
+				},
+			},
+		},
+	}
+	AssertDeepEquals(t, res, std)
+
+	// Read remote clients and sent counts
+	if n := Clients.CountByIP(); n != 2 {
+		LogUnexpected(t, 2, n)
+	}
+	select {
+	case msg := <-cl.sendExternal:
+		if s := string(msg.text); s != "502" {
+			LogUnexpected(t, "502", s)
+		}
+	default:
+		t.Error("online count not sent")
+	}
+}
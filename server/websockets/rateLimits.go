@@ -0,0 +1,143 @@
+// Per-IP flood protection for post creation and websocket messages
+
+package websockets
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bakape/meguca/config"
+)
+
+// Kinds of rate limited actions. Sent to the client as the payload of
+// MessageRateLimited.
+type rateLimitType uint8
+
+const (
+	threadLimit rateLimitType = iota
+	postLimit
+	messageLimit
+	captchaLimit
+	reportLimit
+)
+
+const (
+	// Maximum number of post reports an IP can submit in reportPeriod
+	maxReports   = 5
+	reportPeriod = time.Minute * 10
+)
+
+// Interval to sweep expired counters from the rate limiter at
+const rateLimitSweepInterval = time.Minute
+
+// Global rate limiter shared by all Clients
+var limiter = rateLimiter{
+	counters: make(map[rateLimitKey]*rateCounter),
+}
+
+// Rate limiter, that counts actions performed by IPs in fixed time windows.
+// Shared between all clients, so opening multiple connections from the same
+// IP does not circumvent the limits.
+type rateLimiter struct {
+	sync.Mutex
+	lastSweep time.Time
+	counters  map[rateLimitKey]*rateCounter
+}
+
+type rateLimitKey struct {
+	ip  string
+	typ rateLimitType
+}
+
+// Number of actions performed since the start of the current window
+type rateCounter struct {
+	start time.Time
+	count uint
+}
+
+// Returns the maximum number of actions and the window they are counted in
+// for a rate limit type. A zero maximum disables the limit.
+func rateLimitOf(typ rateLimitType) (uint, time.Duration) {
+	conf := config.Get()
+	switch typ {
+	case threadLimit:
+		return conf.ThreadsPerHour, time.Hour
+	case postLimit:
+		return conf.PostsPerMinute, time.Minute
+	case captchaLimit:
+		return conf.CaptchasPerMinute, time.Minute
+	case reportLimit:
+		return maxReports, reportPeriod
+	default:
+		return conf.MessagesPerSecond, time.Second
+	}
+}
+
+// Increment the counter of an action performed by an IP and return, if the
+// action is still within the configured limit
+func (l *rateLimiter) allow(ip string, typ rateLimitType) bool {
+	max, period := rateLimitOf(typ)
+	if max == 0 {
+		return true
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	key := rateLimitKey{ip, typ}
+	ctr := l.counters[key]
+	if ctr == nil || now.Sub(ctr.start) >= period {
+		ctr = &rateCounter{start: now}
+		l.counters[key] = ctr
+	}
+	ctr.count++
+	return ctr.count <= max
+}
+
+// Remove all counters, whose windows have expired. Must be called with the
+// lock held.
+func (l *rateLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for key, ctr := range l.counters {
+		_, period := rateLimitOf(key.typ)
+		if now.Sub(ctr.start) >= period {
+			delete(l.counters, key)
+		}
+	}
+}
+
+// Reset all counters. Only used in tests.
+func (l *rateLimiter) clear() {
+	l.Lock()
+	defer l.Unlock()
+	l.counters = make(map[rateLimitKey]*rateCounter)
+}
+
+// AllowCaptcha increments the captcha challenge counter of an IP and returns,
+// if the IP is still within the configured limit
+func AllowCaptcha(ip string) bool {
+	return limiter.allow(ip, captchaLimit)
+}
+
+// AllowReport increments the post report counter of an IP and returns, if the
+// IP is still within the limit. Reports are counted independently of their
+// storage, so resolving reports does not reset the limit.
+func AllowReport(ip string) bool {
+	return limiter.allow(ip, reportLimit)
+}
+
+// Checks, if the client's IP has exceeded the rate limit of an action. If so,
+// the client is notified and true is returned. The action that triggered the
+// limit should then be dropped without closing the connection.
+func (c *Client) isRateLimited(typ rateLimitType) (bool, error) {
+	// Tests share a single IP and would otherwise trip the limits
+	if isTest || limiter.allow(c.IP, typ) {
+		return false, nil
+	}
+	return true, c.sendMessage(MessageRateLimited, typ)
+}
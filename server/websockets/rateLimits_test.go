@@ -0,0 +1,102 @@
+package websockets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bakape/meguca/config"
+)
+
+func setRateLimits(threads, posts, messages uint) {
+	conf := config.Defaults
+	conf.ThreadsPerHour = threads
+	conf.PostsPerMinute = posts
+	conf.MessagesPerSecond = messages
+	config.Set(conf)
+	limiter.clear()
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	setRateLimits(2, 0, 1)
+
+	const ip = "::1"
+	for i := 0; i < 2; i++ {
+		if !limiter.allow(ip, threadLimit) {
+			t.Fatalf("thread %d limited", i)
+		}
+	}
+	if limiter.allow(ip, threadLimit) {
+		t.Error("thread limit not applied")
+	}
+
+	// Limits are per IP and per action type
+	if !limiter.allow("::2", threadLimit) {
+		t.Error("other IP limited")
+	}
+	if !limiter.allow(ip, messageLimit) {
+		t.Error("message limited")
+	}
+
+	// Zero disables the limit
+	for i := 0; i < 100; i++ {
+		if !limiter.allow(ip, postLimit) {
+			t.Fatal("disabled limit applied")
+		}
+	}
+}
+
+func TestRateLimiterWindowExpiry(t *testing.T) {
+	setRateLimits(1, 0, 0)
+
+	const ip = "::1"
+	limiter.allow(ip, threadLimit)
+	if limiter.allow(ip, threadLimit) {
+		t.Fatal("thread limit not applied")
+	}
+
+	key := rateLimitKey{ip, threadLimit}
+	limiter.counters[key].start = time.Now().Add(-time.Hour)
+	if !limiter.allow(ip, threadLimit) {
+		t.Error("window not reset")
+	}
+
+	// Expired counters are swept
+	limiter.counters[key].start = time.Now().Add(-time.Hour)
+	limiter.sweep(time.Now())
+	if _, ok := limiter.counters[key]; ok {
+		t.Error("expired counter not swept")
+	}
+}
+
+func TestRateLimitedMessage(t *testing.T) {
+	isTest = false
+	defer func() {
+		isTest = true
+	}()
+	setRateLimits(0, 1, 0)
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, wcl := sv.NewClient()
+
+	limited, err := cl.isRateLimited(postLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limited {
+		t.Fatal("first post limited")
+	}
+
+	limited, err = cl.isRateLimited(postLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !limited {
+		t.Fatal("second post not limited")
+	}
+	msg, err := EncodeMessage(MessageRateLimited, postLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMessage(t, wcl, string(msg))
+}
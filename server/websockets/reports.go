@@ -0,0 +1,74 @@
+// Live notification of board staff about new post reports
+
+package websockets
+
+import (
+	"log"
+	"time"
+
+	"github.com/bakape/meguca/db"
+	"github.com/bakape/meguca/types"
+	r "github.com/dancannon/gorethink"
+)
+
+// Interval between attempts to reestablish the report change feed
+const reportFeedRetryInterval = time.Second * 5
+
+// Subscribe to newly inserted reports and forward them to all logged in staff
+// of the reported post's board
+func listenToReports() error {
+	cursor, err := streamReports()
+	if err != nil {
+		return err
+	}
+	go forwardReports(cursor)
+	return nil
+}
+
+// Open a change feed of newly inserted reports
+func streamReports() (*r.Cursor, error) {
+	return r.
+		Table("reports").
+		Changes(r.ChangesOpts{IncludeTypes: true}).
+		Filter(r.Row.Field("type").Eq("add")).
+		Field("new_val").
+		Run(db.RSession)
+}
+
+// Forward reports from the change feed to staff. If the feed fails, it is
+// reestablished, until successful. Must be launched in a separate goroutine.
+func forwardReports(cursor *r.Cursor) {
+	for {
+		read := make(chan types.Report)
+		cursor.Listen(read)
+		for report := range read {
+			if err := notifyStaff(report); err != nil {
+				log.Printf("report notification: %s\n", err)
+			}
+		}
+
+		err := cursor.Err()
+		if err == nil { // Closed without error
+			return
+		}
+		log.Printf("report feed: %s\n", err)
+
+		for {
+			time.Sleep(reportFeedRetryInterval)
+			if cursor, err = streamReports(); err == nil {
+				break
+			}
+			log.Printf("report feed: %s\n", err)
+		}
+	}
+}
+
+// Send a new report to all logged in staff of the board
+func notifyStaff(report types.Report) error {
+	msg, err := EncodeMessage(MessageReport, report)
+	if err != nil {
+		return err
+	}
+	Clients.SendToStaff(report.Board, msg)
+	return nil
+}
@@ -6,7 +6,7 @@ import (
 	"bytes"
 	"errors"
 	"strings"
-
+	"time"
 	"unicode/utf8"
 
 	"github.com/bakape/meguca/auth"
@@ -16,6 +16,15 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// Maximum age of a client's last seen update, that can still be replayed
+	maxReplayAge = time.Hour
+
+	// Maximum number of messages to replay, before instructing the client to
+	// refetch the thread instead
+	maxReplayMessages = 1000
+)
+
 var (
 	errInvalidBoard   = errors.New("invalid board")
 	errInvalidThread  = errors.New("invalid thread")
@@ -23,8 +32,14 @@ var (
 )
 
 type syncRequest struct {
-	Thread int64
-	Board  string
+	// Switch to the binary message encoding. Otherwise the text encoding is
+	// used.
+	Binary bool
+	// Unix timestamp of the last update to the thread seen by the client.
+	// Enables replaying of any updates missed since. Optional.
+	LastUpdated int64
+	Thread      int64
+	Board       string
 }
 
 type reclaimRequest struct {
@@ -36,15 +51,17 @@ type reclaimRequest struct {
 // receive update messages.
 func synchronise(data []byte, c *Client) error {
 	// Unsubscribe from previous update feed, if any
-	if c.feedID != 0 {
-		feeds.Remove <- subRequest{c.feedID, c}
-		c.feedID = 0
-	}
+	c.unsubscribe()
 
 	var msg syncRequest
 	if err := decodeMessage(data, &msg); err != nil {
 		return err
 	}
+	if msg.Binary {
+		c.encoding = BinaryEncoding
+	} else {
+		c.encoding = TextEncoding
+	}
 	if !auth.IsBoard(msg.Board) {
 		return errInvalidBoard
 	}
@@ -53,16 +70,30 @@ func synchronise(data []byte, c *Client) error {
 		return syncToBoard(msg.Board, c)
 	}
 
-	return syncToThread(msg.Board, msg.Thread, c)
+	return syncToThread(msg.Board, msg.Thread, msg.LastUpdated, c)
 }
 
-// Board pages do not have any live feeds (for now, at least). Just send the
-// client its ID.
+// Subscribe the client to the board page update feed. Board pages do not
+// receive any missed messages, so just send an empty synchronization response.
 func syncToBoard(board string, c *Client) error {
 	registerSync(board, 0, c)
+	feeds.AddBoard <- boardSubRequest{board, c}
+	c.feedBoard = board
 	return c.sendMessage(MessageSynchronise, map[string]string{})
 }
 
+// Unsubscribe the client from its thread or board page update feed, if any
+func (c *Client) unsubscribe() {
+	if c.feedID != 0 {
+		feeds.Remove <- subRequest{c.feedID, c}
+		c.feedID = 0
+	}
+	if c.feedBoard != "" {
+		feeds.RemoveBoard <- boardSubRequest{c.feedBoard, c}
+		c.feedBoard = ""
+	}
+}
+
 // Register the client with the central client storage data structure
 func registerSync(board string, op int64, c *Client) {
 	id := SyncID{
@@ -78,7 +109,7 @@ func registerSync(board string, op int64, c *Client) {
 
 // Sends a response to the client's synchronization request with any missed
 // messages and starts streaming in updates.
-func syncToThread(board string, thread int64, c *Client) error {
+func syncToThread(board string, thread, lastUpdated int64, c *Client) error {
 	valid, err := db.ValidateOP(thread, board)
 	if err != nil {
 		return err
@@ -88,17 +119,68 @@ func syncToThread(board string, thread int64, c *Client) error {
 	}
 
 	registerSync(board, thread, c)
+	if lastUpdated != 0 {
+		if err := replay(thread, lastUpdated, c); err != nil {
+			return err
+		}
+	}
 	feeds.Add <- subRequest{thread, c}
 	c.feedID = thread
 
 	return nil
 }
 
-// Reclaim an open post after connection loss or navigating away.
-//
-// TODO: Technically there is no locking performed so a single post may be open
-// by multiple clients. This opens us up to some exploits, but nothing severe.
-// Still need to think of a solution.
+// Send the client any replication log entries and posts it has missed since
+// its last seen update. Updates within the last 30 seconds are sent by the
+// update feed. If too many updates were missed, the client is instructed to
+// refetch the thread instead.
+func replay(thread, since int64, c *Client) error {
+	now := time.Now()
+	until := now.Unix() - cacheAge
+	switch {
+	case since >= until:
+		return nil
+	case since < now.Add(-maxReplayAge).Unix():
+		return c.sendMessage(MessageResync, nil)
+	}
+
+	posts, n, err := db.GetReplay(thread, since, until)
+	switch {
+	case err != nil:
+		return err
+	case n == 0:
+		return nil
+	case n > maxReplayMessages:
+		return c.sendMessage(MessageResync, nil)
+	}
+
+	// Send everything as a single concatenated message
+	var buf messageBuffer
+	for _, p := range posts {
+		if p.Post == nil {
+			for _, msg := range p.Log {
+				buf.writeToBuffer(msg)
+			}
+			continue
+		}
+		if p.Post.Deleted { // Deleted before the client ever saw it
+			continue
+		}
+		msg, err := EncodeMessage(MessageInsertPost, p.Post)
+		if err != nil {
+			return err
+		}
+		buf.writeToBuffer(msg)
+	}
+	if msg := buf.flush(); msg != nil {
+		return c.send(msg)
+	}
+	return nil
+}
+
+// Reclaim an open post after connection loss or navigating away. The client
+// must acquire the lease on the post, so a post is never open by multiple
+// clients at once.
 func reclaimPost(data []byte, c *Client) error {
 	if err := closePreviousPost(c); err != nil {
 		return err
@@ -124,19 +206,42 @@ func reclaimPost(data []byte, c *Client) error {
 		return err
 	}
 
+	ok, err := db.AcquireLease(post.ID, c.connID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return c.sendMessage(MessageReclaim, 2)
+	}
+
 	iLast := strings.LastIndexByte(post.Body, '\n')
 	if iLast == -1 {
 		iLast = 0
 	}
-	c.openPost = openPost{
-		hasImage:   post.Image != nil,
-		Buffer:     *bytes.NewBufferString(post.Body[iLast:]),
-		bodyLength: utf8.RuneCountInString(post.Body),
-		id:         post.ID,
-		op:         post.OP,
-		time:       post.Time,
-		board:      post.Board,
+	var (
+		hasPoll     bool
+		pollOptions []string
+	)
+	for _, com := range post.Commands {
+		if com.Type == types.Poll {
+			hasPoll = true
+		}
+	}
+	if hasPoll {
+		// Options already written from the committed lines of the post
+		pollOptions = parsePollOptions(post.Body[:iLast])
 	}
+	c.setOpenPost(openPost{
+		hasImage:    post.Image != nil,
+		hasPoll:     hasPoll,
+		pollOptions: pollOptions,
+		Buffer:      *bytes.NewBufferString(post.Body[iLast:]),
+		bodyLength:  utf8.RuneCountInString(post.Body),
+		id:          post.ID,
+		op:          post.OP,
+		time:        post.Time,
+		board:       post.Board,
+	})
 
 	return c.sendMessage(MessageReclaim, 0)
 }
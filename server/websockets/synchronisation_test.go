@@ -34,6 +34,13 @@ func TestOldFeedClosing(t *testing.T) {
 	if cl.feedID != 0 {
 		t.Fatal("old feed not cleared")
 	}
+
+	feeds.AddBoard <- boardSubRequest{"a", cl}
+	cl.feedBoard = "a"
+	synchronise(nil, cl)
+	if cl.feedBoard != "" {
+		t.Fatal("old board feed not cleared")
+	}
 }
 
 func TestSyncToBoard(t *testing.T) {
@@ -58,7 +65,11 @@ func TestSyncToBoard(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer Clients.Clear()
+	defer feeds.Clear()
 	assertMessage(t, wcl, `30{}`)
+	if cl.feedBoard != "a" {
+		t.Fatal("not subscribed to board feed")
+	}
 }
 
 func TestRegisterSync(t *testing.T) {
@@ -153,6 +164,45 @@ func TestSyncToThread(t *testing.T) {
 	sv.Wait()
 }
 
+func TestReplay(t *testing.T) {
+	assertTableClear(t, "posts")
+	now := time.Now().Unix()
+	assertInsert(t, "posts", map[string]interface{}{
+		"id":          1,
+		"op":          1,
+		"time":        now - 600,
+		"log":         [][]byte{[]byte("041"), []byte("061")},
+		"logTimes":    []int64{now - 300, now - 120},
+		"lastUpdated": now - 120,
+	})
+
+	sv := newWSServer(t)
+	defer sv.Close()
+	cl, wcl := sv.NewClient()
+
+	// Nothing missed
+	if err := replay(1, now, cl); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only entries appended after the last seen update are replayed
+	if err := replay(1, now-200, cl); err != nil {
+		t.Fatal(err)
+	}
+	assertMessage(t, wcl, "061")
+
+	if err := replay(1, now-400, cl); err != nil {
+		t.Fatal(err)
+	}
+	assertMessage(t, wcl, "42041\u0000061")
+
+	// Too old to replay
+	if err := replay(1, now-7200, cl); err != nil {
+		t.Fatal(err)
+	}
+	assertMessage(t, wcl, encodeMessage(t, MessageResync, nil))
+}
+
 func TestReclaimPost(t *testing.T) {
 	assertTableClear(t, "posts")
 
@@ -184,6 +234,36 @@ func TestReclaimPost(t *testing.T) {
 				},
 			},
 		},
+		{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					Editing: true,
+					ID:      3,
+				},
+				OP:    1,
+				Board: "a",
+			},
+			Password: hash,
+			Lease: &types.Lease{
+				Owner:   "other",
+				Expires: time.Now().Add(time.Minute),
+			},
+		},
+		{
+			StandalonePost: types.StandalonePost{
+				Post: types.Post{
+					Editing: true,
+					ID:      4,
+				},
+				OP:    1,
+				Board: "a",
+			},
+			Password: hash,
+			Lease: &types.Lease{
+				Owner:   "other",
+				Expires: time.Now().Add(-time.Minute),
+			},
+		},
 	})
 
 	cases := [...]struct {
@@ -196,6 +276,8 @@ func TestReclaimPost(t *testing.T) {
 		{"already closed", 2, "", 1},
 		{"wrong password", 1, "aaaaaaaa", 1},
 		{"valid", 1, pw, 0},
+		{"open by another connection", 3, pw, 2},
+		{"lease expired", 4, pw, 0},
 	}
 
 	for i := range cases {
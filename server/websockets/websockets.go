@@ -9,6 +9,8 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bakape/meguca/auth"
@@ -60,9 +62,22 @@ type Client struct {
 	// Post currently open by the client
 	openPost openPost
 
+	// Set to 1, while the client has an open post. Unlike openPost, safe to
+	// read from other goroutines using atomic operations.
+	typing uint32
+
 	// Currently subscribed to update feed, if any
 	feedID int64
 
+	// Currently subscribed to board page update feed, if any
+	feedBoard string
+
+	// Encoding of messages negotiated on synchronisation
+	encoding Encoding
+
+	// Unique ID of the connection. Identifies the owner of open post leases.
+	connID string
+
 	// Underlying websocket connection
 	conn *websocket.Conn
 
@@ -73,7 +88,7 @@ type Client struct {
 	receive chan receivedMessage
 
 	// Only used to pass messages from the Send method.
-	sendExternal chan []byte
+	sendExternal chan *outgoingMessage
 
 	// Close the client and free all used resources
 	close chan error
@@ -84,15 +99,56 @@ type receivedMessage struct {
 	msg []byte
 }
 
+// Text-encoded message queued for sending to one or more clients. Clients
+// sharing the message share its binary encoding, so it is only transcoded once.
+type outgoingMessage struct {
+	text   []byte
+	once   sync.Once
+	binary []byte
+	err    error
+}
+
+func newOutgoingMessage(text []byte) *outgoingMessage {
+	return &outgoingMessage{
+		text: text,
+	}
+}
+
+// Returns the binary encoding of the message, transcoding it on first call
+func (m *outgoingMessage) toBinary() ([]byte, error) {
+	m.once.Do(func() {
+		m.binary, m.err = textToBinary(m.text)
+	})
+	return m.binary, m.err
+}
+
 // Data of a post currently being written to by a Client
 type openPost struct {
-	hasImage bool
+	hasImage    bool
+	hasPoll     bool
+	pollOptions []string
 	bytes.Buffer
 	bodyLength   int
 	id, op, time int64
 	board        string
 }
 
+// Set the post currently open by the client. Pass a zero value openPost to
+// clear it.
+func (c *Client) setOpenPost(p openPost) {
+	c.openPost = p
+	var typing uint32
+	if p.id != 0 {
+		typing = 1
+	}
+	atomic.StoreUint32(&c.typing, typing)
+}
+
+// Returns, if the client currently has an open post. Safe for concurrent use.
+func (c *Client) isTyping() bool {
+	return atomic.LoadUint32(&c.typing) == 1
+}
+
 // Handler is an http.HandleFunc that responds to new websocket connection
 // requests.
 func Handler(res http.ResponseWriter, req *http.Request) {
@@ -112,12 +168,13 @@ func Handler(res http.ResponseWriter, req *http.Request) {
 // newClient creates a new websocket client
 func newClient(conn *websocket.Conn, req *http.Request) *Client {
 	return &Client{
+		connID:  newConnID(),
 		Ident:   auth.LookUpIdent(req),
 		close:   make(chan error, 2),
 		receive: make(chan receivedMessage),
 		// Allows for ~6 seconds of messages at 0.2 second intervals, until the
 		// buffer overflows.
-		sendExternal: make(chan []byte, 1<<5),
+		sendExternal: make(chan *outgoingMessage, 1<<5),
 		conn:         conn,
 	}
 }
@@ -139,13 +196,15 @@ func (c *Client) listenerLoop() error {
 	// after rather short timeout, if no messages have been sent.
 	ping := time.NewTicker(pingTimer)
 	defer ping.Stop()
+	lease := time.NewTicker(leaseHeartbeat)
+	defer lease.Stop()
 
 	for {
 		select {
 		case err := <-c.close:
 			return err
 		case msg := <-c.sendExternal:
-			if err := c.send(msg); err != nil {
+			if err := c.sendOutgoing(msg); err != nil {
 				return err
 			}
 		case <-ping.C:
@@ -154,6 +213,10 @@ func (c *Client) listenerLoop() error {
 			if err != nil {
 				return err
 			}
+		case <-lease.C:
+			if err := c.renewLease(); err != nil {
+				return err
+			}
 		case msg := <-c.receive:
 			if err := c.handleMessage(msg.typ, msg.msg); err != nil {
 				return err
@@ -164,10 +227,12 @@ func (c *Client) listenerLoop() error {
 
 // Close all connections an goroutines associated with the Client
 func (c *Client) closeConnections(err error) error {
-	// Close update feed, if any
-	if c.feedID != 0 {
-		feeds.Remove <- subRequest{c.feedID, c}
-		c.feedID = 0
+	// Close update feeds, if any
+	c.unsubscribe()
+
+	// Allow reclaiming the open post from another connection
+	if leaseErr := c.releaseLease(); leaseErr != nil {
+		c.logError(leaseErr)
 	}
 
 	// Close receiver loop
@@ -214,6 +279,12 @@ func (c *Client) closeConnections(err error) error {
 
 // Send a message to the client. Can be used concurrently.
 func (c *Client) Send(msg []byte) {
+	c.sendShared(newOutgoingMessage(msg))
+}
+
+// Send a message shared with other clients to the client. Can be used
+// concurrently.
+func (c *Client) sendShared(msg *outgoingMessage) {
 	select {
 	case c.sendExternal <- msg:
 	default:
@@ -221,19 +292,37 @@ func (c *Client) Send(msg []byte) {
 	}
 }
 
-// Sends a message to the client. Not safe for concurrent use.
+// Sends a text-encoded message to the client, converting it to the client's
+// encoding, if needed. Not safe for concurrent use.
 func (c *Client) send(msg []byte) error {
-	return c.conn.WriteMessage(websocket.TextMessage, msg)
+	return c.sendOutgoing(newOutgoingMessage(msg))
 }
 
-// Format a message type as JSON and send it to the client. Not safe for
+// Sends a queued message to the client in the client's encoding. Not safe for
 // concurrent use.
+func (c *Client) sendOutgoing(msg *outgoingMessage) error {
+	if c.encoding == BinaryEncoding {
+		conv, err := msg.toBinary()
+		if err != nil {
+			return err
+		}
+		return c.conn.WriteMessage(websocket.BinaryMessage, conv)
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, msg.text)
+}
+
+// Encode a message in the client's encoding and send it to the client. Not
+// safe for concurrent use.
 func (c *Client) sendMessage(typ MessageType, msg interface{}) error {
-	encoded, err := EncodeMessage(typ, msg)
+	encoded, err := EncodeMessageAs(c.encoding, typ, msg)
 	if err != nil {
 		return err
 	}
-	return c.send(encoded)
+	frame := websocket.TextMessage
+	if c.encoding == BinaryEncoding {
+		frame = websocket.BinaryMessage
+	}
+	return c.conn.WriteMessage(frame, encoded)
 }
 
 // receiverLoop proxies the blocking conn.ReadMessage() into the main client
@@ -260,32 +349,65 @@ func (c *Client) receiverLoop() {
 
 // handleMessage parses a message received from the client through websockets
 func (c *Client) handleMessage(msgType int, msg []byte) error {
-	if msgType != websocket.TextMessage {
+	var (
+		typ  MessageType
+		data []byte
+		err  error
+	)
+	switch {
+	case msgType == websocket.TextMessage:
+		typ, data, err = parseTextMessage(msg)
+	case msgType == websocket.BinaryMessage && c.encoding == BinaryEncoding:
+		typ, data, err = parseBinaryMessage(msg)
+	default:
 		return errInvalidFrame("only text frames allowed")
 	}
-	if len(msg) < 2 {
+	if err != nil {
+		return err
+	}
+
+	if !c.synced && typ != MessageSynchronise {
 		return errInvalidPayload(msg)
 	}
+	if limited, err := c.isRateLimited(messageLimit); err != nil || limited {
+		return err
+	}
+
+	return c.runHandler(typ, data)
+}
+
+// Split a text message into its type and JSON payload
+func parseTextMessage(msg []byte) (MessageType, []byte, error) {
+	if len(msg) < 2 {
+		return 0, nil, errInvalidPayload(msg)
+	}
 
 	// First two characters of a message define its type
 	uncast, err := strconv.ParseUint(string(msg[:2]), 10, 8)
 	if err != nil {
-		return errInvalidPayload(msg)
-	}
-	typ := MessageType(uncast)
-	if !c.synced && typ != MessageSynchronise {
-		return errInvalidPayload(msg)
+		return 0, nil, errInvalidPayload(msg)
 	}
+	return MessageType(uncast), msg[2:], nil
+}
 
-	return c.runHandler(typ, msg)
+// Split a binary message into its type and payload. The MessagePack payload
+// is converted to JSON.
+func parseBinaryMessage(msg []byte) (MessageType, []byte, error) {
+	if len(msg) < 1 {
+		return 0, nil, errInvalidPayload(msg)
+	}
+	data, err := binaryToJSON(msg[1:])
+	if err != nil {
+		return 0, nil, errInvalidPayload(msg)
+	}
+	return MessageType(msg[0]), data, nil
 }
 
 // Run the appropriate handler for the websocket message
-func (c *Client) runHandler(typ MessageType, msg []byte) error {
-	data := msg[2:]
+func (c *Client) runHandler(typ MessageType, data []byte) error {
 	handler, ok := handlers[typ]
 	if !ok {
-		return errInvalidPayload(msg)
+		return errInvalidPayload(prependMessageType(TextEncoding, typ, data))
 	}
 	return handler(data, c)
 }
@@ -40,6 +40,7 @@ type mockWSServer struct {
 func init() {
 	db.DBName = "meguca_test_websockets"
 	db.IsTest = true
+	isTest = true
 	if err := db.LoadDB(); err != nil {
 		panic(err)
 	}
@@ -8,14 +8,23 @@ import (
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bakape/meguca/config"
+	"github.com/bakape/meguca/types"
 )
 
 var (
-	commandRegexp   = regexp.MustCompile(`^#(flip|\d*d\d+|8ball|pyu|pcount)$`)
-	diceRegexp      = regexp.MustCompile(`^(\d*)d(\d+)$`)
+	commandRegexp = regexp.MustCompile(
+		`^#(flip|8ball|pyu|pcount|poll` +
+			`|\d{0,3}d\d{1,5}(?:k[hl]\d{1,3})?(?:[+-]\d{1,5})?` +
+			`|syncwatch(?:\d{1,2}:)?\d{1,2}:\d{1,2}(?: \+\d{1,4})?` +
+			`|[a-z][a-z0-9_]{0,19})$`,
+	)
+	diceRegexp      = regexp.MustCompile(`^(\d*)d(\d+)(k[hl]\d+)?([+-]\d+)?$`)
 	linkRegexp      = regexp.MustCompile(`^>>(>*)(\d+)$`)
+	crossLinkRegexp = regexp.MustCompile(`^>>>(>*)\/(\w+)\/(\d+)$`)
 	referenceRegexp = regexp.MustCompile(`^>>>(>*)\/(\w+)\/$`)
 	urlRegexp       = regexp.MustCompile(
 		`^(?:magnet:\?|https?:\/\/)[-a-zA-Z0-9@:%_\+\.~#\?&\/=]+$`,
@@ -106,6 +115,10 @@ func (c *postContext) parseFragment(frag []byte) {
 				// Post links
 				c.parsePostLink(m)
 				continue
+			} else if m := crossLinkRegexp.FindSubmatch(word); m != nil {
+				// Cross-board post links
+				c.parseCrossLink(m)
+				continue
 			} else if m := referenceRegexp.FindSubmatch(word); m != nil {
 				// Internal and custom reference URLs
 				c.parseReference(m)
@@ -152,6 +165,22 @@ func (c *postContext) parsePostLink(m [][]byte) {
 	c.WriteString(string(t))
 }
 
+// Parse a potential link to a post on a specific board
+func (c *postContext) parseCrossLink(m [][]byte) {
+	id, _ := strconv.ParseInt(string(m[3]), 10, 64)
+	verified, ok := c.Links[id]
+	if !ok || verified.Board != string(m[2]) {
+		c.Write(m[0])
+		return
+	}
+
+	if len(m[1]) != 0 {
+		c.Write(m[1])
+	}
+	t := renderPostLink(id, verified.OP, verified.Board, verified.OP != c.OP)
+	c.WriteString(string(t))
+}
+
 // Parse internal or customly set reference URL
 func (c *postContext) parseReference(m [][]byte) {
 	var (
@@ -216,49 +245,182 @@ func (c *postContext) parseCommands(bit string) {
 		return
 	}
 
-	// TODO: Sycnwatch
-
 	inner := new(bytes.Buffer)
-	switch bit {
-	case "flip", "8ball", "pyu", "pcount":
+	switch {
+	case bit == "flip", bit == "8ball", bit == "pyu", bit == "pcount":
 		fmt.Fprint(inner, c.Commands[c.state.iDice].Val)
 		c.state.iDice++
-	default:
-		// Validate dice
-		m := diceRegexp.FindStringSubmatch(bit)
-		if m[1] != "" {
-			if rolls, err := strconv.Atoi(m[1]); err != nil || rolls > 10 {
-				c.writeInvalidCommand(bit)
-				return
-			}
-		}
-		if sides, err := strconv.Atoi(m[2]); err != nil || sides > 100 {
+	case strings.HasPrefix(bit, "syncwatch"):
+		com := c.Commands[c.state.iDice]
+		uncast, ok := com.Val.([]interface{})
+		if com.Type != types.SyncWatch || !ok || len(uncast) != 2 {
 			c.writeInvalidCommand(bit)
 			return
 		}
-
-		// Cast []interface to []uint16
-		uncast := c.Commands[c.state.iDice].Val.([]interface{})
-		rolls := make([]uint16, len(uncast))
-		for i := range rolls {
-			rolls[i] = uint16(uncast[i].(float64))
+		var times [2]int64
+		for i := range times {
+			f, _ := uncast[i].(float64)
+			times[i] = int64(f)
 		}
+		c.state.iDice++
 
+		// Also expose the timestamps for the client to update the timer
+		fmt.Fprintf(
+			c,
+			`<strong class="syncwatch" data-start="%d" data-end="%d">#%s (%s)`+
+				`</strong>`,
+			times[0], times[1],
+			html.EscapeString(bit),
+			formatSyncWatch(times[0], times[1], time.Now().Unix()),
+		)
+		return
+	case bit == "poll":
+		if !c.formatPoll() {
+			c.writeInvalidCommand(bit)
+		}
+		return
+	case diceRegexp.MatchString(bit):
+		if !c.formatDice(inner, bit) {
+			c.writeInvalidCommand(bit)
+			return
+		}
+	default:
+		// Board-defined commands. Only consume the result, if it belongs to
+		// this command.
+		com := c.Commands[c.state.iDice]
+		val, ok := com.Val.(map[string]interface{})
+		name, _ := val["name"].(string)
+		isCustom := com.Type == types.CustomAnswer ||
+			com.Type == types.CustomCounter
+		if !isCustom || !ok || name != bit {
+			c.writeInvalidCommand(bit)
+			return
+		}
+		inner.WriteString(html.EscapeString(fmt.Sprint(val["val"])))
 		c.state.iDice++
-		var sum uint
-		for i, roll := range rolls {
+	}
+
+	fmt.Fprintf(c, "<strong>#%s (%s)</strong>", bit, inner.String())
+}
+
+// Format the state of a #syncwatch timer at Unix time now. Returns a countdown
+// before the start, the elapsed and total duration while running or
+// "finished".
+func formatSyncWatch(start, end, now int64) string {
+	switch {
+	case now < start:
+		return "-" + formatDuration(start-now)
+	case now < end:
+		return formatDuration(now-start) + " / " + formatDuration(end-start)
+	default:
+		return "finished"
+	}
+}
+
+// Format a duration in seconds as [hours:]minutes:seconds
+func formatDuration(secs int64) string {
+	h, m, s := secs/3600, secs%3600/60, secs%60
+	if h != 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
+
+// Write a poll with the tallies of its options. The options can be voted for
+// by clicking on them. Returns false, if the command is not a valid poll.
+func (c *postContext) formatPoll() bool {
+	com := c.Commands[c.state.iDice]
+	val, ok := com.Val.(map[string]interface{})
+	if com.Type != types.Poll || !ok {
+		return false
+	}
+	options, _ := val["options"].([]interface{})
+	votes, _ := val["votes"].([]interface{})
+	if len(options) != len(votes) {
+		return false
+	}
+	c.state.iDice++
+
+	c.WriteString(`<strong class="poll">#poll`)
+	if len(options) != 0 {
+		c.WriteString(" (")
+		for i, o := range options {
 			if i != 0 {
-				inner.WriteString(" + ")
+				c.WriteString(", ")
 			}
-			sum += uint(roll)
-			inner.WriteString(strconv.FormatUint(uint64(roll), 10))
+			n, _ := votes[i].(float64)
+			fmt.Fprintf(
+				c,
+				`<a class="poll-option" data-option="%d">%s: %d</a>`,
+				i, html.EscapeString(fmt.Sprint(o)), int(n),
+			)
 		}
-		if len(rolls) > 1 {
-			fmt.Fprintf(inner, " = %d", sum)
+		c.WriteByte(')')
+	}
+	c.WriteString("</strong>")
+	return true
+}
+
+// Format the result of a dice roll command. Supports both the current
+// types.DiceRoll values and the plain roll arrays of older posts. Returns
+// false, if the command and its result do not match.
+func (c *postContext) formatDice(w *bytes.Buffer, bit string) bool {
+	m := diceRegexp.FindStringSubmatch(bit)
+	rollCount := 1
+	if m[1] != "" {
+		var err error
+		rollCount, err = strconv.Atoi(m[1])
+		if err != nil || rollCount > config.MaxDice {
+			return false
 		}
 	}
+	sides, err := strconv.Atoi(m[2])
+	if err != nil || sides > config.MaxDieSides {
+		return false
+	}
 
-	fmt.Fprintf(c, "<strong>#%s (%s)</strong>", bit, inner.String())
+	var (
+		uncast   []interface{}
+		modifier int
+		total    int
+		hasTotal bool
+	)
+	switch val := c.Commands[c.state.iDice].Val.(type) {
+	case []interface{}:
+		uncast = val
+	case map[string]interface{}:
+		uncast, _ = val["rolls"].([]interface{})
+		mod, _ := val["modifier"].(float64)
+		tot, _ := val["total"].(float64)
+		modifier, total, hasTotal = int(mod), int(tot), true
+	}
+	if len(uncast) != rollCount {
+		return false
+	}
+	c.state.iDice++
+
+	var sum int
+	for i, r := range uncast {
+		if i != 0 {
+			w.WriteString(" + ")
+		}
+		roll, _ := r.(float64)
+		sum += int(roll)
+		w.WriteString(strconv.Itoa(int(roll)))
+	}
+	switch {
+	case modifier > 0:
+		fmt.Fprintf(w, " + %d", modifier)
+	case modifier < 0:
+		fmt.Fprintf(w, " - %d", -modifier)
+	}
+	if !hasTotal {
+		total = sum
+	}
+	if len(uncast) > 1 || modifier != 0 || m[3] != "" {
+		fmt.Fprintf(w, " = %d", total)
+	}
+	return true
 }
 
 // If command validation failed, simply write the string
@@ -125,6 +125,141 @@ func TestRenderBody(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "#syncwatch",
+			in:   "#syncwatch1:00",
+			out: `<span><strong class="syncwatch" data-start="100" ` +
+				`data-end="160">#syncwatch1:00 (finished)</strong><br></span>`,
+			commands: []types.Command{
+				{
+					Type: types.SyncWatch,
+					Val:  []interface{}{float64(100), float64(160)},
+				},
+			},
+		},
+		{
+			name: "#syncwatch with offset",
+			in:   "#syncwatch1:00 +10",
+			out: `<span><strong class="syncwatch" data-start="110" ` +
+				`data-end="170">#syncwatch1:00 +10 (finished)</strong>` +
+				`<br></span>`,
+			commands: []types.Command{
+				{
+					Type: types.SyncWatch,
+					Val:  []interface{}{float64(110), float64(170)},
+				},
+			},
+		},
+		{
+			name: "#syncwatch with wrong command type",
+			in:   "#syncwatch1:00",
+			out:  "<span>#syncwatch1:00<br></span>",
+			commands: []types.Command{
+				{
+					Type: types.CustomAnswer,
+					Val:  []interface{}{"foo", "bar"},
+				},
+			},
+		},
+		{
+			name: "custom answer command",
+			in:   "#quote",
+			out:  "<span><strong>#quote (&lt;b&gt;)</strong><br></span>",
+			commands: []types.Command{
+				{
+					Type: types.CustomAnswer,
+					Val: map[string]interface{}{
+						"name": "quote",
+						"val":  "<b>",
+					},
+				},
+			},
+		},
+		{
+			name: "custom counter command",
+			in:   "#counter",
+			out:  "<span><strong>#counter (3)</strong><br></span>",
+			commands: []types.Command{
+				{
+					Type: types.CustomCounter,
+					Val: map[string]interface{}{
+						"name": "counter",
+						"val":  float64(3),
+					},
+				},
+			},
+		},
+		{
+			name: "custom command without result",
+			in:   "#rank\n#quote",
+			out: "<span>#rank<br></span>" +
+				"<span><strong>#quote (foo)</strong><br></span>",
+			commands: []types.Command{
+				{
+					Type: types.CustomAnswer,
+					Val: map[string]interface{}{
+						"name": "quote",
+						"val":  "foo",
+					},
+				},
+			},
+		},
+		{
+			name: "open poll",
+			in:   "#poll",
+			out:  `<span><strong class="poll">#poll</strong><br></span>`,
+			commands: []types.Command{
+				{
+					Type: types.Poll,
+					Val: map[string]interface{}{
+						"options": []interface{}{},
+						"votes":   []interface{}{},
+					},
+				},
+			},
+		},
+		{
+			name: "closed poll",
+			in:   "#poll",
+			out: `<span><strong class="poll">#poll (` +
+				`<a class="poll-option" data-option="0">yes: 2</a>, ` +
+				`<a class="poll-option" data-option="1">&lt;no&gt;: 0</a>` +
+				`)</strong><br></span>`,
+			commands: []types.Command{
+				{
+					Type: types.Poll,
+					Val: map[string]interface{}{
+						"options": []interface{}{"yes", "<no>"},
+						"votes":   []interface{}{float64(2), float64(0)},
+					},
+				},
+			},
+		},
+		{
+			name: "poll with mismatched votes",
+			in:   "#poll",
+			out:  "<span>#poll<br></span>",
+			commands: []types.Command{
+				{
+					Type: types.Poll,
+					Val: map[string]interface{}{
+						"options": []interface{}{"yes"},
+						"votes":   []interface{}{},
+					},
+				},
+			},
+		},
+		{
+			name: "not a custom command",
+			in:   "#hashtag",
+			out:  "<span>#hashtag<br></span>",
+			commands: []types.Command{
+				{
+					Type: types.Flip,
+					Val:  true,
+				},
+			},
+		},
 		{
 			name: "single roll dice",
 			in:   "#d20",
@@ -148,6 +283,67 @@ func TestRenderBody(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "dice with modifier",
+			in:   "#2d20+5",
+			out:  "<span><strong>#2d20+5 (22 + 33 + 5 = 60)</strong><br></span>",
+			commands: []types.Command{
+				{
+					Type: types.Dice,
+					Val: map[string]interface{}{
+						"rolls":    []interface{}{float64(22), float64(33)},
+						"modifier": float64(5),
+						"total":    float64(60),
+					},
+				},
+			},
+		},
+		{
+			name: "dice with negative modifier",
+			in:   "#d1000-5",
+			out:  "<span><strong>#d1000-5 (500 - 5 = 495)</strong><br></span>",
+			commands: []types.Command{
+				{
+					Type: types.Dice,
+					Val: map[string]interface{}{
+						"rolls":    []interface{}{float64(500)},
+						"modifier": float64(-5),
+						"total":    float64(495),
+					},
+				},
+			},
+		},
+		{
+			name: "keep highest dice",
+			in:   "#4d6kh3",
+			out: "<span><strong>#4d6kh3 (1 + 6 + 5 + 4 = 15)</strong>" +
+				"<br></span>",
+			commands: []types.Command{
+				{
+					Type: types.Dice,
+					Val: map[string]interface{}{
+						"rolls": []interface{}{
+							float64(1), float64(6), float64(5), float64(4),
+						},
+						"total": float64(15),
+					},
+				},
+			},
+		},
+		{
+			name: "single die without modifier",
+			in:   "#d20",
+			out:  "<span><strong>#d20 (7)</strong><br></span>",
+			commands: []types.Command{
+				{
+					Type: types.Dice,
+					Val: map[string]interface{}{
+						"rolls": []interface{}{float64(7)},
+						"total": float64(7),
+					},
+				},
+			},
+		},
 		{
 			name: "too many dice rolls",
 			in:   "#11d20",
@@ -161,8 +357,8 @@ func TestRenderBody(t *testing.T) {
 		},
 		{
 			name: "too many dice faces",
-			in:   "#2d101",
-			out:  "<span>#2d101<br></span>",
+			in:   "#2d10001",
+			out:  "<span>#2d10001<br></span>",
 			commands: []types.Command{
 				{
 					Type: types.Dice,
@@ -239,6 +435,30 @@ func TestRenderBody(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "valid cross-board link",
+			in:   ">>>/a/21",
+			out:  `<span><em><a href="/a/21?noscript=true#p21">>>>/a/21</a></em><br></span>`,
+			op:   22,
+			links: types.LinkMap{
+				21: {
+					Board: "a",
+					OP:    21,
+				},
+			},
+		},
+		{
+			name: "cross-board link to wrong board",
+			in:   ">>>/c/21",
+			out:  `<span><em>>>>/c/21</em><br></span>`,
+			op:   22,
+			links: types.LinkMap{
+				21: {
+					Board: "a",
+					OP:    21,
+				},
+			},
+		},
 		{
 			name: "invalid reference",
 			in:   ">>>/fufufu/",
@@ -306,3 +526,29 @@ func TestRenderBody(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatSyncWatch(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name       string
+		start, end int64
+		out        string
+	}{
+		{"not started", 100, 200, "-00:50"},
+		{"running", 0, 4000, "00:50 / 1:06:40"},
+		{"running for hours", 0, 7200, "00:50 / 2:00:00"},
+		{"finished", 0, 50, "finished"},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if s := formatSyncWatch(c.start, c.end, 50); s != c.out {
+				LogUnexpected(t, c.out, s)
+			}
+		})
+	}
+}
@@ -23,6 +23,12 @@ type boardVars struct {
 	Threads               types.BoardThreads
 }
 
+type archiveVars struct {
+	IsAll                     bool
+	Title, PrevPage, NextPage string
+	Threads                   types.BoardThreads
+}
+
 type threadVars struct {
 	Notice, Title string
 	Thread        *types.Thread
@@ -33,7 +39,7 @@ func Board(b string, data *types.Board) ([]byte, error) {
 	w := new(bytes.Buffer)
 	conf := config.GetBoardConfigs(b)
 	title := fmt.Sprintf("/%s/ - %s", b, conf.Title)
-	sort.Sort(data.Threads) // Sort by last reply time
+	sort.Sort(data.Threads) // Sort by stickiness and last reply time
 
 	v := boardVars{
 		IsAll:   b == "all",
@@ -53,6 +59,53 @@ func Board(b string, data *types.Board) ([]byte, error) {
 	return renderNoscriptIndex(w.Bytes(), title)
 }
 
+// Archive renders a page of the archive of a board for noscript browsers. last
+// specifies, if this is the last page of the archive.
+func Archive(b string, data *types.Board, page int, last bool) (
+	[]byte, error,
+) {
+	w := new(bytes.Buffer)
+	title := fmt.Sprintf("/%s/ - Archive", b)
+	sort.Sort(byArchivalTime(data.Threads))
+
+	v := archiveVars{
+		IsAll:   b == "all",
+		Title:   title,
+		Threads: data.Threads,
+	}
+	if page != 0 {
+		v.PrevPage = fmt.Sprintf("?page=%d", page-1)
+	}
+	if !last {
+		v.NextPage = fmt.Sprintf("?page=%d", page+1)
+	}
+
+	err := tmpl["archive"].Execute(w, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return renderNoscriptIndex(w.Bytes(), title)
+}
+
+// Sorts archived threads by time of archival and last reply time, newest first
+type byArchivalTime types.BoardThreads
+
+func (b byArchivalTime) Len() int {
+	return len(b)
+}
+
+func (b byArchivalTime) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
+
+func (b byArchivalTime) Less(i, j int) bool {
+	if b[i].ArchivedAt != b[j].ArchivedAt {
+		return b[i].ArchivedAt > b[j].ArchivedAt
+	}
+	return b[i].ReplyTime > b[j].ReplyTime
+}
+
 // Common part of both thread and board noscript pages
 func renderNoscriptIndex(data []byte, title string) ([]byte, error) {
 	w := new(bytes.Buffer)
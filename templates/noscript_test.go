@@ -1,5 +1,13 @@
 package templates
 
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/bakape/meguca/types"
+)
+
 // func TestBoard(t *testing.T) {
 // 	_, err := Board("all", &types.Board{
 // 		Threads: types.BoardThreads{
@@ -57,3 +65,80 @@ package templates
 // 		t.Fatal(err)
 // 	}
 // }
+
+func TestArchive(t *testing.T) {
+	threads := types.BoardThreads{
+		{
+			ID:         1,
+			Board:      "a",
+			Subject:    "foo",
+			ReplyTime:  3,
+			ArchivedAt: 10,
+		},
+		{
+			ID:         2,
+			Board:      "a",
+			Subject:    "bar",
+			ReplyTime:  5,
+			ArchivedAt: 20,
+		},
+		{
+			ID:        3,
+			Board:     "a",
+			Subject:   "baz",
+			ReplyTime: 4,
+		},
+	}
+
+	html, err := Archive("a", &types.Board{Threads: threads}, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Newest archival first. Threads archived by staff last.
+	var last int
+	for _, s := range [...]string{"bar", "foo", "baz"} {
+		i := bytes.Index(html, []byte("「"+s+"」"))
+		if i < last {
+			t.Fatalf("thread not listed in order: %s", s)
+		}
+		last = i
+	}
+}
+
+func TestArchivePagination(t *testing.T) {
+	cases := [...]struct {
+		name       string
+		page       int
+		last       bool
+		prev, next bool
+	}{
+		{"only page", 0, true, false, false},
+		{"first page", 0, false, false, true},
+		{"middle page", 1, false, true, true},
+		{"last page", 2, true, true, false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			html, err := Archive("a", new(types.Board), c.page, c.last)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			links := [...]struct {
+				href string
+				std  bool
+			}{
+				{fmt.Sprintf(`href="?page=%d"`, c.page-1), c.prev},
+				{fmt.Sprintf(`href="?page=%d"`, c.page+1), c.next},
+			}
+			for _, l := range links {
+				if bytes.Contains(html, []byte(l.href)) != l.std {
+					t.Errorf("unexpected page link %s: %t", l.href, !l.std)
+				}
+			}
+		})
+	}
+}
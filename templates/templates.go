@@ -92,6 +92,9 @@ func ParseTemplates() error {
 			"thumbPath": thumbPath,
 		}},
 		{"thread", []string{"article"}, postFunctions},
+		{"archive", nil, template.FuncMap{
+			"renderTime": renderTime,
+		}},
 	}
 
 	for _, s := range specs {
@@ -157,7 +160,7 @@ func indexTemplate() (desktop Store, mobile Store, err error) {
 	v := vars{
 		Config:      template.JS(clientJSON),
 		ConfigHash:  hash,
-		Captcha:     conf.Captcha,
+		Captcha:     conf.Captcha && !conf.LocalCaptcha,
 		Email:       conf.FeedbackEmail,
 		DefaultCSS:  conf.DefaultCSS,
 		ImageSearch: imageSearchEngines,
@@ -0,0 +1,75 @@
+package types
+
+// ModerationAction is the type of staff action recorded in the moderation log
+type ModerationAction uint8
+
+const (
+	// ConfigureServer is the modification of global server configuration
+	ConfigureServer ModerationAction = iota
+
+	// CreateBoard is the creation of a new board
+	CreateBoard
+
+	// ConfigureBoard is the modification of board configurations
+	ConfigureBoard
+
+	// AddStaff is the assignment of a user to a board staff position
+	AddStaff
+
+	// RemoveStaff is the removal of a user from a board staff position
+	RemoveStaff
+
+	// DeletePost is the deletion of a post by board staff
+	DeletePost
+
+	// BanPoster is the banning of a post's author
+	BanPoster
+
+	// LockThread is the locking or unlocking of a thread
+	LockThread
+
+	// StickyThread is the setting or unsetting of a thread as sticky
+	StickyThread
+
+	// ArchiveThread is the archiving or unarchiving of a thread
+	ArchiveThread
+)
+
+// ModLogEntry is a single staff action recorded in the moderation log
+type ModLogEntry struct {
+	Type ModerationAction `json:"type" gorethink:"type"`
+
+	// Target post or thread, if any
+	Target int64 `json:"target,omitempty" gorethink:"target,omitempty"`
+
+	// Unix timestamp of the action
+	Time int64 `json:"time" gorethink:"time"`
+
+	// Board the action was performed on. "all" for global actions.
+	Board string `json:"board" gorethink:"board"`
+
+	// ID of the staff member performing the action
+	By string `json:"by" gorethink:"by"`
+
+	// Any additional data, such as a ban reason or the assigned staff position
+	Data string `json:"data,omitempty" gorethink:"data,omitempty"`
+}
+
+// Report is a reader's report of a post violating the rules
+type Report struct {
+	ID string `json:"id" gorethink:"id,omitempty"`
+
+	// Reported post
+	Target int64 `json:"target" gorethink:"target"`
+
+	// Unix timestamp of report creation
+	Time int64 `json:"time" gorethink:"time"`
+
+	// Parent board of the reported post
+	Board string `json:"board" gorethink:"board"`
+
+	Reason string `json:"reason" gorethink:"reason"`
+
+	// IP of the reporter. Used for rate limiting.
+	IP string `json:"-" gorethink:"ip"`
+}
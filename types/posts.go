@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 // CommandType are the various struct types of hash commands and their
@@ -30,6 +31,17 @@ const (
 
 	// Pcount - don't ask
 	Pcount
+
+	// CustomAnswer is a board-defined command picking a random answer from a
+	// list
+	CustomAnswer
+
+	// CustomCounter is a board-defined command incrementing a per-board
+	// counter
+	CustomCounter
+
+	// Poll is an in-thread poll with the post's following lines as options
+	Poll
 )
 
 // Board stores board metadata and the OPs of all threads
@@ -59,7 +71,11 @@ func (b *Board) MarshalJSON() ([]byte, error) {
 
 // BoardThreads is an array stripped down version of Thread for whole-board
 // retrieval queries. Reduces server memory usage and served JSON payload.
-type BoardThreads []struct {
+type BoardThreads []BoardThread
+
+// BoardThread is a single thread of BoardThreads. Also sent to clients
+// subscribed to board page update feeds.
+type BoardThread struct {
 	Locked      bool   `json:"locked,omitempty" gorethink:"locked"`
 	Archived    bool   `json:"archived,omitempty" gorethink:"archived"`
 	Sticky      bool   `json:"sticky,omitempty" gorethink:"sticky"`
@@ -76,6 +92,9 @@ type BoardThreads []struct {
 	ReplyTime   int64  `json:"replyTime" gorethink:"replyTime"`
 	Board       string `json:"board" gorethink:"board"`
 	Subject     string `json:"subject" gorethink:"subject"`
+
+	// Unix timestamp of the thread's archival on expiry
+	ArchivedAt int64 `json:"archivedAt,omitempty" gorethink:"archivedAt,omitempty"`
 }
 
 // Thread is a transport/export wrapper that stores both the thread metadata,
@@ -108,18 +127,22 @@ type DatabaseThread struct {
 // Post is a generic post exposed publically through the JSON API. Either OP or
 // reply.
 type Post struct {
-	Editing   bool      `json:"editing,omitempty" gorethink:"editing"`
-	ID        int64     `json:"id" gorethink:"id"`
-	Time      int64     `json:"time" gorethink:"time"`
-	Body      string    `json:"body" gorethink:"body"`
-	Name      string    `json:"name,omitempty" gorethink:"name,omitempty"`
-	Trip      string    `json:"trip,omitempty" gorethink:"trip,omitempty"`
-	Auth      string    `json:"auth,omitempty" gorethink:"auth,omitempty"`
-	Email     string    `json:"email,omitempty" gorethink:"email,omitempty"`
-	Image     *Image    `json:"image,omitempty" gorethink:"image,omitempty"`
-	Backlinks LinkMap   `json:"backlinks,omitempty" gorethink:"backlinks,omitempty"`
-	Links     LinkMap   `json:"links,omitempty" gorethink:"links,omitempty"`
-	Commands  []Command `json:"commands,omitempty" gorethink:"commands,omitempty"`
+	Editing    bool      `json:"editing,omitempty" gorethink:"editing"`
+	Deleted    bool      `json:"deleted,omitempty" gorethink:"deleted,omitempty"`
+	Sage       bool      `json:"sage,omitempty" gorethink:"sage,omitempty"`
+	ID         int64     `json:"id" gorethink:"id"`
+	Time       int64     `json:"time" gorethink:"time"`
+	Body       string    `json:"body" gorethink:"body"`
+	Name       string    `json:"name,omitempty" gorethink:"name,omitempty"`
+	Trip       string    `json:"trip,omitempty" gorethink:"trip,omitempty"`
+	Auth       string    `json:"auth,omitempty" gorethink:"auth,omitempty"`
+	PosterID   string    `json:"posterID,omitempty" gorethink:"posterID,omitempty"`
+	Email      string    `json:"email,omitempty" gorethink:"email,omitempty"`
+	Image      *Image    `json:"image,omitempty" gorethink:"image,omitempty"`
+	Backlinks  LinkMap   `json:"backlinks,omitempty" gorethink:"backlinks,omitempty"`
+	Links      LinkMap   `json:"links,omitempty" gorethink:"links,omitempty"`
+	BoardLinks []string  `json:"boardLinks,omitempty" gorethink:"boardLinks,omitempty"`
+	Commands   []Command `json:"commands,omitempty" gorethink:"commands,omitempty"`
 }
 
 // StandalonePost is a post view that includes the "op" and "board" fields,
@@ -139,6 +162,17 @@ type DatabasePost struct {
 	Password    []byte   `gorethink:"password"`
 	Log         [][]byte `gorethink:"log"`
 	LastUpdated int64    `json:"lastUpdated" gorethink:"lastUpdated"`
+	Lease       *Lease   `json:"-" gorethink:"lease,omitempty"`
+
+	// Identifiers of IPs and accounts, that have voted in the post's poll
+	Voters []string `json:"-" gorethink:"voters,omitempty"`
+}
+
+// Lease grants a connection exclusive write access to an open post until it
+// expires
+type Lease struct {
+	Owner   string    `gorethink:"owner"`
+	Expires time.Time `gorethink:"expires"`
 }
 
 // LinkMap contains a map of post numbers, this tread is linking, to
@@ -153,22 +187,52 @@ type Link struct {
 
 // Command contains the type and value array of hash commands, such as dice
 // rolls, #flip, #8ball, etc. The Val field depends on the Type field.
-// Dice: []uint16
+// Dice: DiceRoll. Posts created before dice modifiers were supported store
+// only the []uint16 rolls.
 // Flip: bool
 // EightBall: string
-// SyncWatch: TODO: SyncWatch storage type
+// SyncWatch: [2]int64 Unix timestamps of the timer's start and end
 // Pyu: int64
 // Pcount: int64
+// CustomAnswer: CustomCommandResult with a string value
+// CustomCounter: CustomCommandResult with an int64 value
+// Poll: PollData
 type Command struct {
 	Type CommandType `json:"type" gorethink:"type"`
 	Val  interface{} `json:"val" gorethink:"val"`
 }
 
+// PollData contains the options and vote tallies of a #poll command. Options
+// are appended, as each line of the post is committed.
+type PollData struct {
+	Options []string `json:"options" gorethink:"options"`
+	Votes   []uint   `json:"votes" gorethink:"votes"`
+}
+
+// CustomCommandResult contains the name and result of a board-defined command.
+// The name is stored to match results to their commands, when rendering.
+type CustomCommandResult struct {
+	Name string      `json:"name" gorethink:"name"`
+	Val  interface{} `json:"val" gorethink:"val"`
+}
+
+// DiceRoll is the result of a dice roll command. Total is the sum of the kept
+// rolls and the modifier.
+type DiceRoll struct {
+	Rolls    []uint16 `json:"rolls" gorethink:"rolls"`
+	Modifier int      `json:"modifier,omitempty" gorethink:"modifier,omitempty"`
+	Total    int      `json:"total" gorethink:"total"`
+}
+
 func (b BoardThreads) Len() int {
 	return len(b)
 }
 
 func (b BoardThreads) Less(i, j int) bool {
+	// Sticky threads always sort first
+	if b[i].Sticky != b[j].Sticky {
+		return b[i].Sticky
+	}
 	return b[i].ReplyTime > b[j].ReplyTime
 }
 
@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/json"
+	"sort"
 	"testing"
 
 	. "github.com/bakape/meguca/test"
@@ -64,3 +65,23 @@ func TestMarshalEmptyBoard(t *testing.T) {
 		LogUnexpected(t, std, s)
 	}
 }
+
+func TestSortBoardThreads(t *testing.T) {
+	t.Parallel()
+
+	threads := make(BoardThreads, 4)
+	for i, replyTime := range [...]int64{1, 4, 2, 3} {
+		threads[i].ID = int64(i + 1)
+		threads[i].ReplyTime = replyTime
+	}
+	threads[0].Sticky = true
+	threads[2].Sticky = true
+
+	sort.Sort(threads)
+
+	ids := make([]int64, len(threads))
+	for i, t := range threads {
+		ids[i] = t.ID
+	}
+	AssertDeepEquals(t, ids, []int64{3, 1, 2, 4})
+}